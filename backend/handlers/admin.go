@@ -3,60 +3,48 @@ package handlers
 import (
 	"net/http"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
-	"spotify-clone/config"
 	"spotify-clone/models"
 	"spotify-clone/services"
 	"spotify-clone/utils"
 
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/iterator"
 )
 
-// AdminGetUsers returns all users (admin only)
+// AdminGetUsers returns a page of users sorted by newest, oldest, name or
+// email (admin only)
 func AdminGetUsers(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, _ := strconv.Atoi(limitStr)
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
-
-	iter := config.FirestoreClient.Collection("users").
-		Limit(limit).
-		Documents(c.Request.Context())
-	defer iter.Stop()
-
-	var users []interface{}
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			break
-		}
-		users = append(users, doc.Data())
+	limit, sort, cursor := pageParams(c, 50, 100, "newest")
+
+	users, next, total, err := services.ListUsers(c.Request.Context(), sort, cursor, limit)
+	if err != nil {
+		listError(c, err, "Failed to fetch users")
+		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, users)
+	utils.PaginatedSuccess(c, users, next, total)
 }
 
-// AdminGetSongs returns all songs with any status (admin only)
+// AdminGetSongs returns a page of songs with any status, or the one given
+// by ?status=, filtered and sorted like GetSongs (admin only)
 func AdminGetSongs(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "50")
-	statusFilter := c.DefaultQuery("status", "")
-	limit, _ := strconv.Atoi(limitStr)
+	limit, sort, cursor := pageParams(c, 50, 100, "newest")
+
+	filter, ok := songFilterFromQuery(c)
+	if !ok {
+		return
+	}
+	filter.Status = c.Query("status")
 
-	songs, err := services.GetSongs(c.Request.Context(), limit, "", statusFilter)
+	songs, next, total, err := services.GetSongs(c.Request.Context(), filter, sort, cursor, limit)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch songs")
+		listError(c, err, "Failed to fetch songs")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, songs)
+	utils.PaginatedSuccess(c, songs, next, total)
 }
 
 // AdminApproveSong approves or rejects a song
@@ -119,19 +107,18 @@ func AdminApproveArtist(c *gin.Context) {
 	utils.SuccessMessage(c, "Artist "+req.Status)
 }
 
-// AdminGetArtists returns all artist applications
+// AdminGetArtists returns a page of artist applications, all or with the
+// ?status= given, sorted by newest, oldest, name or followers (admin only)
 func AdminGetArtists(c *gin.Context) {
-	statusFilter := c.DefaultQuery("status", "")
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, _ := strconv.Atoi(limitStr)
+	limit, sort, cursor := pageParams(c, 50, 100, "newest")
 
-	artists, err := services.GetArtists(c.Request.Context(), statusFilter, limit)
+	artists, next, total, err := services.ListArtists(c.Request.Context(), c.Query("status"), sort, cursor, limit)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch artists")
+		listError(c, err, "Failed to fetch artists")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, artists)
+	utils.PaginatedSuccess(c, artists, next, total)
 }
 
 // AdminGetDashboard returns platform-wide statistics
@@ -213,6 +200,7 @@ func AdminUploadSong(c *gin.Context) {
 		return
 	}
 	genre := utils.SanitizeString(c.PostForm("genre"))
+	explicit := c.PostForm("explicit") == "true"
 
 	ext := strings.ToLower(filepath.Ext(audioHeader.Filename))
 	contentType := "audio/mpeg"
@@ -248,6 +236,7 @@ func AdminUploadSong(c *gin.Context) {
 		Duration:   0,
 		PlayCount:  0,
 		Genre:      genre,
+		Explicit:   explicit,
 		Status:     "approved", // Admins auto-approve
 		CreatedAt:  time.Now(),
 	}
@@ -259,9 +248,57 @@ func AdminUploadSong(c *gin.Context) {
 	}
 
 	song.ID = id
+	services.EnqueueEnrichment(id)
 	utils.SuccessResponse(c, http.StatusCreated, song)
 }
 
+// AdminEnrichSong looks a song up on MusicBrainz right away and returns the
+// updated song
+func AdminEnrichSong(c *gin.Context) {
+	if _, err := services.GetSong(c.Request.Context(), c.Param("id")); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Song not found")
+		return
+	}
+
+	song, err := services.EnrichSong(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadGateway, "Failed to enrich song: "+err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, song)
+}
+
+// AdminReindexSearch rebuilds the search index from Firestore in the background
+func AdminReindexSearch(c *gin.Context) {
+	if err := services.StartSearchReindex(); err != nil {
+		utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusAccepted, services.GetSearchIndexStatus())
+}
+
+// AdminNormalizeGenres lower-cases the genres of songs saved before genres
+// were normalized
+func AdminNormalizeGenres(c *gin.Context) {
+	changed, err := services.NormalizeSongGenres(c.Request.Context())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to normalize genres: "+err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"updated": changed})
+}
+
+// AdminBackfillSortFields fills in the sort fields of documents saved
+// before them, which sorted lists otherwise leave out
+func AdminBackfillSortFields(c *gin.Context) {
+	updated, err := services.BackfillSortFields(c.Request.Context())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to backfill sort fields: "+err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"updated": updated})
+}
+
 // AdminToggleFeatured toggles the featured status of a catalog song
 func AdminToggleFeatured(c *gin.Context) {
 	id := c.Param("id")
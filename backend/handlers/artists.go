@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"spotify-clone/models"
@@ -115,19 +117,41 @@ func GetPublicArtist(c *gin.Context) {
 		songs = []models.Song{}
 	}
 
-	// Get artist's albums
-	albums, err := services.GetAlbumsByArtist(c.Request.Context(), id)
+	// First page of the artist's albums; the rest come from GetPublicArtistAlbums
+	albums, next, _, err := services.GetAlbumsByArtist(c.Request.Context(), id, "newest", "", 20)
 	if err != nil {
 		albums = []models.Album{}
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"artist": artist,
-		"songs":  songs,
-		"albums": albums,
+		"artist":           artist,
+		"songs":            songs,
+		"albums":           albums,
+		"albumsNextCursor": next,
 	})
 }
 
+// GetPublicArtistAlbums returns a page of an approved artist's albums,
+// sorted by newest, oldest or title
+func GetPublicArtistAlbums(c *gin.Context) {
+	id := c.Param("id")
+	limit, sort, cursor := pageParams(c, 20, 50, "newest")
+
+	artist, err := services.GetArtist(c.Request.Context(), id)
+	if err != nil || artist.Status != "approved" {
+		utils.ErrorResponse(c, http.StatusNotFound, "Artist not found")
+		return
+	}
+
+	albums, next, total, err := services.GetAlbumsByArtist(c.Request.Context(), id, sort, cursor, limit)
+	if err != nil {
+		listError(c, err, "Failed to fetch albums")
+		return
+	}
+
+	utils.PaginatedSuccess(c, albums, next, total)
+}
+
 // GetArtistAnalytics returns analytics for the authenticated artist
 func GetArtistAnalytics(c *gin.Context) {
 	uid := c.GetString("uid")
@@ -191,19 +215,67 @@ func CreateAlbum(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusCreated, album)
 }
 
-// GetArtistAlbums returns the artist's albums
+// GetArtistAlbums returns a page of the artist's albums, sorted by newest,
+// oldest or title
 func GetArtistAlbums(c *gin.Context) {
 	uid := c.GetString("uid")
+	limit, sort, cursor := pageParams(c, 20, 50, "newest")
 
-	albums, err := services.GetAlbumsByArtist(c.Request.Context(), uid)
+	albums, next, total, err := services.GetAlbumsByArtist(c.Request.Context(), uid, sort, cursor, limit)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch albums")
+		listError(c, err, "Failed to fetch albums")
 		return
 	}
 
-	if albums == nil {
-		albums = []models.Album{}
+	utils.PaginatedSuccess(c, albums, next, total)
+}
+
+// ImportArchiveItem imports an Internet Archive item as an album with one song
+// per recording. Admin imports are approved immediately; artist imports await
+// review like uploads.
+func ImportArchiveItem(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var req models.ImportArchiveItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Archive identifier is required")
+		return
+	}
+	identifier := strings.TrimSpace(req.Identifier)
+	if i := strings.Index(identifier, "archive.org/details/"); i >= 0 {
+		identifier = strings.SplitN(identifier[i+len("archive.org/details/"):], "/", 2)[0]
+	}
+	if !services.ValidIAIdentifier(identifier) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid archive identifier")
+		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, albums)
+	// Admin imports belong to the catalog, like songs the resolver creates
+	owner := services.IAImportOwner{Status: "approved"}
+	if c.GetString("role") != "admin" {
+		artist, err := services.GetArtist(c.Request.Context(), uid)
+		if err != nil || artist.Status != "approved" {
+			utils.ErrorResponse(c, http.StatusForbidden, "Only approved artists can import items")
+			return
+		}
+		owner = services.IAImportOwner{ArtistID: uid, ArtistName: artist.DisplayName, Status: "pending"}
+	}
+
+	album, songs, err := services.ImportIAItem(c.Request.Context(), identifier, owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIAItemOwned):
+			utils.ErrorResponse(c, http.StatusConflict, "This item was already imported by another artist")
+		case errors.Is(err, services.ErrIAItemNoAudio):
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, "This item has no audio files")
+		default:
+			utils.ErrorResponse(c, http.StatusBadGateway, "Failed to import item: "+err.Error())
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, gin.H{
+		"album": album,
+		"songs": songs,
+	})
 }
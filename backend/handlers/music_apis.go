@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
+	"spotify-clone/models"
 	"spotify-clone/services"
 	"spotify-clone/utils"
 
@@ -41,6 +46,98 @@ func DiscoverJamendo(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, tracks)
 }
 
+// GetJamendoArtist returns a Jamendo artist with their albums and top tracks
+func GetJamendoArtist(c *gin.Context) {
+	id := c.Param("id")
+
+	artist, err := services.GetJamendoArtist(id)
+	if err != nil {
+		jamendoError(c, err, "Jamendo artist not found")
+		return
+	}
+
+	albums, err := services.GetJamendoArtistAlbums(id, 50)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Jamendo service unavailable: "+err.Error())
+		return
+	}
+	tracks, err := services.GetJamendoArtistTracks(id, 20)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Jamendo service unavailable: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"artist": artist,
+		"albums": albums,
+		"tracks": tracks,
+	})
+}
+
+// GetJamendoAlbum returns a Jamendo album and its tracklist
+func GetJamendoAlbum(c *gin.Context) {
+	album, err := services.GetJamendoAlbum(c.Param("id"))
+	if err != nil {
+		jamendoError(c, err, "Jamendo album not found")
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, album)
+}
+
+// DiscoverJamendoPlaylists searches Jamendo user playlists
+func DiscoverJamendoPlaylists(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+
+	playlists, err := services.SearchJamendoPlaylists(c.Query("q"), limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Jamendo service unavailable: "+err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, playlists)
+}
+
+// GetJamendoPlaylist returns a Jamendo playlist and its tracks
+func GetJamendoPlaylist(c *gin.Context) {
+	playlist, err := services.GetJamendoPlaylist(c.Param("id"))
+	if err != nil {
+		jamendoError(c, err, "Jamendo playlist not found")
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, playlist)
+}
+
+// DiscoverJamendoRadios lists Jamendo radio channels
+func DiscoverJamendoRadios(c *gin.Context) {
+	radios, err := services.GetJamendoRadios(50)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Jamendo service unavailable: "+err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, radios)
+}
+
+// GetJamendoRadioStream returns a radio's stream URL and what it's playing
+func GetJamendoRadioStream(c *gin.Context) {
+	radio, err := services.GetJamendoRadioStream(c.Param("id"))
+	if err != nil {
+		jamendoError(c, err, "Jamendo radio not found")
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, radio)
+}
+
+// jamendoError responds 404 for unknown IDs and 503 when Jamendo is unreachable
+func jamendoError(c *gin.Context, err error, notFound string) {
+	if errors.Is(err, services.ErrJamendoNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, notFound)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusServiceUnavailable, "Jamendo service unavailable: "+err.Error())
+}
+
 // DiscoverFMA searches or browses Free Music Archive
 func DiscoverFMA(c *gin.Context) {
 	query := c.Query("q")
@@ -144,14 +241,14 @@ func DiscoverSpotify(c *gin.Context) {
 	}
 
 	if query != "" {
-		result, err := services.SearchSpotifyMetadata(query, limit)
+		result, err := services.SearchSpotifyMetadata(query, limit, requestRegion(c))
 		if err != nil {
 			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Spotify unavailable: "+err.Error())
 			return
 		}
 		utils.SuccessResponse(c, http.StatusOK, result)
 	} else {
-		tracks, err := services.GetSpotifyFeaturedTracks(limit)
+		tracks, err := services.GetSpotifyFeaturedTracks(requestRegion(c), limit)
 		if err != nil {
 			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Spotify unavailable: "+err.Error())
 			return
@@ -160,7 +257,7 @@ func DiscoverSpotify(c *gin.Context) {
 	}
 }
 
-// DiscoverDeezer searches or gets charts from Deezer
+// DiscoverDeezer searches or gets charts from Deezer, as songs
 func DiscoverDeezer(c *gin.Context) {
 	query := c.Query("q")
 	limitStr := c.DefaultQuery("limit", "20")
@@ -169,7 +266,7 @@ func DiscoverDeezer(c *gin.Context) {
 		limit = 20
 	}
 
-	var tracks interface{}
+	var tracks []services.DeezerTrack
 	var err error
 
 	if query != "" {
@@ -183,7 +280,113 @@ func DiscoverDeezer(c *gin.Context) {
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, tracks)
+	utils.SuccessResponse(c, http.StatusOK, services.DeezerSongs(tracks))
+}
+
+// DiscoverDeezerGenres lists Deezer genres
+func DiscoverDeezerGenres(c *gin.Context) {
+	genres, err := services.GetDeezerGenres()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Deezer service unavailable: "+err.Error())
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, genres)
+}
+
+// GetDeezerGenreChart returns the editorial chart of a Deezer genre as songs
+func GetDeezerGenreChart(c *gin.Context) {
+	id, ok := deezerID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	tracks, err := services.GetDeezerByGenre(id, limit)
+	if err != nil {
+		deezerError(c, err, "Deezer genre not found")
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, services.DeezerSongs(tracks))
+}
+
+// GetDeezerArtist returns a Deezer artist with their top tracks as songs and
+// related artists
+func GetDeezerArtist(c *gin.Context) {
+	id, ok := deezerID(c)
+	if !ok {
+		return
+	}
+
+	artist, err := services.GetDeezerArtist(id)
+	if err != nil {
+		deezerError(c, err, "Deezer artist not found")
+		return
+	}
+	top, err := services.GetDeezerArtistTop(id, 20)
+	if err != nil {
+		deezerError(c, err, "Deezer artist not found")
+		return
+	}
+	related, err := services.GetDeezerRelatedArtists(id, 20)
+	if err != nil {
+		related = []services.DeezerArtist{}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"artist":  artist,
+		"songs":   services.DeezerSongs(top),
+		"related": related,
+	})
+}
+
+// GetDeezerAlbum returns a Deezer album and its tracklist as songs
+func GetDeezerAlbum(c *gin.Context) {
+	id, ok := deezerID(c)
+	if !ok {
+		return
+	}
+
+	album, err := services.GetDeezerAlbum(id)
+	if err != nil {
+		deezerError(c, err, "Deezer album not found")
+		return
+	}
+
+	songs := services.DeezerSongs(album.Tracks.Data)
+	if len(album.Genres.Data) > 0 {
+		for i := range songs {
+			songs[i].Genre = album.Genres.Data[0].Name
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"album":  album.DeezerAlbum,
+		"artist": album.Artist,
+		"genres": album.Genres.Data,
+		"songs":  songs,
+	})
+}
+
+// deezerID parses the numeric :id of a Deezer route
+func deezerID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid Deezer ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// deezerError responds 404 for unknown IDs and 503 when Deezer is unreachable
+func deezerError(c *gin.Context, err error, notFound string) {
+	if errors.Is(err, services.ErrDeezerNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, notFound)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusServiceUnavailable, "Deezer service unavailable: "+err.Error())
 }
 
 // DiscoverYouTube searches YouTube Music or gets trending
@@ -199,30 +402,30 @@ func DiscoverYouTube(c *gin.Context) {
 	var err error
 
 	if query != "" {
-		tracks, err = services.SearchYouTubeMusic(query, limit)
+		tracks, err = services.SearchYouTubeMusic(c.Request.Context(), query, limit)
 	} else {
-		tracks, err = services.GetYouTubeTrending("IN", limit)
+		tracks, err = services.GetYouTubeTrending(c.Request.Context(), requestRegion(c), limit)
 	}
 
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusServiceUnavailable, "YouTube Music unavailable: "+err.Error())
+		extractorError(c, "YouTube Music unavailable: "+err.Error(), err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, tracks)
 }
 
-// GetYouTubeStream returns audio stream URL for a YouTube video
+// GetYouTubeStream returns a signed proxy URL for a YouTube video's audio
 func GetYouTubeStream(c *gin.Context) {
 	videoID := c.Param("videoId")
-	if videoID == "" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Video ID required")
+	if !services.ValidYouTubeID(videoID) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid video ID")
 		return
 	}
 
-	info, err := services.GetYouTubeAudioURL(videoID)
+	info, err := services.GetYouTubeAudioURL(c.Request.Context(), videoID)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Failed to get audio: "+err.Error())
+		extractorError(c, "Failed to get audio: "+err.Error(), err)
 		return
 	}
 
@@ -232,14 +435,12 @@ func GetYouTubeStream(c *gin.Context) {
 		return
 	}
 
-	protocol := "http"
-	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
-		protocol = "https"
-	}
-	proxyURL := fmt.Sprintf("%s://%s/api/discover/youtube/proxy/%s", protocol, c.Request.Host, videoID)
+	token, expiresAt := services.IssueStreamToken(c.GetString("uid"), videoID)
+	proxyURL := fmt.Sprintf("%s/api/discover/youtube/proxy/%s?token=%s", requestBaseURL(c), videoID, url.QueryEscape(token))
 
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
 		"audioUrl":  proxyURL,
+		"expiresAt": expiresAt,
 		"title":     info.Title,
 		"uploader":  info.Uploader,
 		"thumbnail": info.Thumbnail,
@@ -247,53 +448,125 @@ func GetYouTubeStream(c *gin.Context) {
 	})
 }
 
-// ProxyYouTubeStream streams audio through the backend to bypass IP locks
+// Upstream response headers passed through to the client
+var proxyHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Range",
+	"Accept-Ranges",
+	"Last-Modified",
+	"ETag",
+}
+
+var proxyClient = &http.Client{}
+
+// ProxyYouTubeStream streams audio through the backend to bypass IP locks.
+// Access requires a token from GetYouTubeStream.
 func ProxyYouTubeStream(c *gin.Context) {
 	videoID := c.Param("videoId")
-	if videoID == "" {
+	if !services.ValidYouTubeID(videoID) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	info, err := services.GetYouTubeAudioURL(videoID)
+	uid, err := services.VerifyStreamToken(c.Query("token"), videoID)
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
-
-	audioURL := services.GetBestAudioURL(info)
-	if audioURL == "" {
-		c.AbortWithStatus(http.StatusNotFound)
+		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
 
-	req, err := http.NewRequestWithContext(c.Request.Context(), "GET", audioURL, nil)
+	release, err := services.AcquireStream(uid)
 	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+		c.Header("Retry-After", "5")
+		c.AbortWithStatus(http.StatusTooManyRequests)
 		return
 	}
+	defer release()
 
-	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
-		req.Header.Set("Range", rangeHeader)
+	// Served from the local audio cache once a full play has gone through
+	if cached, ok := services.OpenCachedAudio("youtube", videoID); ok {
+		defer cached.Close()
+		c.Header("Content-Type", cached.ContentType)
+		c.Header("ETag", cached.ETag)
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, cached.File)
+		return
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.AbortWithStatus(http.StatusBadGateway)
+	resp, status := openYouTubeUpstream(c, videoID)
+	if resp == nil {
+		c.AbortWithStatus(status)
 		return
 	}
 	defer resp.Body.Close()
 
-	for k, v := range resp.Header {
-		c.Header(k, v[0])
+	for _, h := range proxyHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			c.Header(h, v)
+		}
 	}
+	c.Header("Cache-Control", "private, no-store")
 	c.Status(resp.StatusCode)
 
-	_, err = io.Copy(c.Writer, resp.Body)
-	if err != nil {
-		return
+	// Tee complete bodies into the cache; partial ranges are only proxied
+	var body io.Writer = c.Writer
+	var cacheWriter *services.AudioCacheWriter
+	if size, full := services.FullResponseSize(resp); full {
+		cacheWriter = services.NewAudioCacheWriter("youtube", videoID, resp.Header.Get("Content-Type"), size)
+		if cacheWriter != nil {
+			body = io.MultiWriter(c.Writer, cacheWriter)
+		}
+	}
+
+	_, err = io.Copy(body, resp.Body)
+	if cacheWriter != nil {
+		if err != nil {
+			cacheWriter.Abort()
+		} else if commitErr := cacheWriter.Commit(); commitErr != nil {
+			slog.Warn("audio not cached", "videoId", videoID, "err", commitErr)
+		}
+	}
+}
+
+// openYouTubeUpstream requests the audio from googlevideo, forwarding the
+// client's Range. Stream URLs expire and are IP-bound, so a 403/410 drops the
+// cached URL and retries once with a freshly resolved one. On failure it
+// returns a nil response and the status to answer with.
+func openYouTubeUpstream(c *gin.Context, videoID string) (*http.Response, int) {
+	ctx := c.Request.Context()
+	for attempt := 0; attempt < 2; attempt++ {
+		info, err := services.GetYouTubeAudioURL(ctx, videoID)
+		if err != nil {
+			if errors.Is(err, services.ErrExtractorBusy) {
+				c.Header("Retry-After", "2")
+				return nil, http.StatusServiceUnavailable
+			}
+			return nil, http.StatusNotFound
+		}
+		audioURL := services.GetBestAudioURL(info)
+		if audioURL == "" {
+			return nil, http.StatusNotFound
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", audioURL, nil)
+		if err != nil {
+			return nil, http.StatusInternalServerError
+		}
+		if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		resp, err := proxyClient.Do(req)
+		if err != nil {
+			return nil, http.StatusBadGateway
+		}
+		if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusGone {
+			return resp, resp.StatusCode
+		}
+		resp.Body.Close()
+		slog.Info("upstream rejected stream URL, refreshing", "videoId", videoID, "status", resp.StatusCode)
+		services.InvalidateYouTubeAudioURL(videoID)
 	}
+	return nil, http.StatusBadGateway
 }
 
 // DiscoverSimilar gets similar tracks based on artist, title, or genre
@@ -312,16 +585,17 @@ func DiscoverSimilar(c *gin.Context) {
 		query = "trending hits"
 	}
 
-	tracks, err := services.SearchYouTubeMusic(query, limit)
+	tracks, err := services.SearchYouTubeMusic(c.Request.Context(), query, limit)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Failed to get similar tracks")
+		extractorError(c, "Failed to get similar tracks", err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, tracks)
 }
 
-// DiscoverFeed gets personalized recommendations based on recently played
+// DiscoverFeed gets personalized recommendations based on recently played,
+// along with songs recently added to playlists the user follows
 func DiscoverFeed(c *gin.Context) {
 	uid, exists := c.Get("uid")
 	if !exists {
@@ -330,8 +604,8 @@ func DiscoverFeed(c *gin.Context) {
 	}
 
 	user, err := services.GetUser(c.Request.Context(), uid.(string))
-	query := "recommended trending music 2026"
-	
+	query := ""
+
 	if err == nil && len(user.RecentlyPlayed) > 0 {
 		// Pick the most recently played song to base the feed on
 		lastPlayedID := user.RecentlyPlayed[len(user.RecentlyPlayed)-1]
@@ -348,11 +622,121 @@ func DiscoverFeed(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "20")
 	limit, _ := strconv.Atoi(limitStr)
 
-	tracks, err := services.SearchYouTubeMusic(query, limit)
+	// Without listening history, fall back to what's trending in the user's region
+	var tracks []services.PipedTrack
+	if query != "" {
+		tracks, err = services.SearchYouTubeMusic(c.Request.Context(), query, limit)
+	} else {
+		tracks, err = services.GetYouTubeTrending(c.Request.Context(), requestRegion(c), limit)
+	}
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Failed to get personal feed")
+		extractorError(c, "Failed to get personal feed", err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, tracks)
+	// Songs others added to the playlists the user follows
+	updates := []models.PlaylistUpdate{}
+	if user != nil {
+		if u, err := services.GetPlaylistUpdates(c.Request.Context(), user, limit); err != nil {
+			slog.Warn("failed to get playlist updates", "user", user.UID, "err", err)
+		} else {
+			updates = u
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"tracks": tracks, "playlistUpdates": updates})
+}
+
+// ResolveExternalTrack maps a metadata-only track (Spotify, Deezer,
+// MusicBrainz) to a playable source. Spotify and Deezer tracks can be given by
+// sourceId alone; others need at least a title.
+func ResolveExternalTrack(c *gin.Context) {
+	var req models.ResolveTrackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	ext := models.ExternalTrack{
+		Source:   req.Source,
+		SourceID: req.SourceID,
+		Title:    req.Title,
+		Artist:   req.Artist,
+		Album:    req.Album,
+		Duration: req.Duration,
+		ISRC:     req.ISRC,
+	}
+	if ext.Title == "" {
+		if req.SourceID == "" {
+			utils.ErrorResponse(c, http.StatusBadRequest, "title or sourceId required")
+			return
+		}
+		looked, err := services.LookupExternalTrack(req.Source, req.SourceID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusNotFound, "Track not found: "+err.Error())
+			return
+		}
+		ext = *looked
+	}
+
+	if !req.Refresh {
+		if mapping, ok := services.GetResolvedTrack(c.Request.Context(), ext); ok {
+			utils.SuccessResponse(c, http.StatusOK, mapping)
+			return
+		}
+	}
+
+	mapping, err := services.ResolveTrack(c.Request.Context(), ext)
+	if err != nil {
+		if errors.Is(err, services.ErrNoMatch) {
+			utils.ErrorResponse(c, http.StatusNotFound, "No playable source found")
+			return
+		}
+		extractorError(c, "Failed to resolve track", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, mapping)
+}
+
+// requestRegion picks the market for discovery: an explicit ?region=, the
+// country on the user's profile, CDN geo headers, then Accept-Language
+func requestRegion(c *gin.Context) string {
+	if region := services.NormalizeRegion(c.Query("region")); region != "" {
+		return region
+	}
+	if uid := c.GetString("uid"); uid != "" {
+		if user, err := services.GetUser(c.Request.Context(), uid); err == nil {
+			if region := services.NormalizeRegion(user.Country); region != "" {
+				return region
+			}
+		}
+	}
+	for _, h := range []string{"CF-IPCountry", "X-Vercel-IP-Country", "CloudFront-Viewer-Country", "X-Country-Code"} {
+		if region := services.NormalizeRegion(c.GetHeader(h)); region != "" {
+			return region
+		}
+	}
+	if region := services.RegionFromAcceptLanguage(c.GetHeader("Accept-Language")); region != "" {
+		return region
+	}
+	return services.DefaultRegion()
+}
+
+// extractorError responds 503, asking the client to back off when the
+// extractor pool is saturated rather than broken
+func extractorError(c *gin.Context, message string, err error) {
+	if errors.Is(err, services.ErrExtractorBusy) {
+		c.Header("Retry-After", "2")
+	}
+	utils.ErrorResponse(c, http.StatusServiceUnavailable, message)
+}
+
+// requestBaseURL returns the scheme and host the client used to reach the API
+func requestBaseURL(c *gin.Context) string {
+	protocol := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		protocol = "https"
+	}
+	return protocol + "://" + c.Request.Host
 }
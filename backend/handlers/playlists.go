@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"spotify-clone/models"
@@ -11,7 +18,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GetPlaylists returns the authenticated user's playlists
+// GetPlaylists returns the authenticated user's playlists, then the ones
+// shared with them
 func GetPlaylists(c *gin.Context) {
 	uid := c.GetString("uid")
 
@@ -20,14 +28,48 @@ func GetPlaylists(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch playlists")
 		return
 	}
+	shared, err := services.GetSharedPlaylists(c.Request.Context(), uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch playlists")
+		return
+	}
+	playlists = append(playlists, shared...)
 
 	if playlists == nil {
 		playlists = []models.Playlist{}
 	}
+	for i := range playlists {
+		services.HidePlaylistMembers(&playlists[i], uid)
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, playlists)
 }
 
+// GetSavedPlaylists returns the playlists the user follows
+func GetSavedPlaylists(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	user, err := services.GetUser(c.Request.Context(), uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "User not found")
+		return
+	}
+	saved, err := services.GetSavedPlaylists(c.Request.Context(), user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch saved playlists")
+		return
+	}
+
+	if saved == nil {
+		saved = []models.Playlist{}
+	}
+	for i := range saved {
+		services.HidePlaylistMembers(&saved[i], uid)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, saved)
+}
+
 // GetPlaylist returns a single playlist by ID
 func GetPlaylist(c *gin.Context) {
 	uid := c.GetString("uid")
@@ -39,25 +81,42 @@ func GetPlaylist(c *gin.Context) {
 		return
 	}
 
-	// Enforce privacy: user must be owner or playlist must be public
-	if !playlist.IsPublic && playlist.UserID != uid {
+	// Enforce privacy: private playlists are for their owner and members
+	if !services.CanReadPlaylist(playlist, uid) {
 		utils.ErrorResponse(c, http.StatusForbidden, "This playlist is private")
 		return
 	}
 
-	// Fetch song details for each song in playlist
-	var songs []interface{}
-	for _, songID := range playlist.SongIDs {
-		song, err := services.GetSong(c.Request.Context(), songID)
-		if err != nil {
-			continue
-		}
-		songs = append(songs, song)
+	// Songs deleted since they were added are left out
+	songs, _, err := services.GetSongsByIDs(c.Request.Context(), playlist.SongIDs)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch playlist songs")
+		return
+	}
+
+	// Profiles of the owner, members and everyone who added a song
+	uids := append([]string{playlist.UserID}, playlist.MemberIDs...)
+	for _, item := range playlist.Items {
+		uids = append(uids, item.AddedBy)
+	}
+	contributors, err := services.GetUserSummaries(c.Request.Context(), uids)
+	if err != nil {
+		contributors = map[string]models.UserSummary{}
 	}
 
+	following := false
+	if user, err := services.GetUser(c.Request.Context(), uid); err == nil {
+		following = slices.Contains(user.SavedPlaylists, id)
+	}
+
+	role := services.PlaylistRole(playlist, uid)
+	services.HidePlaylistMembers(playlist, uid)
 	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"playlist": playlist,
-		"songs":    songs,
+		"playlist":     playlist,
+		"songs":        songs,
+		"role":         role,
+		"contributors": contributors,
+		"following":    following,
 	})
 }
 
@@ -76,63 +135,55 @@ func CreatePlaylist(c *gin.Context) {
 		UserID:    uid,
 		IsPublic:  req.IsPublic,
 		SongIDs:   []string{},
+		Items:     []models.PlaylistItem{},
 		CreatedAt: time.Now(),
 	}
 
-	id, err := services.CreatePlaylist(c.Request.Context(), playlist)
+	created, err := services.CreatePlaylist(c.Request.Context(), playlist)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create playlist")
 		return
 	}
 
-	playlist.ID = id
-	utils.SuccessResponse(c, http.StatusCreated, playlist)
+	utils.SuccessResponse(c, http.StatusCreated, created)
 }
 
-// UpdatePlaylist updates a playlist (name, public status, or songs)
+// UpdatePlaylist updates a playlist (name, public status, or songs).
+// Collaborators can only change the songs.
 func UpdatePlaylist(c *gin.Context) {
-	uid := c.GetString("uid")
 	id := c.Param("id")
 
-	// Verify ownership
-	playlist, err := services.GetPlaylist(c.Request.Context(), id)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
-		return
-	}
-	if playlist.UserID != uid {
-		utils.ErrorResponse(c, http.StatusForbidden, "You can only edit your own playlists")
-		return
-	}
-
 	var req models.UpdatePlaylistRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	updates := make(map[string]interface{})
-	if req.Name != "" {
-		updates["name"] = utils.SanitizeString(req.Name)
-	}
-	if req.IsPublic != nil {
-		updates["isPublic"] = *req.IsPublic
-	}
-	if req.SongIDs != nil {
-		updates["songIds"] = req.SongIDs
+	name := utils.SanitizeString(req.Name)
+	if name == "" && req.IsPublic == nil && req.SongIDs == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "No fields to update")
+		return
 	}
 
-	if len(updates) == 0 {
-		utils.ErrorResponse(c, http.StatusBadRequest, "No fields to update")
+	var playlist *models.Playlist
+	var ok bool
+	if name != "" || req.IsPublic != nil {
+		playlist, ok = ownPlaylist(c, id)
+	} else {
+		playlist, ok = editablePlaylist(c, id)
+	}
+	if !ok {
 		return
 	}
 
-	if err := services.UpdatePlaylist(c.Request.Context(), id, updates); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update playlist")
+	playlist, err := services.EditPlaylist(c.Request.Context(), id, playlistEdit(c, req.SnapshotID), name, req.IsPublic, req.SongIDs)
+	if err != nil {
+		playlistItemsError(c, err, "Failed to update playlist")
 		return
 	}
 
-	utils.SuccessMessage(c, "Playlist updated")
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
 }
 
 // DeletePlaylist deletes a playlist
@@ -159,80 +210,633 @@ func DeletePlaylist(c *gin.Context) {
 	utils.SuccessMessage(c, "Playlist deleted")
 }
 
-// AddSongToPlaylist adds a song to a playlist
+// playlistEdit describes the request's change to a playlist. It's based on
+// the snapshot from the request body or, failing that, the If-Match header.
+func playlistEdit(c *gin.Context, snapshotID string) services.PlaylistEdit {
+	if snapshotID == "" {
+		snapshotID = strings.Trim(c.GetHeader("If-Match"), `"`)
+	}
+	return services.PlaylistEdit{By: c.GetString("uid"), IfSnapshot: snapshotID}
+}
+
+// ownPlaylist loads a playlist and checks the user owns it, writing the
+// error response if not
+func ownPlaylist(c *gin.Context, id string) (*models.Playlist, bool) {
+	playlist, err := services.GetPlaylist(c.Request.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
+		return nil, false
+	}
+	if playlist.UserID != c.GetString("uid") {
+		utils.ErrorResponse(c, http.StatusForbidden, "You can only edit your own playlists")
+		return nil, false
+	}
+	return playlist, true
+}
+
+// editablePlaylist loads a playlist whose songs the user can change, as its
+// owner or a collaborator, writing the error response if not
+func editablePlaylist(c *gin.Context, id string) (*models.Playlist, bool) {
+	playlist, err := services.GetPlaylist(c.Request.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
+		return nil, false
+	}
+	if !services.CanEditPlaylistItems(playlist, c.GetString("uid")) {
+		utils.ErrorResponse(c, http.StatusForbidden, "You can only edit your own or shared playlists")
+		return nil, false
+	}
+	return playlist, true
+}
+
+// playlistItemsError writes the response for a failed playlist item change
+func playlistItemsError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, services.ErrDuplicatePlaylistSong):
+		utils.ErrorResponse(c, http.StatusConflict, "Song already in playlist")
+	case errors.Is(err, services.ErrStaleSnapshot):
+		utils.ErrorResponse(c, http.StatusPreconditionFailed, "Playlist has changed since you loaded it; reload and try again")
+	case errors.Is(err, services.ErrPlaylistForbidden):
+		utils.ErrorResponse(c, http.StatusForbidden, "You can no longer make this change to the playlist")
+	case errors.Is(err, services.ErrPlaylistItemNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Playlist item not found")
+	case errors.Is(err, services.ErrInvalidPosition), errors.Is(err, services.ErrPlaylistFull):
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, msg)
+	}
+}
+
+// AddSongToPlaylist inserts one song (songId) or several (songIds) at a
+// position, at the end by default. Songs already in the playlist are
+// rejected unless allowDuplicates is set.
 func AddSongToPlaylist(c *gin.Context) {
-	uid := c.GetString("uid")
 	playlistID := c.Param("id")
 
-	var req struct {
-		SongID string `json:"songId" binding:"required"`
-	}
+	var req models.AddPlaylistItemsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	songIDs := req.SongIDs
+	if req.SongID != "" {
+		songIDs = append([]string{req.SongID}, songIDs...)
+	}
+	if len(songIDs) == 0 || slices.Contains(songIDs, "") {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Song ID required")
 		return
 	}
+	position := -1
+	if req.Position != nil {
+		if *req.Position < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid position")
+			return
+		}
+		position = *req.Position
+	}
 
-	// Verify ownership
-	playlist, err := services.GetPlaylist(c.Request.Context(), playlistID)
+	if _, ok := editablePlaylist(c, playlistID); !ok {
+		return
+	}
+
+	playlist, err := services.InsertPlaylistSongs(c.Request.Context(), playlistID, playlistEdit(c, req.SnapshotID), songIDs, position, req.AllowDuplicates)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
+		playlistItemsError(c, err, "Failed to add song")
 		return
 	}
-	if playlist.UserID != uid {
-		utils.ErrorResponse(c, http.StatusForbidden, "You can only edit your own playlists")
+
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
+}
+
+// MovePlaylistItems moves a range of items to another position
+func MovePlaylistItems(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	var req models.MovePlaylistItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "rangeStart and insertBefore are required")
 		return
 	}
+	if req.RangeLength == 0 {
+		req.RangeLength = 1
+	}
 
-	// Check if song already in playlist
-	for _, id := range playlist.SongIDs {
-		if id == req.SongID {
-			utils.ErrorResponse(c, http.StatusConflict, "Song already in playlist")
-			return
-		}
+	if _, ok := editablePlaylist(c, playlistID); !ok {
+		return
 	}
 
-	newSongIDs := append(playlist.SongIDs, req.SongID)
-	if err := services.UpdatePlaylist(c.Request.Context(), playlistID, map[string]interface{}{
-		"songIds": newSongIDs,
-	}); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to add song")
+	playlist, err := services.MovePlaylistItems(c.Request.Context(), playlistID, playlistEdit(c, req.SnapshotID), *req.RangeStart, req.RangeLength, *req.InsertBefore)
+	if err != nil {
+		playlistItemsError(c, err, "Failed to move songs")
 		return
 	}
 
-	utils.SuccessMessage(c, "Song added to playlist")
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
 }
 
-// RemoveSongFromPlaylist removes a song from a playlist
+// RemovePlaylistItem removes one item, leaving other copies of its song
+func RemovePlaylistItem(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	if _, ok := editablePlaylist(c, playlistID); !ok {
+		return
+	}
+
+	playlist, err := services.RemovePlaylistItems(c.Request.Context(), playlistID, playlistEdit(c, ""), []string{c.Param("itemId")})
+	if err != nil {
+		playlistItemsError(c, err, "Failed to remove song")
+		return
+	}
+
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
+}
+
+// RemoveSongFromPlaylist removes every copy of a song from a playlist
 func RemoveSongFromPlaylist(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	if _, ok := editablePlaylist(c, playlistID); !ok {
+		return
+	}
+
+	playlist, err := services.RemovePlaylistSong(c.Request.Context(), playlistID, playlistEdit(c, ""), c.Param("songId"))
+	if err != nil {
+		playlistItemsError(c, err, "Failed to remove song")
+		return
+	}
+
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
+}
+
+// GetPlaylistHistory lists a playlist's snapshots, newest first
+func GetPlaylistHistory(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	if _, ok := editablePlaylist(c, playlistID); !ok {
+		return
+	}
+
+	limit, _, cursor := pageParams(c, 20, 100, "newest")
+	snapshots, next, err := services.GetPlaylistHistory(c.Request.Context(), playlistID, cursor, limit)
+	if err != nil {
+		listError(c, err, "Failed to fetch playlist history")
+		return
+	}
+
+	utils.PaginatedSuccess(c, snapshots, next, nil)
+}
+
+// GetPlaylistSnapshot returns one snapshot of a playlist with its items
+func GetPlaylistSnapshot(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	if _, ok := editablePlaylist(c, playlistID); !ok {
+		return
+	}
+
+	snap, err := services.GetPlaylistSnapshot(c.Request.Context(), playlistID, c.Param("snapshotId"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, snap)
+}
+
+// DiffPlaylist compares two snapshots of a playlist: ?from= and ?to=, which
+// defaults to the current one
+func DiffPlaylist(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	playlist, ok := editablePlaylist(c, playlistID)
+	if !ok {
+		return
+	}
+	fromID, toID := c.Query("from"), c.DefaultQuery("to", playlist.SnapshotID)
+	if fromID == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "from snapshot required")
+		return
+	}
+
+	from, err := services.GetPlaylistSnapshot(c.Request.Context(), playlistID, fromID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+	to, err := services.GetPlaylistSnapshot(c.Request.Context(), playlistID, toID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, services.DiffPlaylistSnapshots(from, to))
+}
+
+// RestorePlaylist sets a playlist back to an earlier snapshot. Restoring
+// can rename a playlist and change its visibility, so it's for the owner.
+func RestorePlaylist(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	var req models.RestorePlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Snapshot ID required")
+		return
+	}
+
+	if _, ok := ownPlaylist(c, playlistID); !ok {
+		return
+	}
+
+	snap, err := services.GetPlaylistSnapshot(c.Request.Context(), playlistID, req.SnapshotID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+
+	playlist, err := services.RestorePlaylist(c.Request.Context(), playlistID, playlistEdit(c, ""), snap)
+	if err != nil {
+		playlistItemsError(c, err, "Failed to restore playlist")
+		return
+	}
+
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
+}
+
+// inviteError writes the response for an invite that can't be used
+func inviteError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, services.ErrInviteNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Invite not found")
+	case errors.Is(err, services.ErrInviteExpired):
+		utils.ErrorResponse(c, http.StatusGone, "Invite has expired")
+	case errors.Is(err, services.ErrInvalidRole):
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, msg)
+	}
+}
+
+// UpdatePlaylistMember changes a member's role
+func UpdatePlaylistMember(c *gin.Context) {
+	playlistID := c.Param("id")
+	memberID := c.Param("uid")
+
+	var req models.UpdatePlaylistMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Role required")
+		return
+	}
+
+	playlist, ok := ownPlaylist(c, playlistID)
+	if !ok {
+		return
+	}
+	if _, isMember := playlist.Members[memberID]; !isMember {
+		utils.ErrorResponse(c, http.StatusNotFound, "Member not found")
+		return
+	}
+
+	if err := services.SetPlaylistMember(c.Request.Context(), playlistID, memberID, req.Role); err != nil {
+		inviteError(c, err, "Failed to update member")
+		return
+	}
+
+	utils.SuccessMessage(c, "Member updated")
+}
+
+// RemovePlaylistMember removes a member from a playlist. The owner can
+// remove anyone; members can remove themselves to leave.
+func RemovePlaylistMember(c *gin.Context) {
 	uid := c.GetString("uid")
 	playlistID := c.Param("id")
-	songID := c.Param("songId")
+	memberID := c.Param("uid")
 
-	// Verify ownership
 	playlist, err := services.GetPlaylist(c.Request.Context(), playlistID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
 		return
 	}
-	if playlist.UserID != uid {
-		utils.ErrorResponse(c, http.StatusForbidden, "You can only edit your own playlists")
+	if playlist.UserID != uid && memberID != uid {
+		utils.ErrorResponse(c, http.StatusForbidden, "Only the owner can remove other members")
+		return
+	}
+	if _, isMember := playlist.Members[memberID]; !isMember {
+		utils.ErrorResponse(c, http.StatusNotFound, "Member not found")
+		return
+	}
+
+	if err := services.RemovePlaylistMember(c.Request.Context(), playlistID, memberID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+
+	utils.SuccessMessage(c, "Member removed")
+}
+
+// CreatePlaylistInvite makes an invite link for a playlist. The token goes
+// in the link; whoever opens it and signs in joins with the invite's role.
+func CreatePlaylistInvite(c *gin.Context) {
+	uid := c.GetString("uid")
+	playlistID := c.Param("id")
+
+	var req models.CreatePlaylistInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if _, ok := ownPlaylist(c, playlistID); !ok {
+		return
+	}
+
+	invite, err := services.CreatePlaylistInvite(c.Request.Context(), playlistID, uid, req.Role, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		inviteError(c, err, "Failed to create invite")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, invite)
+}
+
+// GetPlaylistInvites returns a page of a playlist's invites, newest first
+func GetPlaylistInvites(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	if _, ok := ownPlaylist(c, playlistID); !ok {
+		return
+	}
+
+	limit, _, cursor := pageParams(c, 20, 50, "newest")
+	invites, next, err := services.GetPlaylistInvites(c.Request.Context(), playlistID, cursor, limit)
+	if err != nil {
+		listError(c, err, "Failed to fetch invites")
+		return
+	}
+
+	utils.PaginatedSuccess(c, invites, next, nil)
+}
+
+// RevokePlaylistInvite revokes an invite link. Members who already joined
+// through it stay.
+func RevokePlaylistInvite(c *gin.Context) {
+	playlistID := c.Param("id")
+
+	if _, ok := ownPlaylist(c, playlistID); !ok {
+		return
+	}
+
+	if err := services.RevokePlaylistInvite(c.Request.Context(), playlistID, c.Param("token")); err != nil {
+		inviteError(c, err, "Failed to revoke invite")
+		return
+	}
+
+	utils.SuccessMessage(c, "Invite revoked")
+}
+
+// GetPlaylistInvite shows what an invite link is for before accepting it
+func GetPlaylistInvite(c *gin.Context) {
+	invite, err := services.GetPlaylistInvite(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		inviteError(c, err, "Failed to fetch invite")
+		return
+	}
+	playlist, err := services.GetPlaylist(c.Request.Context(), invite.PlaylistID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Invite not found")
+		return
+	}
+	owner := models.UserSummary{UID: playlist.UserID}
+	if users, err := services.GetUserSummaries(c.Request.Context(), []string{playlist.UserID}); err == nil {
+		if u, ok := users[playlist.UserID]; ok {
+			owner = u
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"role":       invite.Role,
+		"expiresAt":  invite.ExpiresAt,
+		"playlistId": playlist.ID,
+		"name":       playlist.Name,
+		"coverURL":   playlist.CoverURL,
+		"songCount":  len(playlist.Items),
+		"owner":      owner,
+	})
+}
+
+// AcceptPlaylistInvite adds the user to the invite's playlist
+func AcceptPlaylistInvite(c *gin.Context) {
+	playlist, err := services.AcceptPlaylistInvite(c.Request.Context(), c.Param("token"), c.GetString("uid"))
+	if err != nil {
+		inviteError(c, err, "Failed to accept invite")
+		return
+	}
+
+	services.HidePlaylistMembers(playlist, c.GetString("uid"))
+	utils.SuccessResponse(c, http.StatusOK, playlist)
+}
+
+// FollowPlaylist saves someone else's playlist to the user's library
+func FollowPlaylist(c *gin.Context) {
+	uid := c.GetString("uid")
+	id := c.Param("id")
+
+	playlist, err := services.GetPlaylist(c.Request.Context(), id)
+	if err != nil || !services.CanReadPlaylist(playlist, uid) {
+		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
+		return
+	}
+	if playlist.UserID == uid {
+		utils.ErrorResponse(c, http.StatusBadRequest, "You can't follow your own playlist")
 		return
 	}
 
-	// Remove song
-	newSongIDs := make([]string, 0)
-	for _, id := range playlist.SongIDs {
-		if id != songID {
-			newSongIDs = append(newSongIDs, id)
+	if err := services.FollowPlaylist(c.Request.Context(), uid, id); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to follow playlist")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"status": "followed", "playlistId": id})
+}
+
+// UnfollowPlaylist removes a playlist from the user's library. It works for
+// playlists that were deleted or made private since.
+func UnfollowPlaylist(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := services.UnfollowPlaylist(c.Request.Context(), c.GetString("uid"), id); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to unfollow playlist")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"status": "unfollowed", "playlistId": id})
+}
+
+// ImportPlaylist starts importing a Spotify, Deezer or YouTube playlist by URL.
+// The import runs in the background; poll GetImportJob for progress.
+func ImportPlaylist(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var req models.ImportPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Playlist URL is required")
+		return
+	}
+	req.Name = utils.SanitizeString(req.Name)
+
+	job, err := services.StartPlaylistImport(c.Request.Context(), uid, req)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedPlaylistURL) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Unsupported playlist URL (Spotify, Deezer and YouTube playlists are supported)")
+			return
 		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start import")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, job)
+}
+
+// ImportPlaylistFile imports an uploaded M3U8, XSPF or JSPF playlist. Entries
+// are matched against the catalog and providers in a background job, like an
+// import by URL.
+func ImportPlaylistFile(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	if err := c.Request.ParseMultipartForm(2 << 20); err != nil { // 2MB max
+		utils.ErrorResponse(c, http.StatusBadRequest, "File too large")
+		return
+	}
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Playlist file required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, 2<<20))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to read playlist file")
+		return
+	}
+
+	// Format from the form, then the extension; otherwise detected from content
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		if _, ok := services.PlaylistFileFormats[format]; !ok && format != "m3u" {
+			format = ""
+		}
+	}
+
+	title, entries, err := services.DecodePlaylistFile(format, data)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownPlaylistFormat) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Unsupported format (m3u8, xspf and jspf are supported)")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Playlist file has no tracks")
+		return
+	}
+
+	name := utils.SanitizeString(c.PostForm("name"))
+	if name == "" {
+		name = utils.SanitizeString(title)
 	}
+	isPublic, _ := strconv.ParseBool(c.PostForm("isPublic"))
 
-	if err := services.UpdatePlaylist(c.Request.Context(), playlistID, map[string]interface{}{
-		"songIds": newSongIDs,
-	}); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to remove song")
+	job, err := services.StartPlaylistFileImport(c.Request.Context(), uid, name, isPublic, entries)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start import")
 		return
 	}
 
-	utils.SuccessMessage(c, "Song removed from playlist")
+	utils.SuccessResponse(c, http.StatusAccepted, job)
+}
+
+var unsafeFilenameRe = regexp.MustCompile(`[^A-Za-z0-9._ -]+`)
+
+// ExportPlaylist downloads a playlist as M3U8, XSPF or JSPF
+func ExportPlaylist(c *gin.Context) {
+	uid := c.GetString("uid")
+	id := c.Param("id")
+
+	format := strings.ToLower(c.DefaultQuery("format", "m3u8"))
+	meta, ok := services.PlaylistFileFormats[format]
+	if !ok {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Unsupported format (m3u8, xspf and jspf are supported)")
+		return
+	}
+
+	playlist, err := services.GetPlaylist(c.Request.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Playlist not found")
+		return
+	}
+	if !services.CanReadPlaylist(playlist, uid) {
+		utils.ErrorResponse(c, http.StatusForbidden, "This playlist is private")
+		return
+	}
+
+	songs, _, err := services.GetSongsByIDs(c.Request.Context(), playlist.SongIDs)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch playlist songs")
+		return
+	}
+
+	entries := services.PlaylistFileEntries(songs, requestBaseURL(c))
+	data, err := services.EncodePlaylistFile(format, playlist.Name, entries)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to export playlist")
+		return
+	}
+
+	filename := strings.TrimSpace(unsafeFilenameRe.ReplaceAllString(playlist.Name, ""))
+	if filename == "" {
+		filename = "playlist"
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+filename+meta[1]+`"`)
+	c.Data(http.StatusOK, meta[0], data)
+}
+
+// GetImportJob returns the progress and per-track results of an import
+func GetImportJob(c *gin.Context) {
+	job, ok := ownImportJob(c)
+	if !ok {
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, job)
+}
+
+// ResumeImportJob continues an interrupted import and retries failed tracks
+func ResumeImportJob(c *gin.Context) {
+	job, ok := ownImportJob(c)
+	if !ok {
+		return
+	}
+	resumed, err := services.ResumePlaylistImport(c.Request.Context(), job.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resume import")
+		return
+	}
+	utils.SuccessResponse(c, http.StatusAccepted, resumed)
+}
+
+// ownImportJob loads the :jobId import, responding with an error unless it
+// belongs to the authenticated user
+func ownImportJob(c *gin.Context) (*models.ImportJob, bool) {
+	job, err := services.GetImportJob(c.Request.Context(), c.Param("jobId"))
+	if err != nil || job.UserID != c.GetString("uid") {
+		utils.ErrorResponse(c, http.StatusNotFound, "Import job not found")
+		return nil, false
+	}
+	return job, true
 }
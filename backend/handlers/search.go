@@ -1,16 +1,28 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
+	"spotify-clone/models"
 	"spotify-clone/services"
 	"spotify-clone/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Search performs a global search across songs and artists
+// searchTypes are the result types Search can return, in response order
+var searchTypes = []string{"songs", "artists", "albums", "playlists", "users"}
+
+// Search performs a global search across songs, artists, albums, playlists
+// and user profiles. ?type= restricts it to some of them (comma separated),
+// and each type is paged on its own with ?cursor[songs]=<nextCursor>, or
+// ?cursor= when a single type is requested. Songs can be filtered like
+// GetSongs and come with facet counts. Private playlists only show up for
+// their owner.
 func Search(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
@@ -24,21 +36,121 @@ func Search(c *gin.Context) {
 		limit = 10
 	}
 
-	// Search songs
-	songs, err := services.SearchSongs(c.Request.Context(), query, limit)
-	if err != nil {
-		songs = nil
+	types := searchTypes
+	if t := c.Query("type"); t != "" {
+		types = nil
+		for _, name := range strings.Split(t, ",") {
+			name = strings.TrimSpace(name)
+			if !strings.HasSuffix(name, "s") {
+				name += "s" // accept "song" as well as "songs"
+			}
+			if !slices.Contains(searchTypes, name) {
+				utils.ErrorResponse(c, http.StatusBadRequest, "Unknown search type: "+name)
+				return
+			}
+			types = append(types, name)
+		}
+	}
+
+	filter, ok := songFilterFromQuery(c)
+	if !ok {
+		return
 	}
 
-	// Search artists
-	artists, err := services.SearchArtists(c.Request.Context(), query, limit)
-	if err != nil {
-		artists = nil
+	cursors := c.QueryMap("cursor")
+	ctx := c.Request.Context()
+	uid := c.GetString("uid")
+	result := gin.H{"query": query}
+	found := false
+
+	for _, t := range types {
+		cursor := cursors[t]
+		if len(types) == 1 && cursor == "" {
+			cursor = c.Query("cursor")
+		}
+		cur, err := utils.DecodeCursor(cursor, "relevance")
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid cursor for "+t)
+			return
+		}
+		offset := cur.Offset
+
+		var items interface{}
+		var total, n int
+		switch t {
+		case "songs":
+			var songs []models.Song
+			var facets services.FacetCounts
+			songs, total, facets, err = services.SearchSongsFiltered(ctx, query, filter, offset, limit)
+			if songs == nil {
+				songs = []models.Song{}
+			}
+			if facets == nil {
+				facets = services.FacetCounts{}
+			}
+			items, n = songs, len(songs)
+			result["facets"] = facets
+		case "artists":
+			var artists []models.Artist
+			artists, total, err = services.SearchArtistsPage(ctx, query, offset, limit)
+			if artists == nil {
+				artists = []models.Artist{}
+			}
+			items, n = artists, len(artists)
+		case "albums":
+			var albums []models.Album
+			albums, total, err = services.SearchAlbums(ctx, query, offset, limit)
+			if albums == nil {
+				albums = []models.Album{}
+			}
+			items, n = albums, len(albums)
+		case "playlists":
+			var playlists []models.Playlist
+			playlists, total, err = services.SearchPlaylists(ctx, query, uid, offset, limit)
+			if playlists == nil {
+				playlists = []models.Playlist{}
+			}
+			items, n = playlists, len(playlists)
+		case "users":
+			var users []models.UserSummary
+			users, total, err = services.SearchUsers(ctx, query, offset, limit)
+			if users == nil {
+				users = []models.UserSummary{}
+			}
+			items, n = users, len(users)
+		}
+		if err != nil {
+			slog.Warn("search failed", "type", t, "query", query, "err", err)
+			listError(c, err, "Failed to search "+t)
+			return
+		}
+
+		found = found || total > 0
+		next := ""
+		if n > 0 && offset+n < total {
+			next = utils.EncodeCursor(utils.Cursor{Sort: "relevance", Offset: offset + n})
+		}
+		result[t] = utils.PaginatedResponse{
+			Items:      items,
+			NextCursor: next,
+			TotalCount: utils.Count(total),
+		}
+	}
+
+	if found {
+		services.RecordSearchQuery(query, uid)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, result)
+}
+
+// SearchSuggest returns autocomplete suggestions for a partial query
+func SearchSuggest(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "8"))
+	if limit <= 0 || limit > 20 {
+		limit = 8
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, gin.H{
-		"songs":   songs,
-		"artists": artists,
-		"query":   query,
-	})
+	suggestions := services.SuggestSearch(c.Query("q"), c.GetString("uid"), limit)
+	utils.SuccessResponse(c, http.StatusOK, suggestions)
 }
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"spotify-clone/models"
@@ -12,27 +14,54 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GetSongs returns a paginated list of approved songs
-func GetSongs(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "20")
-	genre := c.Query("genre")
+// songFilterFromQuery reads genre, source, minDuration, maxDuration,
+// yearFrom, yearTo, explicit and license from the query string
+func songFilterFromQuery(c *gin.Context) (models.SongFilter, bool) {
+	var filter models.SongFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid filter: "+err.Error())
+		return filter, false
+	}
+	return filter, true
+}
 
-	limit, _ := strconv.Atoi(limitStr)
-	if limit <= 0 || limit > 50 {
-		limit = 20
+// pageParams reads ?limit=, ?sort= and ?cursor= for a list endpoint
+func pageParams(c *gin.Context, defaultLimit, maxLimit int, defaultSort string) (int, string, string) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if limit <= 0 || limit > maxLimit {
+		limit = defaultLimit
 	}
+	return limit, c.DefaultQuery("sort", defaultSort), c.Query("cursor")
+}
 
-	songs, err := services.GetSongs(c.Request.Context(), limit, genre, "approved")
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch songs")
+// listError reports a failed list query, blaming the request for a bad
+// sort or cursor
+func listError(c *gin.Context, err error, msg string) {
+	if errors.Is(err, services.ErrInvalidSort) || errors.Is(err, utils.ErrInvalidCursor) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sort or cursor")
 		return
 	}
+	utils.ErrorResponse(c, http.StatusInternalServerError, msg)
+}
+
+// GetSongs returns a page of approved songs, optionally filtered, sorted by
+// newest, oldest, popular or title
+func GetSongs(c *gin.Context) {
+	limit, sort, cursor := pageParams(c, 20, 50, "newest")
 
-	if songs == nil {
-		songs = []models.Song{}
+	filter, ok := songFilterFromQuery(c)
+	if !ok {
+		return
+	}
+	filter.Status = "approved"
+
+	songs, next, total, err := services.GetSongs(c.Request.Context(), filter, sort, cursor, limit)
+	if err != nil {
+		listError(c, err, "Failed to fetch songs")
+		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, songs)
+	utils.PaginatedSuccess(c, songs, next, total)
 }
 
 // GetSong returns a single song by ID
@@ -48,6 +77,30 @@ func GetSong(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, song)
 }
 
+// GetSongsBatch returns songs in the order of the requested IDs, plus the
+// IDs that weren't found, so clients can hydrate a queue in one call
+func GetSongsBatch(c *gin.Context) {
+	var req models.BatchSongsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ids must be a list of at most 500 song IDs")
+		return
+	}
+
+	songs, missing, err := services.GetSongsByIDs(c.Request.Context(), req.IDs)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch songs")
+		return
+	}
+	if missing == nil {
+		missing = []string{}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{
+		"songs":   songs,
+		"missing": missing,
+	})
+}
+
 // StreamSong returns the audio URL for streaming
 func StreamSong(c *gin.Context) {
 	id := c.Param("id")
@@ -89,7 +142,7 @@ func RecordPlay(c *gin.Context) {
 	}
 	if err := c.ShouldBindJSON(&req); err == nil && req.ID != "" {
 		// If it's an external song, ensure it's cached in our Firestore songs collection for History queries
-		if req.Source == "jamendo" || req.Source == "youtube" || req.Source == "fma" {
+		if req.Source == "jamendo" || req.Source == "youtube" || req.Source == "fma" || req.Source == "deezer" {
 			// GetSong will return an error if it doesn't exist yet
 			if _, getErr := services.GetSong(c.Request.Context(), songID); getErr != nil {
 				// Stub created dynamically
@@ -105,8 +158,28 @@ func RecordPlay(c *gin.Context) {
 					PlayCount:  0,
 				}
 				
+				if req.Source == "jamendo" {
+					// Keep Jamendo's license and musicinfo tags with the song
+					if track, err := services.GetJamendoTrack(strings.TrimPrefix(songID, "jam-")); err == nil {
+						frontendSong = services.JamendoSong(*track)
+						frontendSong.ID = req.ID
+					}
+				}
+				if req.Source == "youtube" {
+					// Raw YouTube titles carry the artist, "(Official Video)" and similar noise
+					meta := services.ParseYouTubeTitle(req.Title, req.ArtistName)
+					frontendSong.Title = meta.Title
+					if meta.Artist != "" {
+						frontendSong.ArtistName = meta.Artist
+					}
+					frontendSong.FeaturedArtists = meta.Featured
+					frontendSong.Version = meta.Version
+				}
+
 				// Fix the ID in Firestore manually to match the frontend passed ID (important for yt-dlp compatibility)
-				services.CreateSongWithID(c.Request.Context(), songID, frontendSong)
+				if err := services.CreateSongWithID(c.Request.Context(), songID, frontendSong); err == nil {
+					services.EnqueueEnrichment(songID)
+				}
 			}
 		}
 	}
@@ -140,21 +213,16 @@ func RecordPlay(c *gin.Context) {
 	utils.SuccessMessage(c, "Play recorded")
 }
 
-// GetRecommendations returns personalized song recommendations
+// GetRecommendations returns a page of personalized song recommendations
 func GetRecommendations(c *gin.Context) {
 	uid := c.GetString("uid")
-	limitStr := c.DefaultQuery("limit", "20")
-
-	limit, _ := strconv.Atoi(limitStr)
-	if limit <= 0 || limit > 50 {
-		limit = 20
-	}
+	limit, _, cursor := pageParams(c, 20, 50, "recommended")
 
-	songs, err := services.GetRecommendations(c.Request.Context(), uid, limit)
+	songs, next, total, err := services.GetRecommendations(c.Request.Context(), uid, cursor, limit)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get recommendations")
+		listError(c, err, "Failed to get recommendations")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, songs)
+	utils.PaginatedSuccess(c, songs, next, utils.Count(total))
 }
@@ -52,6 +52,7 @@ func UploadSong(c *gin.Context) {
 	}
 	genre := utils.SanitizeString(c.PostForm("genre"))
 	albumID := c.PostForm("albumId")
+	explicit := c.PostForm("explicit") == "true"
 
 	// Upload audio to Firebase Storage
 	ext := strings.ToLower(filepath.Ext(audioHeader.Filename))
@@ -99,6 +100,7 @@ func UploadSong(c *gin.Context) {
 		AudioURL:   audioURL,
 		Source:      "upload",
 		Genre:      genre,
+		Explicit:   explicit,
 		Status:     "pending",
 		Tags:       []string{},
 		CreatedAt:  time.Now(),
@@ -111,6 +113,7 @@ func UploadSong(c *gin.Context) {
 	}
 
 	song.ID = id
+	services.EnqueueEnrichment(id)
 	utils.SuccessResponse(c, http.StatusCreated, gin.H{
 		"message": "Song uploaded successfully. Awaiting admin approval.",
 		"song":    song,
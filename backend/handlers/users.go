@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"slices"
 
+	"spotify-clone/models"
 	"spotify-clone/services"
 	"spotify-clone/utils"
-	"spotify-clone/models"
 
 	"cloud.google.com/go/firestore"
 	"github.com/gin-gonic/gin"
@@ -31,6 +32,7 @@ func UpdateCurrentUser(c *gin.Context) {
 	var req struct {
 		DisplayName string `json:"displayName"`
 		PhotoURL    string `json:"photoURL"`
+		Country     string `json:"country"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -45,6 +47,14 @@ func UpdateCurrentUser(c *gin.Context) {
 	if req.PhotoURL != "" {
 		updates["photoURL"] = req.PhotoURL
 	}
+	if req.Country != "" {
+		country := services.NormalizeRegion(req.Country)
+		if country == "" {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Country must be an ISO 3166-1 alpha-2 code")
+			return
+		}
+		updates["country"] = country
+	}
 
 	if len(updates) == 0 {
 		utils.ErrorResponse(c, http.StatusBadRequest, "No fields to update")
@@ -152,6 +162,30 @@ func FollowArtist(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, gin.H{"status": status, "artistId": artistID})
 }
 
+// songIDPage returns a page of songs from a list of song IDs, most recent
+// first unless ?sort=oldest. Songs that no longer exist are skipped.
+func songIDPage(c *gin.Context, ids []string) {
+	limit, sort, cursor := pageParams(c, 20, 50, "recent")
+	if sort != "recent" && sort != "oldest" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sort or cursor")
+		return
+	}
+	cur, err := utils.DecodeCursor(cursor, sort)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sort or cursor")
+		return
+	}
+
+	page, next := utils.IDPage(ids, cur, limit)
+	songs, _, err := services.GetSongsByIDs(c.Request.Context(), page)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch songs")
+		return
+	}
+
+	utils.PaginatedSuccess(c, songs, next, utils.Count(len(ids)))
+}
+
 // GetRecentlyPlayed returns the user's recently played songs
 func GetRecentlyPlayed(c *gin.Context) {
 	uid := c.GetString("uid")
@@ -162,17 +196,13 @@ func GetRecentlyPlayed(c *gin.Context) {
 		return
 	}
 
-	// Fetch song details for recently played IDs
-	var songs []interface{}
-	for _, songID := range user.RecentlyPlayed {
-		song, err := services.GetSong(c.Request.Context(), songID)
-		if err != nil {
-			continue
-		}
-		songs = append(songs, song)
+	// Stored most recent first
+	ids := user.RecentlyPlayed
+	if c.Query("sort") == "oldest" {
+		ids = slices.Clone(ids)
+		slices.Reverse(ids)
 	}
-
-	utils.SuccessResponse(c, http.StatusOK, songs)
+	songIDPage(c, ids)
 }
 
 // GetLikedSongs returns the user's liked songs
@@ -185,16 +215,13 @@ func GetLikedSongs(c *gin.Context) {
 		return
 	}
 
-	var songs []interface{}
-	for _, songID := range user.LikedSongs {
-		song, err := services.GetSong(c.Request.Context(), songID)
-		if err != nil {
-			continue
-		}
-		songs = append(songs, song)
+	// Stored in the order they were liked
+	ids := user.LikedSongs
+	if c.Query("sort") != "oldest" {
+		ids = slices.Clone(ids)
+		slices.Reverse(ids)
 	}
-
-	utils.SuccessResponse(c, http.StatusOK, songs)
+	songIDPage(c, ids)
 }
 
 // GetPublicProfile returns a user's public profile and their public playlists
@@ -213,6 +240,7 @@ func GetPublicProfile(c *gin.Context) {
 	if err == nil {
 		for _, p := range playlists {
 			if p.IsPublic {
+				services.HidePlaylistMembers(&p, c.GetString("uid"))
 				publicPlaylists = append(publicPlaylists, p)
 			}
 		}
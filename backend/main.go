@@ -6,6 +6,7 @@ import (
 
 	"spotify-clone/config"
 	"spotify-clone/routes"
+	"spotify-clone/services"
 )
 
 func main() {
@@ -16,6 +17,12 @@ func main() {
 	config.InitFirebase()
 	defer config.CloseFirebase()
 
+	// Fill in MusicBrainz metadata for new songs in the background
+	services.StartEnrichmentWorker()
+
+	// Load the full-text search index, rebuilding it if there's none saved
+	services.InitSearchIndex()
+
 	// Setup router
 	router := routes.SetupRouter()
 
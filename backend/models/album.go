@@ -16,3 +16,9 @@ type CreateAlbumRequest struct {
 	Title string `json:"title" binding:"required"`
 	Year  int    `json:"year"`
 }
+
+// ImportArchiveItemRequest names an Internet Archive item by identifier or
+// archive.org/details URL
+type ImportArchiveItemRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// ImportJob tracks the import of an external playlist into a local one
+type ImportJob struct {
+	ID         string        `json:"id" firestore:"id"`
+	UserID     string        `json:"userId" firestore:"userId"`
+	URL        string        `json:"url" firestore:"url"`
+	Source     string        `json:"source" firestore:"source"` // spotify, deezer, youtube, file
+	SourceID   string        `json:"sourceId" firestore:"sourceId"`
+	Name       string        `json:"name" firestore:"name"`
+	PlaylistID string        `json:"playlistId" firestore:"playlistId"`
+	IsPublic   bool          `json:"isPublic" firestore:"isPublic"`
+	Status     string        `json:"status" firestore:"status"` // pending, running, completed, failed
+	Total      int           `json:"total" firestore:"total"`
+	Processed  int           `json:"processed" firestore:"processed"`
+	Matched    int           `json:"matched" firestore:"matched"`
+	Tracks     []ImportTrack `json:"tracks" firestore:"tracks"`
+	Error      string        `json:"error,omitempty" firestore:"error,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt  time.Time     `json:"updatedAt" firestore:"updatedAt"`
+	// Lease of the run processing the job, empty once it stops
+	LeaseID    string    `json:"-" firestore:"leaseId"`
+	LeaseUntil time.Time `json:"-" firestore:"leaseUntil"`
+}
+
+// ImportTrack is one track of an import and how it was matched
+type ImportTrack struct {
+	External ExternalTrack  `json:"external" firestore:"external"`
+	Status   string         `json:"status" firestore:"status"` // pending, matched, unmatched, failed
+	SongID   string         `json:"songId,omitempty" firestore:"songId,omitempty"`
+	Match    *PlayableTrack `json:"match,omitempty" firestore:"match,omitempty"`
+	Error    string         `json:"error,omitempty" firestore:"error,omitempty"`
+	Added    bool           `json:"added,omitempty" firestore:"added,omitempty"` // song inserted into the playlist
+}
+
+// ImportPlaylistRequest is the body of a playlist import by URL
+type ImportPlaylistRequest struct {
+	URL      string `json:"url" binding:"required"`
+	Name     string `json:"name"`
+	IsPublic bool   `json:"isPublic"`
+}
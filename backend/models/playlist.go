@@ -3,13 +3,86 @@ package models
 import "time"
 
 type Playlist struct {
-	ID        string    `json:"id" firestore:"id"`
-	Name      string    `json:"name" firestore:"name"`
-	UserID    string    `json:"userId" firestore:"userId"`
-	CoverURL  string    `json:"coverURL" firestore:"coverURL"`
-	IsPublic  bool      `json:"isPublic" firestore:"isPublic"`
-	SongIDs   []string  `json:"songIds" firestore:"songIds"`
-	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+	ID            string            `json:"id" firestore:"id"`
+	Name          string            `json:"name" firestore:"name"`
+	UserID        string            `json:"userId" firestore:"userId"`
+	CoverURL      string            `json:"coverURL" firestore:"coverURL"`
+	IsPublic      bool              `json:"isPublic" firestore:"isPublic"`
+	SongIDs       []string          `json:"songIds" firestore:"songIds"` // mirrors Items
+	Items         []PlaylistItem    `json:"items" firestore:"items"`
+	SnapshotID    string            `json:"snapshotId" firestore:"snapshotId"`     // changes on every edit
+	Members       map[string]string `json:"members,omitempty" firestore:"members"` // uid: collaborator or viewer
+	MemberIDs     []string          `json:"-" firestore:"memberIds"`               // keys of Members, for queries and rules
+	FollowerCount int               `json:"followerCount" firestore:"followerCount"`
+	SnapshotCount int               `json:"-" firestore:"snapshotCount"` // history size, for pruning
+	CreatedAt     time.Time         `json:"createdAt" firestore:"createdAt"`
+}
+
+// PlaylistItem is one entry of a playlist. The item ID stays the same when
+// entries move, so a song added twice can be moved or removed on its own.
+type PlaylistItem struct {
+	ItemID   string    `json:"itemId" firestore:"itemId"`
+	SongID   string    `json:"songId" firestore:"songId"`
+	AddedBy  string    `json:"addedBy" firestore:"addedBy"`
+	AddedAt  time.Time `json:"addedAt" firestore:"addedAt"`
+	Position int       `json:"position" firestore:"-"`
+}
+
+// PlaylistSnapshot is a playlist as it was after one change. Snapshots are
+// listed without their items.
+type PlaylistSnapshot struct {
+	ID           string         `json:"id" firestore:"id"`
+	Action       string         `json:"action" firestore:"action"` // initial, create, add, move, remove, update, restore
+	Name         string         `json:"name" firestore:"name"`
+	IsPublic     bool           `json:"isPublic" firestore:"isPublic"`
+	Items        []PlaylistItem `json:"items,omitempty" firestore:"items"`
+	SongCount    int            `json:"songCount" firestore:"songCount"`
+	RestoredFrom string         `json:"restoredFrom,omitempty" firestore:"restoredFrom,omitempty"`
+	CreatedBy    string         `json:"createdBy" firestore:"createdBy"`
+	CreatedAt    time.Time      `json:"createdAt" firestore:"createdAt"`
+}
+
+// PlaylistDiff is what changed between two snapshots. Items are matched by
+// item ID; moved lists the fewest items whose moves explain the new order.
+type PlaylistDiff struct {
+	From    string                    `json:"from"`
+	To      string                    `json:"to"`
+	Added   []PlaylistItem            `json:"added"`
+	Removed []PlaylistItem            `json:"removed"`
+	Moved   []PlaylistMove            `json:"moved"`
+	Changes map[string][2]interface{} `json:"changes"` // field: [from, to]
+}
+
+type PlaylistMove struct {
+	ItemID string `json:"itemId"`
+	SongID string `json:"songId"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+type RestorePlaylistRequest struct {
+	SnapshotID string `json:"snapshotId" binding:"required"`
+}
+
+// PlaylistInvite is a link that adds whoever opens it to a playlist, until
+// it's revoked or expires
+type PlaylistInvite struct {
+	Token      string     `json:"token" firestore:"token"`
+	PlaylistID string     `json:"playlistId" firestore:"playlistId"`
+	Role       string     `json:"role" firestore:"role"` // collaborator or viewer
+	CreatedBy  string     `json:"createdBy" firestore:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" firestore:"expiresAt,omitempty"`
+	Uses       int        `json:"uses" firestore:"uses"`
+}
+
+type CreatePlaylistInviteRequest struct {
+	Role          string `json:"role"` // collaborator by default
+	ExpiresInDays int    `json:"expiresInDays" binding:"min=0,max=365"`
+}
+
+type UpdatePlaylistMemberRequest struct {
+	Role string `json:"role" binding:"required"`
 }
 
 type CreatePlaylistRequest struct {
@@ -18,7 +91,35 @@ type CreatePlaylistRequest struct {
 }
 
 type UpdatePlaylistRequest struct {
-	Name     string   `json:"name"`
-	IsPublic *bool    `json:"isPublic"`
-	SongIDs  []string `json:"songIds"`
+	Name       string   `json:"name"`
+	IsPublic   *bool    `json:"isPublic"`
+	SongIDs    []string `json:"songIds"`
+	SnapshotID string   `json:"snapshotId"` // rejects the update if the playlist changed since
+}
+
+// AddPlaylistItemsRequest inserts songs at a position (the end by default)
+type AddPlaylistItemsRequest struct {
+	SongID          string   `json:"songId"`
+	SongIDs         []string `json:"songIds" binding:"max=500"`
+	Position        *int     `json:"position"`
+	AllowDuplicates bool     `json:"allowDuplicates"`
+	SnapshotID      string   `json:"snapshotId"`
+}
+
+// MovePlaylistItemsRequest moves rangeLength items starting at rangeStart
+// to before the item at insertBefore, positions counted before the move
+type MovePlaylistItemsRequest struct {
+	RangeStart   *int   `json:"rangeStart" binding:"required"`
+	RangeLength  int    `json:"rangeLength"`
+	InsertBefore *int   `json:"insertBefore" binding:"required"`
+	SnapshotID   string `json:"snapshotId"`
+}
+
+// PlaylistUpdate is a song recently added to a playlist the user follows
+type PlaylistUpdate struct {
+	PlaylistID   string       `json:"playlistId"`
+	PlaylistName string       `json:"playlistName"`
+	CoverURL     string       `json:"coverURL"`
+	Item         PlaylistItem `json:"item"`
+	Song         Song         `json:"song"`
 }
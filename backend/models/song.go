@@ -3,22 +3,33 @@ package models
 import "time"
 
 type Song struct {
-	ID         string    `json:"id" firestore:"id"`
-	Title      string    `json:"title" firestore:"title"`
-	ArtistID   string    `json:"artistId" firestore:"artistId"`
-	ArtistName string    `json:"artistName" firestore:"artistName"`
-	AlbumID    string    `json:"albumId" firestore:"albumId"`
-	AlbumName  string    `json:"albumName" firestore:"albumName"`
-	CoverURL   string    `json:"coverURL" firestore:"coverURL"`
-	AudioURL   string    `json:"audioURL" firestore:"audioURL"`
-	Source     string    `json:"source" firestore:"source"` // upload, jamendo, fma, ia
-	Duration   int       `json:"duration" firestore:"duration"`
-	PlayCount  int       `json:"playCount" firestore:"playCount"`
-	Genre      string    `json:"genre" firestore:"genre"`
-	Status     string    `json:"status" firestore:"status"` // pending, approved, rejected
-	Featured   bool      `json:"featured" firestore:"featured"`
-	Tags       []string  `json:"tags" firestore:"tags"`
-	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+	ID              string     `json:"id" firestore:"id"`
+	Title           string     `json:"title" firestore:"title"`
+	ArtistID        string     `json:"artistId" firestore:"artistId"`
+	ArtistName      string     `json:"artistName" firestore:"artistName"`
+	AlbumID         string     `json:"albumId" firestore:"albumId"`
+	AlbumName       string     `json:"albumName" firestore:"albumName"`
+	CoverURL        string     `json:"coverURL" firestore:"coverURL"`
+	AudioURL        string     `json:"audioURL" firestore:"audioURL"`
+	Source          string     `json:"source" firestore:"source"` // upload, jamendo, fma, ia, youtube, deezer
+	Duration        int        `json:"duration" firestore:"duration"`
+	PlayCount       int        `json:"playCount" firestore:"playCount"`
+	Genre           string     `json:"genre" firestore:"genre"`
+	Status          string     `json:"status" firestore:"status"` // pending, approved, rejected
+	Featured        bool       `json:"featured" firestore:"featured"`
+	Tags            []string   `json:"tags" firestore:"tags"`
+	FeaturedArtists []string   `json:"featuredArtists,omitempty" firestore:"featuredArtists,omitempty"`
+	Version         string     `json:"version,omitempty" firestore:"version,omitempty"` // live, remix, acoustic, ...
+	License         string     `json:"license,omitempty" firestore:"license,omitempty"` // license URL for openly licensed sources
+	MBID            string     `json:"mbid,omitempty" firestore:"mbid,omitempty"`       // MusicBrainz recording ID
+	ArtistMBIDs     []string   `json:"artistMbids,omitempty" firestore:"artistMbids,omitempty"`
+	ReleaseMBID     string     `json:"releaseMbid,omitempty" firestore:"releaseMbid,omitempty"`
+	ISRC            string     `json:"isrc,omitempty" firestore:"isrc,omitempty"`
+	Year            int        `json:"year,omitempty" firestore:"year,omitempty"`
+	Genres          []string   `json:"genres,omitempty" firestore:"genres,omitempty"`
+	Explicit        bool       `json:"explicit" firestore:"explicit"`
+	EnrichedAt      *time.Time `json:"enrichedAt,omitempty" firestore:"enrichedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt" firestore:"createdAt"`
 }
 
 type UploadSongRequest struct {
@@ -27,3 +38,21 @@ type UploadSongRequest struct {
 	Genre    string `json:"genre"`
 	Duration int    `json:"duration"`
 }
+
+// BatchSongsRequest asks for several songs by ID at once
+type BatchSongsRequest struct {
+	IDs []string `json:"ids" binding:"required,max=500"`
+}
+
+// SongFilter narrows song listings and searches; zero values don't filter
+type SongFilter struct {
+	Status      string `form:"-"`
+	Genre       string `form:"genre"`
+	Source      string `form:"source"`      // upload, jamendo, fma, ia, youtube, deezer
+	MinDuration int    `form:"minDuration"` // seconds
+	MaxDuration int    `form:"maxDuration"`
+	YearFrom    int    `form:"yearFrom"`
+	YearTo      int    `form:"yearTo"`
+	Explicit    *bool  `form:"explicit"`
+	License     string `form:"license"` // cc0, cc-by, cc-by-sa, ..., public-domain or none
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// ExternalTrack is a metadata-only track from a provider like Spotify,
+// Deezer or MusicBrainz that has to be resolved to a playable source
+type ExternalTrack struct {
+	Source   string `json:"source" firestore:"source"` // spotify, deezer, youtube, catalog, file
+	SourceID string `json:"sourceId" firestore:"sourceId"`
+	Title    string `json:"title" firestore:"title"`
+	Artist   string `json:"artist" firestore:"artist"`
+	Album    string `json:"album,omitempty" firestore:"album,omitempty"`
+	Duration int    `json:"duration" firestore:"duration"` // seconds
+	ISRC     string `json:"isrc,omitempty" firestore:"isrc,omitempty"`
+	CoverURL string `json:"coverURL,omitempty" firestore:"coverURL,omitempty"`
+}
+
+// PlayableTrack is a candidate that can actually be streamed
+type PlayableTrack struct {
+	Source   string  `json:"source" firestore:"source"` // upload, jamendo, ia, youtube
+	ID       string  `json:"id" firestore:"id"`         // song ID, Jamendo ID, "identifier/file" or video ID
+	Title    string  `json:"title" firestore:"title"`
+	Artist   string  `json:"artist" firestore:"artist"`
+	Duration int     `json:"duration" firestore:"duration"`
+	AudioURL string  `json:"audioURL,omitempty" firestore:"audioURL,omitempty"` // empty for YouTube, use the stream endpoint
+	CoverURL string  `json:"coverURL,omitempty" firestore:"coverURL,omitempty"`
+	License  string  `json:"license,omitempty" firestore:"license,omitempty"`
+	Score    float64 `json:"score" firestore:"score"`
+}
+
+// TrackMapping records which playable source an external track resolved to
+type TrackMapping struct {
+	ID         string        `json:"id" firestore:"id"` // "<source>_<sourceId>"
+	External   ExternalTrack `json:"external" firestore:"external"`
+	Match      PlayableTrack `json:"match" firestore:"match"`
+	ResolvedAt time.Time     `json:"resolvedAt" firestore:"resolvedAt"`
+}
+
+type ResolveTrackRequest struct {
+	Source   string `json:"source" binding:"required"`
+	SourceID string `json:"sourceId"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Duration int    `json:"duration"`
+	ISRC     string `json:"isrc"`
+	Refresh  bool   `json:"refresh"` // ignore a stored mapping
+}
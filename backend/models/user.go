@@ -10,11 +10,22 @@ type User struct {
 	Role           string    `json:"role" firestore:"role"` // user, artist, admin
 	LikedSongs     []string  `json:"likedSongs" firestore:"likedSongs"`
 	Following      []string  `json:"following" firestore:"following"`
+	SavedPlaylists []string  `json:"savedPlaylists" firestore:"savedPlaylists"` // followed playlists, oldest first
 	RecentlyPlayed []string  `json:"recentlyPlayed" firestore:"recentlyPlayed"`
+	Country        string    `json:"country,omitempty" firestore:"country,omitempty"` // ISO 3166-1 alpha-2, used as the discovery region
 	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
 }
 
+// UserSummary is the public part of a user, safe to show to anyone
+type UserSummary struct {
+	UID         string `json:"uid"`
+	DisplayName string `json:"displayName"`
+	PhotoURL    string `json:"photoURL"`
+	Role        string `json:"role"`
+}
+
 type UpdateUserRequest struct {
 	DisplayName string `json:"displayName"`
 	PhotoURL    string `json:"photoURL"`
+	Country     string `json:"country"`
 }
@@ -3,6 +3,7 @@ package routes
 import (
 	"spotify-clone/handlers"
 	"spotify-clone/middleware"
+	"spotify-clone/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,7 +17,13 @@ func SetupRouter() *gin.Engine {
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok", "service": "spotify-clone-api"})
+		c.JSON(200, gin.H{
+			"status":     "ok",
+			"service":    "spotify-clone-api",
+			"extractor":  services.GetExtractorStatus(c.Request.Context()),
+			"audioCache": services.GetAudioCacheStatus(),
+			"search":     services.GetSearchIndexStatus(),
+		})
 	})
 
 	api := r.Group("/api")
@@ -29,7 +36,8 @@ func SetupRouter() *gin.Engine {
 		}
 
 		// Public Routes
-		api.GET("/discover/youtube/stream/:videoId", handlers.GetYouTubeStream)
+		// The proxy is fetched by <audio> elements and checks the signed token
+		// issued by /discover/youtube/stream instead of a bearer header
 		api.GET("/discover/youtube/proxy/:videoId", handlers.ProxyYouTubeStream)
 
 		// Protected routes (auth required)
@@ -49,6 +57,7 @@ func SetupRouter() *gin.Engine {
 			songs := protected.Group("/songs")
 			{
 				songs.GET("", handlers.GetSongs)
+				songs.POST("/batch", handlers.GetSongsBatch)
 				songs.GET("/:id", handlers.GetSong)
 				songs.GET("/:id/stream", handlers.StreamSong)
 				songs.POST("/:id/play", handlers.RecordPlay)
@@ -59,19 +68,43 @@ func SetupRouter() *gin.Engine {
 			playlists := protected.Group("/playlists")
 			{
 				playlists.GET("", handlers.GetPlaylists)
+				playlists.GET("/saved", handlers.GetSavedPlaylists)
 				playlists.POST("", handlers.CreatePlaylist)
+				playlists.POST("/import", handlers.ImportPlaylist)
+				playlists.POST("/import/file", handlers.ImportPlaylistFile)
+				playlists.GET("/import/:jobId", handlers.GetImportJob)
+				playlists.POST("/import/:jobId/resume", handlers.ResumeImportJob)
+				playlists.GET("/invites/:token", handlers.GetPlaylistInvite)
+				playlists.POST("/invites/:token/accept", handlers.AcceptPlaylistInvite)
 				playlists.GET("/:id", handlers.GetPlaylist)
+				playlists.GET("/:id/export", handlers.ExportPlaylist)
 				playlists.PUT("/:id", handlers.UpdatePlaylist)
 				playlists.DELETE("/:id", handlers.DeletePlaylist)
 				playlists.POST("/:id/songs", handlers.AddSongToPlaylist)
 				playlists.DELETE("/:id/songs/:songId", handlers.RemoveSongFromPlaylist)
+				playlists.POST("/:id/items", handlers.AddSongToPlaylist)
+				playlists.POST("/:id/items/move", handlers.MovePlaylistItems)
+				playlists.DELETE("/:id/items/:itemId", handlers.RemovePlaylistItem)
+				playlists.GET("/:id/history", handlers.GetPlaylistHistory)
+				playlists.GET("/:id/history/:snapshotId", handlers.GetPlaylistSnapshot)
+				playlists.GET("/:id/diff", handlers.DiffPlaylist)
+				playlists.POST("/:id/restore", handlers.RestorePlaylist)
+				playlists.PUT("/:id/members/:uid", handlers.UpdatePlaylistMember)
+				playlists.DELETE("/:id/members/:uid", handlers.RemovePlaylistMember)
+				playlists.GET("/:id/invites", handlers.GetPlaylistInvites)
+				playlists.POST("/:id/invites", handlers.CreatePlaylistInvite)
+				playlists.DELETE("/:id/invites/:token", handlers.RevokePlaylistInvite)
+				playlists.PUT("/:id/follow", handlers.FollowPlaylist)
+				playlists.DELETE("/:id/follow", handlers.UnfollowPlaylist)
 			}
 
 			// Search
 			protected.GET("/search", handlers.Search)
+			protected.GET("/search/suggest", handlers.SearchSuggest)
 
 			// Artist public routes
 			protected.GET("/artists/:id", handlers.GetPublicArtist)
+			protected.GET("/artists/:id/albums", handlers.GetPublicArtistAlbums)
 			protected.POST("/artists/:id/follow", handlers.FollowArtist)
 
 			// Recommendations
@@ -84,15 +117,27 @@ func SetupRouter() *gin.Engine {
 			discover := protected.Group("/discover")
 			{
 				discover.GET("/jamendo", handlers.DiscoverJamendo)
+				discover.GET("/jamendo/artists/:id", handlers.GetJamendoArtist)
+				discover.GET("/jamendo/albums/:id", handlers.GetJamendoAlbum)
+				discover.GET("/jamendo/playlists", handlers.DiscoverJamendoPlaylists)
+				discover.GET("/jamendo/playlists/:id", handlers.GetJamendoPlaylist)
+				discover.GET("/jamendo/radios", handlers.DiscoverJamendoRadios)
+				discover.GET("/jamendo/radios/:id", handlers.GetJamendoRadioStream)
 				discover.GET("/fma", handlers.DiscoverFMA)
 				discover.GET("/archive", handlers.DiscoverArchive)
 				discover.GET("/archive/:identifier/files", handlers.GetArchiveFiles)
 				discover.GET("/spotify", handlers.DiscoverSpotify)
 				discover.GET("/deezer", handlers.DiscoverDeezer)
+				discover.GET("/deezer/genres", handlers.DiscoverDeezerGenres)
+				discover.GET("/deezer/genres/:id", handlers.GetDeezerGenreChart)
+				discover.GET("/deezer/artists/:id", handlers.GetDeezerArtist)
+				discover.GET("/deezer/albums/:id", handlers.GetDeezerAlbum)
 				discover.GET("/youtube", handlers.DiscoverYouTube)
+				discover.GET("/youtube/stream/:videoId", handlers.GetYouTubeStream)
 				discover.GET("/similar", handlers.DiscoverSimilar)
 				discover.GET("/feed", handlers.DiscoverFeed)
 				discover.GET("/featured", handlers.DiscoverFeatured)
+				discover.POST("/resolve", handlers.ResolveExternalTrack)
 			}
 
 			// Upload routes
@@ -108,6 +153,7 @@ func SetupRouter() *gin.Engine {
 				artist.GET("/analytics", handlers.GetArtistAnalytics)
 				artist.POST("/albums", handlers.CreateAlbum)
 				artist.GET("/albums", handlers.GetArtistAlbums)
+				artist.POST("/albums/import/archive", handlers.ImportArchiveItem)
 			}
 
 			// Artist registration (any authenticated user)
@@ -123,10 +169,14 @@ func SetupRouter() *gin.Engine {
 				admin.GET("/songs", handlers.AdminGetSongs)
 				admin.PUT("/songs/:id/approve", handlers.AdminApproveSong)
 				admin.PUT("/songs/:id/featured", handlers.AdminToggleFeatured)
+				admin.POST("/songs/:id/enrich", handlers.AdminEnrichSong)
+				admin.POST("/songs/normalize-genres", handlers.AdminNormalizeGenres)
 				admin.DELETE("/songs/:id", handlers.AdminDeleteSong)
 				admin.GET("/artists", handlers.AdminGetArtists)
 				admin.PUT("/artists/:id/approve", handlers.AdminApproveArtist)
 				admin.POST("/upload", handlers.AdminUploadSong)
+				admin.POST("/search/reindex", handlers.AdminReindexSearch)
+				admin.POST("/backfill-sort-fields", handlers.AdminBackfillSortFields)
 			}
 		}
 	}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"container/list"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Read-through audio cache
+// External audio streamed through the backend in full is kept on disk so later
+// plays and seeks are served locally instead of from the upstream CDN.
+// Entries are evicted least-recently-used once the cache exceeds its size
+// budget. File modification times record last access, so the LRU order
+// survives restarts. Like uploads (see storage.go) the cache is a local
+// directory, as the backend has no other blob store; point AUDIO_CACHE_DIR
+// at a volume shared by replicas to keep it across redeploys. It lives
+// outside ./uploads so it is never served by the public static file handler.
+
+// CachedAudio is an open cache entry; callers must Close it
+type CachedAudio struct {
+	*os.File
+	ContentType string
+	Size        int64
+	ETag        string
+}
+
+// AudioCacheStatus is reported by the health endpoint
+type AudioCacheStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Dir      string `json:"dir"`
+	Entries  int    `json:"entries"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"maxBytes"`
+}
+
+type audioCacheEntry struct {
+	key         string
+	path        string
+	contentType string
+	size        int64
+	elem        *list.Element
+}
+
+type audioCacheStore struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	entries  map[string]*audioCacheEntry
+	lru      *list.List // front = most recently used
+	total    int64
+	inflight map[string]bool
+}
+
+var (
+	audioCacheInst *audioCacheStore
+	audioCacheOnce sync.Once
+
+	audioCacheKeyRe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+// Extensions for the audio types upstreams serve; also used to recover the
+// content type of entries found on disk at startup
+var audioCacheExts = map[string]string{
+	"audio/mp4":  ".m4a",
+	"audio/webm": ".webm",
+	"audio/mpeg": ".mp3",
+	"audio/ogg":  ".ogg",
+}
+
+// getAudioCache returns the shared cache configured from AUDIO_CACHE_DIR
+// (default ./cache/audio) and AUDIO_CACHE_MAX_MB (default 1024, 0 disables)
+func getAudioCache() *audioCacheStore {
+	audioCacheOnce.Do(func() {
+		dir := os.Getenv("AUDIO_CACHE_DIR")
+		if dir == "" {
+			dir = filepath.Join(".", "cache", "audio")
+		}
+		audioCacheInst = newAudioCacheStore(dir, int64(envInt("AUDIO_CACHE_MAX_MB", 1024))<<20)
+	})
+	return audioCacheInst
+}
+
+// newAudioCacheStore opens a cache in dir, indexing what a previous run left
+// there. A maxBytes of 0 disables it.
+func newAudioCacheStore(dir string, maxBytes int64) *audioCacheStore {
+	s := &audioCacheStore{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*audioCacheEntry),
+		lru:      list.New(),
+		inflight: make(map[string]bool),
+	}
+	if s.maxBytes <= 0 {
+		return s
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Warn("audio cache disabled", "dir", dir, "err", err)
+		s.maxBytes = 0
+		return s
+	}
+	s.load()
+	return s
+}
+
+// load indexes entries left on disk by a previous run, oldest access last
+func (s *audioCacheStore) load() {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		slog.Warn("audio cache: could not read dir", "dir", s.dir, "err", err)
+		return
+	}
+
+	type found struct {
+		entry   *audioCacheEntry
+		modTime time.Time
+	}
+	var all []found
+	for _, f := range files {
+		name := f.Name()
+		path := filepath.Join(s.dir, name)
+		if strings.HasPrefix(name, ".tmp-") {
+			os.Remove(path) // partial download from a previous run
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		ext := filepath.Ext(name)
+		entry := &audioCacheEntry{
+			key:         strings.TrimSuffix(name, ext),
+			path:        path,
+			contentType: "application/octet-stream",
+			size:        info.Size(),
+		}
+		for ct, e := range audioCacheExts {
+			if e == ext {
+				entry.contentType = ct
+			}
+		}
+		all = append(all, found{entry, info.ModTime()})
+	}
+
+	slices.SortFunc(all, func(a, b found) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	s.mu.Lock()
+	for _, f := range all {
+		f.entry.elem = s.lru.PushBack(f.entry)
+		s.entries[f.entry.key] = f.entry
+		s.total += f.entry.size
+	}
+	s.evictLocked("")
+	s.mu.Unlock()
+}
+
+func audioCacheKey(source, id string) string {
+	return source + "_" + audioCacheKeyRe.ReplaceAllString(id, "_")
+}
+
+// OpenCachedAudio returns the cached audio for a source track, if present
+func OpenCachedAudio(source, id string) (*CachedAudio, bool) {
+	return getAudioCache().open(audioCacheKey(source, id))
+}
+
+func (s *audioCacheStore) open(key string) (*CachedAudio, bool) {
+	if s.maxBytes <= 0 {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if ok {
+		s.lru.MoveToFront(entry.elem)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	f, err := os.Open(entry.path)
+	if err != nil {
+		s.remove(key)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(entry.path, now, now)
+	etag := fmt.Sprintf(`"%s-%d"`, key, entry.size)
+	return &CachedAudio{File: f, ContentType: entry.contentType, Size: entry.size, ETag: etag}, true
+}
+
+// AudioCacheWriter collects a full upstream body and adds it to the cache on
+// Commit. Write never fails, so a full disk never interrupts the client stream
+// it is teed from; the entry is just dropped.
+type AudioCacheWriter struct {
+	store       *audioCacheStore
+	key         string
+	contentType string
+	expected    int64
+	file        *os.File
+	written     int64
+	failed      bool
+}
+
+// NewAudioCacheWriter starts caching a full response for a source track.
+// expectedSize is the complete length in bytes, or -1 when unknown. It returns
+// nil when caching is disabled, the track is cached or being cached already,
+// or the body wouldn't fit the budget.
+func NewAudioCacheWriter(source, id, contentType string, expectedSize int64) *AudioCacheWriter {
+	return getAudioCache().newWriter(audioCacheKey(source, id), contentType, expectedSize)
+}
+
+func (s *audioCacheStore) newWriter(key, contentType string, expectedSize int64) *AudioCacheWriter {
+	if s.maxBytes <= 0 || expectedSize > s.maxBytes/4 {
+		return nil
+	}
+
+	s.mu.Lock()
+	if _, ok := s.entries[key]; ok || s.inflight[key] {
+		s.mu.Unlock()
+		return nil
+	}
+	s.inflight[key] = true
+	s.mu.Unlock()
+
+	f, err := os.CreateTemp(s.dir, ".tmp-"+key+"-*")
+	if err != nil {
+		slog.Warn("audio cache: could not create temp file", "err", err)
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		return nil
+	}
+	return &AudioCacheWriter{
+		store:       s,
+		key:         key,
+		contentType: strings.TrimSpace(strings.Split(contentType, ";")[0]),
+		expected:    expectedSize,
+		file:        f,
+	}
+}
+
+func (w *AudioCacheWriter) Write(p []byte) (int, error) {
+	if w.failed {
+		return len(p), nil
+	}
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	if err != nil || w.written > w.store.maxBytes/4 {
+		w.failed = true
+	}
+	return len(p), nil
+}
+
+// Commit adds the body to the cache if it arrived complete
+func (w *AudioCacheWriter) Commit() error {
+	s := w.store
+	tmp := w.file.Name()
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, w.key)
+		s.mu.Unlock()
+	}()
+
+	closeErr := w.file.Close()
+	if w.failed || closeErr != nil || w.written == 0 || (w.expected >= 0 && w.written != w.expected) {
+		os.Remove(tmp)
+		return fmt.Errorf("audio cache: incomplete body for %s (%d of %d bytes)", w.key, w.written, w.expected)
+	}
+
+	ext, ok := audioCacheExts[w.contentType]
+	if !ok {
+		ext = ".bin"
+	}
+	path := filepath.Join(s.dir, w.key+ext)
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("audio cache: %v", err)
+	}
+
+	s.mu.Lock()
+	entry := &audioCacheEntry{key: w.key, path: path, contentType: w.contentType, size: w.written}
+	entry.elem = s.lru.PushFront(entry)
+	s.entries[w.key] = entry
+	s.total += entry.size
+	s.evictLocked(w.key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Abort discards a partial body
+func (w *AudioCacheWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+	w.store.mu.Lock()
+	delete(w.store.inflight, w.key)
+	w.store.mu.Unlock()
+}
+
+// evictLocked drops least-recently-used entries until the cache fits its
+// budget, never evicting keep
+func (s *audioCacheStore) evictLocked(keep string) {
+	for s.total > s.maxBytes {
+		elem := s.lru.Back()
+		if elem == nil {
+			return
+		}
+		entry := elem.Value.(*audioCacheEntry)
+		if entry.key == keep {
+			return
+		}
+		s.lru.Remove(elem)
+		delete(s.entries, entry.key)
+		s.total -= entry.size
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("audio cache: evict failed", "path", entry.path, "err", err)
+		}
+	}
+}
+
+func (s *audioCacheStore) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		s.lru.Remove(entry.elem)
+		delete(s.entries, key)
+		s.total -= entry.size
+	}
+}
+
+// FullResponseSize reports whether an upstream response carries the complete
+// body (a 200, or a 206 for the whole range as browsers request with
+// "Range: bytes=0-") and its total length, -1 if unknown
+func FullResponseSize(resp *http.Response) (int64, bool) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, true
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-1023/1024
+		var start, end, total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+			return 0, false
+		}
+		return total, start == 0 && end == total-1
+	}
+	return 0, false
+}
+
+// GetAudioCacheStatus reports cache usage for the health endpoint
+func GetAudioCacheStatus() AudioCacheStatus {
+	s := getAudioCache()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return AudioCacheStatus{
+		Enabled:  s.maxBytes > 0,
+		Dir:      s.dir,
+		Entries:  len(s.entries),
+		Bytes:    s.total,
+		MaxBytes: s.maxBytes,
+	}
+}
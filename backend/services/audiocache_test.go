@@ -0,0 +1,128 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFullResponseSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		length int64
+		rng    string
+		size   int64
+		full   bool
+	}{
+		{"200 with length", http.StatusOK, 1024, "", 1024, true},
+		{"200 without length", http.StatusOK, -1, "", -1, true},
+		{"206 whole body", http.StatusPartialContent, 1024, "bytes 0-1023/1024", 1024, true},
+		{"206 tail", http.StatusPartialContent, 24, "bytes 1000-1023/1024", 1024, false},
+		{"206 head", http.StatusPartialContent, 1000, "bytes 0-999/1024", 1024, false},
+		{"206 unknown total", http.StatusPartialContent, 1024, "bytes 0-1023/*", 0, false},
+		{"404", http.StatusNotFound, 10, "", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, ContentLength: tt.length, Header: http.Header{}}
+		if tt.rng != "" {
+			resp.Header.Set("Content-Range", tt.rng)
+		}
+		size, full := FullResponseSize(resp)
+		if size != tt.size || full != tt.full {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, size, full, tt.size, tt.full)
+		}
+	}
+}
+
+// cacheAudio writes body to s under key as a complete response
+func cacheAudio(t *testing.T, s *audioCacheStore, key, body string) {
+	t.Helper()
+	w := s.newWriter(key, "audio/mp4", int64(len(body)))
+	if w == nil {
+		t.Fatalf("no writer for %s", key)
+	}
+	w.Write([]byte(body))
+	if err := w.Commit(); err != nil {
+		t.Fatalf("commit %s: %v", key, err)
+	}
+}
+
+func TestAudioCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	s := newAudioCacheStore(dir, 40) // writers take up to 10 bytes
+	cacheAudio(t, s, "a", strings.Repeat("a", 10))
+	cacheAudio(t, s, "b", strings.Repeat("b", 10))
+	cacheAudio(t, s, "c", strings.Repeat("c", 10))
+	cacheAudio(t, s, "d", strings.Repeat("d", 10))
+
+	// Reading a makes b the least recently used
+	f, ok := s.open("a")
+	if !ok {
+		t.Fatal("a not cached")
+	}
+	f.Close()
+	cacheAudio(t, s, "e", strings.Repeat("e", 10))
+
+	if _, ok := s.open("b"); ok {
+		t.Error("b was not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.m4a")); !os.IsNotExist(err) {
+		t.Errorf("b left on disk: %v", err)
+	}
+	for _, key := range []string{"a", "c", "d", "e"} {
+		f, ok := s.open(key)
+		if !ok {
+			t.Errorf("%s was evicted", key)
+			continue
+		}
+		f.Close()
+	}
+	if st := s.total; st != 40 {
+		t.Errorf("total = %d, want 40", st)
+	}
+}
+
+func TestAudioCacheDropsIncompleteBody(t *testing.T) {
+	s := newAudioCacheStore(t.TempDir(), 40)
+	w := s.newWriter("a", "audio/mp4", 10)
+	w.Write([]byte("short"))
+	if err := w.Commit(); err == nil {
+		t.Fatal("committed a short body")
+	}
+	if _, ok := s.open("a"); ok {
+		t.Error("short body was cached")
+	}
+	if w := s.newWriter("b", "audio/mp4", 11); w != nil {
+		t.Error("accepted a body over a quarter of the budget")
+	}
+}
+
+func TestAudioCacheLoadKeepsAccessOrder(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"old", "mid", "new"} {
+		path := filepath.Join(dir, key+".webm")
+		if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		at := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(path, at, at)
+	}
+	os.WriteFile(filepath.Join(dir, ".tmp-partial-1"), []byte("x"), 0644)
+
+	// A budget of two entries evicts the oldest on load
+	s := newAudioCacheStore(dir, 20)
+	if _, ok := s.entries["old"]; ok {
+		t.Error("oldest entry survived load")
+	}
+	if e := s.entries["new"]; e == nil || e.contentType != "audio/webm" || s.lru.Front().Value.(*audioCacheEntry) != e {
+		t.Errorf("newest entry not loaded first: %+v", e)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".tmp-partial-1")); !os.IsNotExist(err) {
+		t.Error("partial download not removed")
+	}
+}
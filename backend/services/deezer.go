@@ -2,10 +2,15 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
+
+	"spotify-clone/models"
 )
 
 // Deezer API - Free, no API key required!
@@ -19,21 +24,44 @@ type DeezerTrack struct {
 	Preview       string `json:"preview"`
 	Link          string `json:"link"`
 	Rank          int    `json:"rank"`
+	ISRC          string `json:"isrc,omitempty"` // only on /track/:id
+	Explicit      bool   `json:"explicit_lyrics"`
 	Artist        DeezerArtist `json:"artist"`
 	Album         DeezerAlbum  `json:"album"`
 }
 
 type DeezerArtist struct {
-	ID      int    `json:"id"`
-	Name    string `json:"name"`
-	Picture string `json:"picture_medium"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Picture   string `json:"picture_medium"`
+	PictureXL string `json:"picture_xl,omitempty"`
+	NbFan     int    `json:"nb_fan,omitempty"`
 }
 
 type DeezerAlbum struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Cover       string `json:"cover_medium"`
+	CoverXL     string `json:"cover_xl"`
+	ReleaseDate string `json:"release_date,omitempty"`
+}
+
+// DeezerAlbumDetail is an album with its artist, genres and tracklist
+type DeezerAlbumDetail struct {
+	DeezerAlbum
+	Artist DeezerArtist `json:"artist"`
+	Genres struct {
+		Data []DeezerGenre `json:"data"`
+	} `json:"genres"`
+	Tracks struct {
+		Data []DeezerTrack `json:"data"`
+	} `json:"tracks"`
+}
+
+type DeezerGenre struct {
 	ID      int    `json:"id"`
-	Title   string `json:"title"`
-	Cover   string `json:"cover_medium"`
-	CoverXL string `json:"cover_xl"`
+	Name    string `json:"name"`
+	Picture string `json:"picture_medium"`
 }
 
 type DeezerSearchResponse struct {
@@ -71,7 +99,9 @@ func SearchDeezer(query string, limit int) ([]DeezerTrack, error) {
 	return result.Data, nil
 }
 
-// GetDeezerChart gets top chart tracks
+// GetDeezerChart gets top chart tracks. The public API has no country
+// parameter (chart/0 is the all-genres chart, localized by caller IP), so
+// this isn't region-aware.
 func GetDeezerChart(limit int) ([]DeezerTrack, error) {
 	apiURL := fmt.Sprintf("https://api.deezer.com/chart/0/tracks?limit=%d", limit)
 
@@ -91,22 +121,212 @@ func GetDeezerChart(limit int) ([]DeezerTrack, error) {
 	return result.Data, nil
 }
 
-// GetDeezerGenre gets tracks from a specific genre/radio
+// GetDeezerByGenre gets the editorial chart of a genre (see GetDeezerGenres;
+// 0 is all genres)
 func GetDeezerByGenre(genreID int, limit int) ([]DeezerTrack, error) {
-	apiURL := fmt.Sprintf("https://api.deezer.com/radio/%d/tracks?limit=%d", genreID, limit)
+	var result struct {
+		Data []DeezerTrack `json:"data"`
+	}
+	if err := deezerGet(fmt.Sprintf("chart/%d/tracks?limit=%d", genreID, limit), &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
 
-	resp, err := deezerClient.Get(apiURL)
+// GetDeezerGenres lists the genres Deezer has charts for
+func GetDeezerGenres() ([]DeezerGenre, error) {
+	var result struct {
+		Data []DeezerGenre `json:"data"`
+	}
+	if err := deezerGet("genre", &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetDeezerArtist fetches an artist by ID
+func GetDeezerArtist(id int) (*DeezerArtist, error) {
+	var artist DeezerArtist
+	if err := deezerGet(fmt.Sprintf("artist/%d", id), &artist); err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
+
+// GetDeezerArtistTop returns an artist's most popular tracks
+func GetDeezerArtistTop(id, limit int) ([]DeezerTrack, error) {
+	var result struct {
+		Data []DeezerTrack `json:"data"`
+	}
+	if err := deezerGet(fmt.Sprintf("artist/%d/top?limit=%d", id, limit), &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetDeezerRelatedArtists returns artists similar to the given one
+func GetDeezerRelatedArtists(id, limit int) ([]DeezerArtist, error) {
+	var result struct {
+		Data []DeezerArtist `json:"data"`
+	}
+	if err := deezerGet(fmt.Sprintf("artist/%d/related?limit=%d", id, limit), &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetDeezerAlbum fetches an album with its tracklist. Album tracks come
+// without their album, so it's filled in.
+func GetDeezerAlbum(id int) (*DeezerAlbumDetail, error) {
+	var album DeezerAlbumDetail
+	if err := deezerGet(fmt.Sprintf("album/%d", id), &album); err != nil {
+		return nil, err
+	}
+	for i := range album.Tracks.Data {
+		album.Tracks.Data[i].Album = album.DeezerAlbum
+	}
+	return &album, nil
+}
+
+// DeezerSong converts a track to the common song model. Deezer only serves
+// 30-second previews; use the resolver for a full-length source.
+func DeezerSong(t DeezerTrack) models.Song {
+	song := models.Song{
+		ID:         "dz-" + strconv.Itoa(t.ID),
+		Title:      t.Title,
+		ArtistName: t.Artist.Name,
+		AlbumName:  t.Album.Title,
+		CoverURL:   t.Album.Cover,
+		AudioURL:   t.Preview,
+		Source:     "deezer",
+		Duration:   t.Duration,
+		Status:     "approved",
+		Tags:       []string{},
+		Explicit:   t.Explicit,
+	}
+	if t.Artist.ID != 0 {
+		song.ArtistID = "dz-" + strconv.Itoa(t.Artist.ID)
+	}
+	if t.Album.ID != 0 {
+		song.AlbumID = "dz-" + strconv.Itoa(t.Album.ID)
+	}
+	return song
+}
+
+// DeezerSongs converts a list of tracks with DeezerSong
+func DeezerSongs(tracks []DeezerTrack) []models.Song {
+	songs := make([]models.Song, 0, len(tracks))
+	for _, t := range tracks {
+		songs = append(songs, DeezerSong(t))
+	}
+	return songs
+}
+
+// ErrDeezerNotFound is returned when a Deezer ID matches nothing
+var ErrDeezerNotFound = errors.New("not found on deezer")
+
+// deezerGet fetches an API path into out. Deezer reports errors in a 200
+// body, so those are checked first.
+func deezerGet(path string, out interface{}) error {
+	resp, err := deezerClient.Get("https://api.deezer.com/" + path)
+	if err != nil {
+		return fmt.Errorf("deezer API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("deezer API error: %v", err)
+	}
+	var apiErr struct {
+		Error *struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+			Code    int    `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error != nil {
+		// 800: "no data"
+		if apiErr.Error.Code == 800 || apiErr.Error.Type == "DataException" {
+			return ErrDeezerNotFound
+		}
+		return fmt.Errorf("deezer API error: %s", apiErr.Error.Message)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode deezer response: %v", err)
+	}
+	return nil
+}
+
+// GetDeezerTrack fetches a single track, including its ISRC
+func GetDeezerTrack(id string) (*DeezerTrack, error) {
+	resp, err := deezerClient.Get("https://api.deezer.com/track/" + url.PathEscape(id))
 	if err != nil {
 		return nil, fmt.Errorf("deezer API error: %v", err)
 	}
 	defer resp.Body.Close()
 
+	// Deezer reports errors in a 200 body
 	var result struct {
-		Data []DeezerTrack `json:"data"`
+		DeezerTrack
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode deezer genre: %v", err)
+		return nil, fmt.Errorf("failed to decode deezer track: %v", err)
 	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("deezer track %s: %s", id, result.Error.Message)
+	}
+	return &result.DeezerTrack, nil
+}
 
-	return result.Data, nil
+// DeezerPlaylist is a playlist's title and tracks
+type DeezerPlaylist struct {
+	Title  string
+	Tracks []DeezerTrack
+}
+
+// GetDeezerPlaylist fetches a public playlist, following pagination up to maxTracks
+func GetDeezerPlaylist(id string, maxTracks int) (*DeezerPlaylist, error) {
+	resp, err := deezerClient.Get("https://api.deezer.com/playlist/" + url.PathEscape(id))
+	if err != nil {
+		return nil, fmt.Errorf("deezer API error: %v", err)
+	}
+	var meta struct {
+		Title string `json:"title"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&meta)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode deezer playlist: %v", err)
+	}
+	if meta.Error != nil {
+		return nil, fmt.Errorf("deezer playlist %s: %s", id, meta.Error.Message)
+	}
+
+	playlist := &DeezerPlaylist{Title: meta.Title}
+	next := fmt.Sprintf("https://api.deezer.com/playlist/%s/tracks?limit=100", url.PathEscape(id))
+	for next != "" && len(playlist.Tracks) < maxTracks {
+		resp, err := deezerClient.Get(next)
+		if err != nil {
+			return nil, fmt.Errorf("deezer API error: %v", err)
+		}
+		var page DeezerSearchResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode deezer playlist tracks: %v", err)
+		}
+		playlist.Tracks = append(playlist.Tracks, page.Data...)
+		next = page.Next
+	}
+	if len(playlist.Tracks) > maxTracks {
+		playlist.Tracks = playlist.Tracks[:maxTracks]
+	}
+	return playlist, nil
 }
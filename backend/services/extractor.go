@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// YouTube extractors
+// An Extractor turns a search query into tracks and a video ID into audio
+// streams. yt-dlp is the most robust backend but needs a binary on disk; the
+// in-process Go backend works in minimal containers and read-only filesystems;
+// Piped and Invidious offload extraction to community API instances.
+// The configured backend is tried first and the others serve as fallbacks.
+
+// ErrSearchUnsupported is returned by extractors that can only resolve streams
+var ErrSearchUnsupported = fmt.Errorf("search not supported by this extractor: %w", errors.ErrUnsupported)
+
+// Extractor resolves YouTube searches and audio streams
+type Extractor interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]PipedTrack, error)
+	AudioStream(ctx context.Context, videoID string) (*PipedStreamInfo, error)
+}
+
+// trendingExtractor is implemented by extractors with a regional trending feed
+type trendingExtractor interface {
+	Trending(ctx context.Context, region string, limit int) ([]PipedTrack, error)
+}
+
+// YouTubePlaylist is a playlist's title and entries
+type YouTubePlaylist struct {
+	Title  string       `json:"title"`
+	Tracks []PipedTrack `json:"tracks"`
+}
+
+// playlistExtractor is implemented by extractors that can list playlists
+type playlistExtractor interface {
+	Playlist(ctx context.Context, playlistID string) (*YouTubePlaylist, error)
+}
+
+// ExtractorStatus is reported by the health endpoint
+type ExtractorStatus struct {
+	Backend   string           `json:"backend"`
+	Order     []string         `json:"order"`
+	Fallback  bool             `json:"fallback"`
+	YTDLP     YTDLPStatus      `json:"ytdlp"`
+	Piped     []InstanceStatus `json:"piped,omitempty"`
+	Invidious []InstanceStatus `json:"invidious,omitempty"`
+}
+
+// extractorChain tries each extractor in order until one succeeds
+type extractorChain struct {
+	extractors []Extractor
+}
+
+var (
+	extractorChainInst *extractorChain
+	extractorBackend   string
+	extractorFallback  bool
+	extractorOnce      sync.Once
+)
+
+// getExtractor returns the configured extractor chain.
+// EXTRACTOR_BACKEND selects the primary backend: "ytdlp", "go", "piped",
+// "invidious" or "auto" (yt-dlp when its binary is available). The rest follow
+// as fallbacks in the order yt-dlp, Piped, Invidious, Go; Piped and Invidious
+// only take part when their instance lists are configured.
+// EXTRACTOR_FALLBACK=false disables falling back past the primary.
+func getExtractor() *extractorChain {
+	extractorOnce.Do(func() {
+		extractorBackend = strings.ToLower(os.Getenv("EXTRACTOR_BACKEND"))
+		if extractorBackend == "" {
+			extractorBackend = "auto"
+		}
+		extractorFallback = os.Getenv("EXTRACTOR_FALLBACK") != "false"
+
+		ytdlpExt := &ytdlpExtractor{supervisor: getYTDLP()}
+		order := []Extractor{ytdlpExt}
+		if piped := getPipedClient(); piped.Configured() {
+			order = append(order, piped)
+		}
+		if invidious := getInvidiousClient(); invidious.Configured() {
+			order = append(order, invidious)
+		}
+		order = append(order, newGoExtractor())
+
+		primary := extractorBackend
+		if primary == "auto" {
+			primary = "ytdlp"
+			if _, err := getYTDLP().Version(context.Background()); err != nil {
+				slog.Warn("yt-dlp unavailable, using it only as a last resort", "err", err)
+				order = append(order[1:], ytdlpExt)
+				primary = order[0].Name()
+			}
+		}
+		found := false
+		for i, e := range order {
+			if e.Name() == primary {
+				order = append([]Extractor{e}, append(order[:i:i], order[i+1:]...)...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			// Piped and Invidious are left out without instances
+			slog.Warn("extractor backend not available, using "+order[0].Name()+" instead",
+				"backend", primary, "hint", "set PIPED_INSTANCES or INVIDIOUS_INSTANCES")
+		}
+
+		if !extractorFallback {
+			order = order[:1]
+		}
+		extractorChainInst = &extractorChain{extractors: order}
+	})
+	return extractorChainInst
+}
+
+func (ch *extractorChain) Name() string {
+	names := make([]string, len(ch.extractors))
+	for i, e := range ch.extractors {
+		names[i] = e.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (ch *extractorChain) Search(ctx context.Context, query string, limit int) ([]PipedTrack, error) {
+	var lastErr error
+	for _, e := range ch.extractors {
+		tracks, err := e.Search(ctx, query, limit)
+		if err == nil {
+			return tracks, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			slog.Warn("extractor search failed, trying next", "extractor", e.Name(), "err", err)
+			lastErr = err
+		}
+	}
+	if lastErr == nil {
+		lastErr = ErrSearchUnsupported
+	}
+	return nil, lastErr
+}
+
+// Trending returns the regional music chart from the first extractor that has
+// one, or an ErrUnsupported error when none does
+func (ch *extractorChain) Trending(ctx context.Context, region string, limit int) ([]PipedTrack, error) {
+	lastErr := fmt.Errorf("trending not supported by any extractor: %w", errors.ErrUnsupported)
+	for _, e := range ch.extractors {
+		te, ok := e.(trendingExtractor)
+		if !ok {
+			continue
+		}
+		tracks, err := te.Trending(ctx, region, limit)
+		if err == nil {
+			return tracks, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Warn("extractor trending failed, trying next", "extractor", e.Name(), "region", region, "err", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Playlist lists a YouTube playlist through the first extractor that can
+func (ch *extractorChain) Playlist(ctx context.Context, playlistID string) (*YouTubePlaylist, error) {
+	lastErr := fmt.Errorf("playlists not supported by any extractor: %w", errors.ErrUnsupported)
+	for _, e := range ch.extractors {
+		pe, ok := e.(playlistExtractor)
+		if !ok {
+			continue
+		}
+		playlist, err := pe.Playlist(ctx, playlistID)
+		if err == nil {
+			return playlist, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Warn("extractor playlist failed, trying next", "extractor", e.Name(), "playlistId", playlistID, "err", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (ch *extractorChain) AudioStream(ctx context.Context, videoID string) (*PipedStreamInfo, error) {
+	var lastErr error
+	for _, e := range ch.extractors {
+		info, err := e.AudioStream(ctx, videoID)
+		if err == nil {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Warn("extractor stream failed, trying next", "extractor", e.Name(), "videoId", videoID, "err", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// GetExtractorStatus reports the extractor configuration for the health endpoint
+func GetExtractorStatus(ctx context.Context) ExtractorStatus {
+	ch := getExtractor()
+	order := make([]string, len(ch.extractors))
+	for i, e := range ch.extractors {
+		order[i] = e.Name()
+	}
+	return ExtractorStatus{
+		Backend:   extractorBackend,
+		Order:     order,
+		Fallback:  extractorFallback,
+		YTDLP:     GetYTDLPStatus(ctx),
+		Piped:     getPipedClient().InstanceStatus(),
+		Invidious: getInvidiousClient().InstanceStatus(),
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// In-process Go extractor
+// Uses github.com/kkdai/youtube to resolve streams without any external
+// binary. It cannot search, so the chain falls back to another backend for that.
+
+type goExtractor struct {
+	client *youtube.Client
+}
+
+func newGoExtractor() *goExtractor {
+	return &goExtractor{
+		client: &youtube.Client{HTTPClient: &http.Client{Timeout: 20 * time.Second}},
+	}
+}
+
+func (e *goExtractor) Name() string { return "go" }
+
+func (e *goExtractor) Search(ctx context.Context, query string, limit int) ([]PipedTrack, error) {
+	return nil, ErrSearchUnsupported
+}
+
+func (e *goExtractor) Playlist(ctx context.Context, playlistID string) (*YouTubePlaylist, error) {
+	pl, err := e.client.GetPlaylistContext(ctx, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("youtube playlist error: %v", err)
+	}
+
+	playlist := &YouTubePlaylist{Title: pl.Title}
+	for _, v := range pl.Videos {
+		track := PipedTrack{
+			VideoID:  v.ID,
+			Title:    v.Title,
+			Artist:   v.Author,
+			Duration: int(v.Duration.Seconds()),
+		}
+		if len(v.Thumbnails) > 0 {
+			track.Thumbnail = v.Thumbnails[len(v.Thumbnails)-1].URL
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	return playlist, nil
+}
+
+func (e *goExtractor) AudioStream(ctx context.Context, videoID string) (*PipedStreamInfo, error) {
+	video, err := e.client.GetVideoContext(ctx, videoID)
+	if err != nil {
+		return nil, fmt.Errorf("youtube metadata error: %v", err)
+	}
+
+	// Audio-only formats, best bitrate first, preferring m4a like yt-dlp does
+	formats := video.Formats.Type("audio/")
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no audio formats for %s", videoID)
+	}
+	sort.SliceStable(formats, func(i, j int) bool {
+		mi := strings.HasPrefix(formats[i].MimeType, "audio/mp4")
+		mj := strings.HasPrefix(formats[j].MimeType, "audio/mp4")
+		if mi != mj {
+			return mi
+		}
+		return formats[i].Bitrate > formats[j].Bitrate
+	})
+
+	info := &PipedStreamInfo{
+		Title:    video.Title,
+		Uploader: video.Author,
+		Duration: int(video.Duration.Seconds()),
+	}
+	if len(video.Thumbnails) > 0 {
+		info.Thumbnail = video.Thumbnails[len(video.Thumbnails)-1].URL
+	}
+
+	for i := range formats {
+		streamURL, err := e.client.GetStreamURLContext(ctx, video, &formats[i])
+		if err != nil {
+			continue
+		}
+		info.AudioStreams = append(info.AudioStreams, PipedAudioStream{
+			URL:      streamURL,
+			MimeType: formats[i].MimeType,
+			Bitrate:  formats[i].Bitrate,
+		})
+		// The best stream is all callers use; stop once it's resolved
+		break
+	}
+	if len(info.AudioStreams) == 0 {
+		return nil, fmt.Errorf("could not decipher audio stream for %s", videoID)
+	}
+	return info, nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// yt-dlp extractor
+// Shells out to the yt-dlp binary through the process supervisor
+
+// YTDLPResult represents a search result from yt-dlp
+type YTDLPResult struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Channel     string  `json:"channel"`
+	Duration    float64 `json:"duration"`
+	ViewCount   int64   `json:"view_count"`
+	Thumbnail   string  `json:"thumbnail"`
+	WebpageURL  string  `json:"webpage_url"`
+	URL         string  `json:"url"`
+	Description string  `json:"description"`
+}
+
+type ytdlpExtractor struct {
+	supervisor *YTDLPSupervisor
+}
+
+func (e *ytdlpExtractor) Name() string { return "ytdlp" }
+
+func (e *ytdlpExtractor) Search(ctx context.Context, query string, limit int) ([]PipedTrack, error) {
+	searchStr := fmt.Sprintf("ytsearch%d:%s", limit, query)
+
+	output, err := e.supervisor.Run(ctx,
+		"--dump-json",
+		"-q",
+		"--no-playlist",
+		"--no-cache-dir",
+		"--flat-playlist",
+		"--no-warnings",
+		"--no-check-certificates",
+		"--socket-timeout", "10",
+		searchStr,
+	)
+	if err != nil {
+		// yt-dlp returns exit code 1 sometimes even with valid output,
+		// but busy/timeout/cancel must always reach the caller
+		if len(output) == 0 || isExtractorAbort(ctx, err) {
+			return nil, fmt.Errorf("yt-dlp search failed: %w", err)
+		}
+	}
+
+	// Parse JSONL (one JSON object per line)
+	var tracks []PipedTrack
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var result YTDLPResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			continue
+		}
+
+		// Skip if no ID
+		if result.ID == "" {
+			continue
+		}
+
+		tracks = append(tracks, PipedTrack{
+			VideoID:   result.ID,
+			Title:     result.Title,
+			Artist:    result.Channel,
+			Thumbnail: result.Thumbnail,
+			Duration:  int(result.Duration),
+			Views:     result.ViewCount,
+		})
+	}
+	return tracks, nil
+}
+
+func (e *ytdlpExtractor) Playlist(ctx context.Context, playlistID string) (*YouTubePlaylist, error) {
+	output, err := e.supervisor.Run(ctx,
+		"-J",
+		"-q",
+		"--flat-playlist",
+		"--no-cache-dir",
+		"--no-warnings",
+		"--socket-timeout", "10",
+		"https://www.youtube.com/playlist?list="+playlistID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("yt-dlp playlist failed: %w", err)
+	}
+
+	var result struct {
+		Title   string        `json:"title"`
+		Entries []YTDLPResult `json:"entries"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp playlist: %v", err)
+	}
+
+	playlist := &YouTubePlaylist{Title: result.Title}
+	for _, entry := range result.Entries {
+		if entry.ID == "" {
+			continue
+		}
+		playlist.Tracks = append(playlist.Tracks, PipedTrack{
+			VideoID:   entry.ID,
+			Title:     entry.Title,
+			Artist:    entry.Channel,
+			Thumbnail: entry.Thumbnail,
+			Duration:  int(entry.Duration),
+			Views:     entry.ViewCount,
+		})
+	}
+	return playlist, nil
+}
+
+func (e *ytdlpExtractor) AudioStream(ctx context.Context, videoID string) (*PipedStreamInfo, error) {
+	videoURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+
+	// Get the best audio URL
+	output, err := e.supervisor.Run(ctx,
+		"-g",                                 // Print URL only
+		"-q",                                 // Quiet
+		"--no-playlist",                      // Single video only
+		"--no-cache-dir",                     // Don't waste time on cache
+		"-f", "bestaudio[ext=m4a]/bestaudio", // Best audio, prefer m4a
+		"--no-warnings",
+		"--no-check-certificates",
+		"--socket-timeout", "10",
+		videoURL,
+	)
+	if err != nil {
+		// stderr has already been logged by the supervisor
+		return nil, fmt.Errorf("yt-dlp audio extraction failed: %w", err)
+	}
+
+	audioURL := strings.TrimSpace(string(output))
+	if audioURL == "" {
+		return nil, fmt.Errorf("no audio URL returned")
+	}
+
+	return &PipedStreamInfo{
+		AudioStreams: []PipedAudioStream{{URL: audioURL}},
+	}, nil
+}
+
+// isExtractorAbort reports whether err means yt-dlp never produced a complete
+// result (rejected, timed out or cancelled) rather than exiting non-zero
+func isExtractorAbort(ctx context.Context, err error) bool {
+	return errors.Is(err, ErrExtractorBusy) || errors.Is(err, ErrExtractorTimeout) || ctx.Err() != nil
+}
+
+// getYTDLPPath locates the yt-dlp binary: YTDLP_PATH if set, then the
+// working directory, then $PATH
+func getYTDLPPath() string {
+	if p := os.Getenv("YTDLP_PATH"); p != "" {
+		return p
+	}
+
+	exeName := "yt-dlp"
+	if runtime.GOOS == "windows" {
+		exeName = "yt-dlp.exe"
+	}
+	if absPath, err := filepath.Abs(exeName); err == nil {
+		if _, err := os.Stat(absPath); err == nil {
+			return absPath
+		}
+	}
+	if p, err := exec.LookPath(exeName); err == nil {
+		return p
+	}
+	return exeName // reported as unavailable by the health check
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"spotify-clone/models"
+)
+
+// Facets
+// Songs are filtered on facet values (genre, source, license, explicit and
+// release decade) and numeric ranges (duration, year). Facet counts are
+// disjunctive: a facet is counted over results that pass every filter except
+// its own, so the UI can offer alternatives to a chip that's already picked.
+
+// FacetCounts maps a facet to its values and how many results have each
+type FacetCounts map[string]map[string]int
+
+// licenseType reduces a Creative Commons license URL to a short type
+// like "cc-by-sa"; songs without a license are "none"
+func licenseType(license string) string {
+	l := strings.ToLower(license)
+	switch {
+	case l == "":
+		return "none"
+	case strings.Contains(l, "publicdomain/zero"), strings.Contains(l, "cc0"):
+		return "cc0"
+	case strings.Contains(l, "publicdomain/mark"), strings.Contains(l, "public domain"):
+		return "public-domain"
+	case strings.Contains(l, "creativecommons.org/licenses/"):
+		rest := l[strings.Index(l, "/licenses/")+len("/licenses/"):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			rest = rest[:i]
+		}
+		if rest == "" {
+			return "cc"
+		}
+		return "cc-" + rest
+	}
+	return "other"
+}
+
+// normalizeGenre is how genres are stored, queried and faceted, so "Hip-Hop"
+// from an upload and "hip-hop" from MusicBrainz are one genre
+func normalizeGenre(g string) string {
+	return strings.ToLower(strings.TrimSpace(g))
+}
+
+// NormalizeSongGenres rewrites the genre of songs saved before genres were
+// normalized, returning how many it changed. It's a one-off migration run
+// from the admin API.
+func NormalizeSongGenres(ctx context.Context) (int, error) {
+	unnormalized := make(map[string]string)
+	err := scanCollection(ctx, "songs", func(id string, data func(interface{}) error) {
+		var s models.Song
+		if data(&s) == nil {
+			if g := normalizeGenre(s.Genre); g != s.Genre {
+				unnormalized[id] = g
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for id, genre := range unnormalized {
+		if err := UpdateSong(ctx, id, map[string]interface{}{"genre": genre}); err != nil {
+			return changed, fmt.Errorf("failed to update song %s: %v", id, err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// songFacets returns the facet values and numbers a song is filtered on
+func songFacets(s models.Song) (map[string]string, map[string]int) {
+	facets := map[string]string{
+		"source":   strings.ToLower(s.Source),
+		"license":  licenseType(s.License),
+		"explicit": strconv.FormatBool(s.Explicit),
+	}
+	if g := normalizeGenre(s.Genre); g != "" {
+		facets["genre"] = g
+	}
+	if s.Year > 0 {
+		facets["decade"] = strconv.Itoa(s.Year/10*10) + "s"
+	}
+	numbers := map[string]int{"duration": s.Duration}
+	if s.Year > 0 {
+		numbers["year"] = s.Year
+	}
+	return facets, numbers
+}
+
+// filterFailures lists the facets whose filter rejects a song. Duration
+// counts as a facet of its own; the year range belongs to "decade".
+func filterFailures(facets map[string]string, numbers map[string]int, f models.SongFilter) []string {
+	var failed []string
+	if f.Genre != "" && facets["genre"] != normalizeGenre(f.Genre) {
+		failed = append(failed, "genre")
+	}
+	if f.Source != "" && facets["source"] != strings.ToLower(f.Source) {
+		failed = append(failed, "source")
+	}
+	if f.License != "" && facets["license"] != strings.ToLower(f.License) {
+		failed = append(failed, "license")
+	}
+	if f.Explicit != nil && facets["explicit"] != strconv.FormatBool(*f.Explicit) {
+		failed = append(failed, "explicit")
+	}
+	if d := numbers["duration"]; (f.MinDuration > 0 && d < f.MinDuration) || (f.MaxDuration > 0 && d > f.MaxDuration) {
+		failed = append(failed, "duration")
+	}
+	if y, ok := numbers["year"]; (f.YearFrom > 0 && (!ok || y < f.YearFrom)) || (f.YearTo > 0 && (!ok || y > f.YearTo)) {
+		failed = append(failed, "decade")
+	}
+	return failed
+}
+
+// add counts a result's facet values, skipping facets other than the one
+// filter it failed
+func (fc FacetCounts) add(facets map[string]string, failed []string) {
+	if len(failed) > 1 {
+		return
+	}
+	for name, value := range facets {
+		if len(failed) == 1 && failed[0] != name {
+			continue
+		}
+		if fc[name] == nil {
+			fc[name] = make(map[string]int)
+		}
+		fc[name][value]++
+	}
+}
+
+// hasMemoryFilters reports whether a filter needs checks Firestore can't
+// run as plain equality queries
+func hasMemoryFilters(f models.SongFilter) bool {
+	return f.MinDuration > 0 || f.MaxDuration > 0 || f.YearFrom > 0 || f.YearTo > 0 || f.Explicit != nil || f.License != ""
+}
+
+// songMatchesFilter reports whether a song passes every filter
+func songMatchesFilter(s models.Song, f models.SongFilter) bool {
+	facets, numbers := songFacets(s)
+	return len(filterFailures(facets, numbers, f)) == 0
+}
+
+// SearchSongsFiltered returns a page of approved songs matching the query
+// and filter, the total number of matches, and facet counts over all of them
+func SearchSongsFiltered(ctx context.Context, query string, f models.SongFilter, offset, limit int) ([]models.Song, int, FacetCounts, error) {
+	counts := make(FacetCounts)
+	var songs []models.Song
+
+	if !searchReady.Load() {
+		// Until the index is loaded, filter the fallback scan
+		found, err := SearchSongs(ctx, query, 200)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		for _, s := range found {
+			facets, numbers := songFacets(s)
+			failed := filterFailures(facets, numbers, f)
+			counts.add(facets, failed)
+			if len(failed) == 0 {
+				songs = append(songs, s)
+			}
+		}
+		return pageOf(songs, offset, limit), len(songs), counts, nil
+	}
+
+	var matches []SearchHit
+	for _, h := range searchDocs(query, 0, ofType("song", approved)) {
+		failed := filterFailures(h.Doc.Facets, h.Doc.Numbers, f)
+		counts.add(h.Doc.Facets, failed)
+		if len(failed) == 0 {
+			matches = append(matches, h)
+		}
+	}
+	return decodeHits[models.Song](pageOf(matches, offset, limit)), len(matches), counts, nil
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"testing"
+
+	"spotify-clone/models"
+)
+
+func TestGenreFilterIgnoresCase(t *testing.T) {
+	facets, numbers := songFacets(models.Song{Genre: " Hip-Hop ", Source: "upload"})
+	if facets["genre"] != "hip-hop" {
+		t.Fatalf("genre facet = %q", facets["genre"])
+	}
+	for _, genre := range []string{"hip-hop", "Hip-Hop", "HIP-HOP"} {
+		if failed := filterFailures(facets, numbers, models.SongFilter{Genre: genre}); len(failed) != 0 {
+			t.Errorf("filter %q rejected the song: %v", genre, failed)
+		}
+	}
+	if failed := filterFailures(facets, numbers, models.SongFilter{Genre: "pop"}); len(failed) != 1 {
+		t.Errorf("filter pop: failed = %v", failed)
+	}
+}
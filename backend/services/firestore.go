@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"spotify-clone/config"
 	"spotify-clone/models"
@@ -14,6 +16,9 @@ import (
 
 func CreateUser(ctx context.Context, user models.User) error {
 	_, err := config.FirestoreClient.Collection("users").Doc(user.UID).Set(ctx, user)
+	if err == nil {
+		indexDoc(userSearchDoc(user))
+	}
 	return err
 }
 
@@ -29,23 +34,83 @@ func GetUser(ctx context.Context, uid string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserSummaries returns the public profiles of users by UID, with
+// batched gets; unknown UIDs are left out
+func GetUserSummaries(ctx context.Context, uids []string) (map[string]models.UserSummary, error) {
+	var refs []*firestore.DocumentRef
+	seen := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		if uid == "" || strings.Contains(uid, "/") || seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		refs = append(refs, config.FirestoreClient.Collection("users").Doc(uid))
+	}
+
+	summaries := make(map[string]models.UserSummary, len(refs))
+	for start := 0; start < len(refs); start += maxBatchGet {
+		docs, err := config.FirestoreClient.GetAll(ctx, refs[start:min(start+maxBatchGet, len(refs))])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users: %v", err)
+		}
+		for _, doc := range docs {
+			var user models.User
+			if !doc.Exists() || doc.DataTo(&user) != nil {
+				continue
+			}
+			summaries[doc.Ref.ID] = models.UserSummary{
+				UID:         doc.Ref.ID,
+				DisplayName: user.DisplayName,
+				PhotoURL:    user.PhotoURL,
+				Role:        user.Role,
+			}
+		}
+	}
+	return summaries, nil
+}
+
+// ListUsers returns a page of users in the named sort order (see UserSorts)
+func ListUsers(ctx context.Context, sort, cursor string, limit int) ([]models.User, string, *int, error) {
+	q := config.FirestoreClient.Collection("users").Query
+	docs, next, total, err := pageQuery(ctx, q, UserSorts, sort, cursor, limit, true, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	users := make([]models.User, 0, len(docs))
+	for _, doc := range docs {
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			continue
+		}
+		user.UID = doc.Ref.ID
+		users = append(users, user)
+	}
+	return users, next, total, nil
+}
+
 func UpdateUser(ctx context.Context, uid string, updates map[string]interface{}) error {
 	updatePairs := make([]firestore.Update, 0, len(updates))
 	for k, v := range updates {
 		updatePairs = append(updatePairs, firestore.Update{Path: k, Value: v})
 	}
 	_, err := config.FirestoreClient.Collection("users").Doc(uid).Update(ctx, updatePairs)
+	if err == nil && (updates["displayName"] != nil || updates["photoURL"] != nil || updates["role"] != nil) {
+		indexUserByID(ctx, uid)
+	}
 	return err
 }
 
 // ---- Songs ----
 
 func CreateSong(ctx context.Context, song models.Song) (string, error) {
+	song.Genre = normalizeGenre(song.Genre)
 	ref, _, err := config.FirestoreClient.Collection("songs").Add(ctx, song)
 	if err != nil {
 		return "", err
 	}
 	_, err = ref.Update(ctx, []firestore.Update{{Path: "id", Value: ref.ID}})
+	song.ID = ref.ID
+	indexDoc(songSearchDoc(song))
 	return ref.ID, err
 }
 
@@ -62,35 +127,94 @@ func GetSong(ctx context.Context, id string) (*models.Song, error) {
 	return &song, nil
 }
 
+// Documents requested per batch get, to keep each request small
+const maxBatchGet = 300
+
+// GetSongsByIDs fetches songs with batched gets, in the order of ids
+// (duplicates included), and returns the IDs that don't exist
+func GetSongsByIDs(ctx context.Context, ids []string) ([]models.Song, []string, error) {
+	found := make(map[string]models.Song, len(ids))
+	var refs []*firestore.DocumentRef
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		// Firestore rejects IDs with slashes; they can't name a song anyway
+		if id == "" || strings.Contains(id, "/") || seen[id] {
+			continue
+		}
+		seen[id] = true
+		refs = append(refs, config.FirestoreClient.Collection("songs").Doc(id))
+	}
+
+	for start := 0; start < len(refs); start += maxBatchGet {
+		docs, err := config.FirestoreClient.GetAll(ctx, refs[start:min(start+maxBatchGet, len(refs))])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get songs: %v", err)
+		}
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+			var song models.Song
+			if err := doc.DataTo(&song); err != nil {
+				continue
+			}
+			song.ID = doc.Ref.ID
+			found[song.ID] = song
+		}
+	}
+
+	songs := make([]models.Song, 0, len(ids))
+	var missing []string
+	for _, id := range ids {
+		if song, ok := found[id]; ok {
+			songs = append(songs, song)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return songs, missing, nil
+}
+
 func CreateSongWithID(ctx context.Context, id string, song models.Song) error {
+	song.Genre = normalizeGenre(song.Genre)
 	_, err := config.FirestoreClient.Collection("songs").Doc(id).Set(ctx, song)
+	if err == nil {
+		song.ID = id
+		indexDoc(songSearchDoc(song))
+	}
 	return err
 }
 
-func GetSongs(ctx context.Context, limit int, genre, status string) ([]models.Song, error) {
-	col := config.FirestoreClient.Collection("songs")
-	var iter *firestore.DocumentIterator
-
-	if status != "" && genre != "" {
-		iter = col.Where("status", "==", status).Where("genre", "==", genre).Limit(limit).Documents(ctx)
-	} else if status != "" {
-		iter = col.Where("status", "==", status).Limit(limit).Documents(ctx)
-	} else if genre != "" {
-		iter = col.Where("genre", "==", genre).Limit(limit).Documents(ctx)
-	} else {
-		iter = col.Limit(limit).Documents(ctx)
+// GetSongs returns a page of songs matching the filter in the named sort
+// order (see SongSorts), the next page's cursor and the total. Status, genre
+// and source are queried in Firestore; the other filters are applied while
+// reading, and then the total isn't counted.
+func GetSongs(ctx context.Context, filter models.SongFilter, sort, cursor string, limit int) ([]models.Song, string, *int, error) {
+	q := config.FirestoreClient.Collection("songs").Query
+	if filter.Status != "" {
+		q = q.Where("status", "==", filter.Status)
+	}
+	if filter.Genre != "" {
+		q = q.Where("genre", "==", normalizeGenre(filter.Genre))
+	}
+	if filter.Source != "" {
+		q = q.Where("source", "==", filter.Source)
 	}
-	defer iter.Stop()
 
-	var songs []models.Song
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
+	var keep func(*firestore.DocumentSnapshot) bool
+	if hasMemoryFilters(filter) {
+		keep = func(doc *firestore.DocumentSnapshot) bool {
+			var song models.Song
+			return doc.DataTo(&song) == nil && songMatchesFilter(song, filter)
 		}
+	}
+
+	docs, next, total, err := pageQuery(ctx, q, SongSorts, sort, cursor, limit, keep == nil, keep)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	songs := make([]models.Song, 0, len(docs))
+	for _, doc := range docs {
 		var song models.Song
 		if err := doc.DataTo(&song); err != nil {
 			continue
@@ -98,7 +222,7 @@ func GetSongs(ctx context.Context, limit int, genre, status string) ([]models.So
 		song.ID = doc.Ref.ID
 		songs = append(songs, song)
 	}
-	return songs, nil
+	return songs, next, total, nil
 }
 
 func GetFeaturedSongs(ctx context.Context, limit int) ([]models.Song, error) {
@@ -129,16 +253,25 @@ func GetFeaturedSongs(ctx context.Context, limit int) ([]models.Song, error) {
 }
 
 func UpdateSong(ctx context.Context, id string, updates map[string]interface{}) error {
+	if g, ok := updates["genre"].(string); ok {
+		updates["genre"] = normalizeGenre(g)
+	}
 	updatePairs := make([]firestore.Update, 0, len(updates))
 	for k, v := range updates {
 		updatePairs = append(updatePairs, firestore.Update{Path: k, Value: v})
 	}
 	_, err := config.FirestoreClient.Collection("songs").Doc(id).Update(ctx, updatePairs)
+	if err == nil {
+		indexSongByID(ctx, id)
+	}
 	return err
 }
 
 func DeleteSong(ctx context.Context, id string) error {
 	_, err := config.FirestoreClient.Collection("songs").Doc(id).Delete(ctx)
+	if err == nil {
+		unindex("song", id)
+	}
 	return err
 }
 
@@ -177,18 +310,29 @@ func IncrementPlayCount(ctx context.Context, songID string) error {
 	if err != nil {
 		return nil
 	}
+	getSearchIndex().addPopularity("song", songID, 1)
 	return nil
 }
 
 // ---- Playlists ----
 
-func CreatePlaylist(ctx context.Context, playlist models.Playlist) (string, error) {
-	ref, _, err := config.FirestoreClient.Collection("playlists").Add(ctx, playlist)
+// CreatePlaylist saves a new playlist with its first snapshot
+func CreatePlaylist(ctx context.Context, playlist models.Playlist) (*models.Playlist, error) {
+	ref := config.FirestoreClient.Collection("playlists").NewDoc()
+	playlist.ID = ref.ID
+	playlist.SnapshotID = newShortID()
+	normalizePlaylistItems(&playlist)
+	err := config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(ref, playlist); err != nil {
+			return err
+		}
+		return tx.Create(snapshotRef(ref.ID, playlist.SnapshotID), playlistSnapshot(playlist, PlaylistEdit{By: playlist.UserID, Action: "create"}))
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	_, err = ref.Update(ctx, []firestore.Update{{Path: "id", Value: ref.ID}})
-	return ref.ID, err
+	indexDoc(playlistSearchDoc(playlist))
+	return &playlist, nil
 }
 
 func GetPlaylist(ctx context.Context, id string) (*models.Playlist, error) {
@@ -201,9 +345,42 @@ func GetPlaylist(ctx context.Context, id string) (*models.Playlist, error) {
 		return nil, err
 	}
 	pl.ID = doc.Ref.ID
+	normalizePlaylistItems(&pl)
 	return &pl, nil
 }
 
+// GetPlaylistsByIDs fetches playlists with batched gets, in the order of
+// ids; playlists that don't exist are left out
+func GetPlaylistsByIDs(ctx context.Context, ids []string) ([]models.Playlist, error) {
+	var refs []*firestore.DocumentRef
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == "" || strings.Contains(id, "/") || seen[id] {
+			continue
+		}
+		seen[id] = true
+		refs = append(refs, config.FirestoreClient.Collection("playlists").Doc(id))
+	}
+
+	playlists := make([]models.Playlist, 0, len(refs))
+	for start := 0; start < len(refs); start += maxBatchGet {
+		docs, err := config.FirestoreClient.GetAll(ctx, refs[start:min(start+maxBatchGet, len(refs))])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get playlists: %v", err)
+		}
+		for _, doc := range docs {
+			var pl models.Playlist
+			if !doc.Exists() || doc.DataTo(&pl) != nil {
+				continue
+			}
+			pl.ID = doc.Ref.ID
+			normalizePlaylistItems(&pl)
+			playlists = append(playlists, pl)
+		}
+	}
+	return playlists, nil
+}
+
 func GetUserPlaylists(ctx context.Context, userID string) ([]models.Playlist, error) {
 	iter := config.FirestoreClient.Collection("playlists").
 		Where("userId", "==", userID).
@@ -224,6 +401,7 @@ func GetUserPlaylists(ctx context.Context, userID string) ([]models.Playlist, er
 			continue
 		}
 		pl.ID = doc.Ref.ID
+		normalizePlaylistItems(&pl)
 		playlists = append(playlists, pl)
 	}
 	return playlists, nil
@@ -235,11 +413,19 @@ func UpdatePlaylist(ctx context.Context, id string, updates map[string]interface
 		updatePairs = append(updatePairs, firestore.Update{Path: k, Value: v})
 	}
 	_, err := config.FirestoreClient.Collection("playlists").Doc(id).Update(ctx, updatePairs)
+	if err == nil {
+		indexPlaylistByID(ctx, id)
+	}
 	return err
 }
 
 func DeletePlaylist(ctx context.Context, id string) error {
 	_, err := config.FirestoreClient.Collection("playlists").Doc(id).Delete(ctx)
+	if err == nil {
+		unindex("playlist", id)
+		go deletePlaylistSnapshots(context.Background(), id)
+		go deletePlaylistInvites(context.Background(), id)
+	}
 	return err
 }
 
@@ -247,6 +433,9 @@ func DeletePlaylist(ctx context.Context, id string) error {
 
 func CreateArtist(ctx context.Context, artist models.Artist) error {
 	_, err := config.FirestoreClient.Collection("artists").Doc(artist.UID).Set(ctx, artist)
+	if err == nil {
+		indexDoc(artistSearchDoc(artist))
+	}
 	return err
 }
 
@@ -262,33 +451,27 @@ func GetArtist(ctx context.Context, uid string) (*models.Artist, error) {
 	return &artist, nil
 }
 
-func GetArtists(ctx context.Context, status string, limit int) ([]models.Artist, error) {
-	col := config.FirestoreClient.Collection("artists")
-	var iter *firestore.DocumentIterator
-
+// ListArtists returns a page of artists, all or with the given status, in
+// the named sort order (see ArtistSorts)
+func ListArtists(ctx context.Context, status, sort, cursor string, limit int) ([]models.Artist, string, *int, error) {
+	q := config.FirestoreClient.Collection("artists").Query
 	if status != "" {
-		iter = col.Where("status", "==", status).Limit(limit).Documents(ctx)
-	} else {
-		iter = col.Limit(limit).Documents(ctx)
+		q = q.Where("status", "==", status)
 	}
-	defer iter.Stop()
-
-	var artists []models.Artist
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
+	docs, next, total, err := pageQuery(ctx, q, ArtistSorts, sort, cursor, limit, true, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	artists := make([]models.Artist, 0, len(docs))
+	for _, doc := range docs {
 		var artist models.Artist
 		if err := doc.DataTo(&artist); err != nil {
 			continue
 		}
+		artist.UID = doc.Ref.ID
 		artists = append(artists, artist)
 	}
-	return artists, nil
+	return artists, next, total, nil
 }
 
 func UpdateArtist(ctx context.Context, uid string, updates map[string]interface{}) error {
@@ -297,6 +480,9 @@ func UpdateArtist(ctx context.Context, uid string, updates map[string]interface{
 		updatePairs = append(updatePairs, firestore.Update{Path: k, Value: v})
 	}
 	_, err := config.FirestoreClient.Collection("artists").Doc(uid).Update(ctx, updatePairs)
+	if err == nil {
+		indexArtistByID(ctx, uid)
+	}
 	return err
 }
 
@@ -308,9 +494,20 @@ func CreateAlbum(ctx context.Context, album models.Album) (string, error) {
 		return "", err
 	}
 	_, err = ref.Update(ctx, []firestore.Update{{Path: "id", Value: ref.ID}})
+	album.ID = ref.ID
+	indexAlbum(ctx, album)
 	return ref.ID, err
 }
 
+func CreateAlbumWithID(ctx context.Context, id string, album models.Album) error {
+	_, err := config.FirestoreClient.Collection("albums").Doc(id).Set(ctx, album)
+	if err == nil {
+		album.ID = id
+		indexAlbum(ctx, album)
+	}
+	return err
+}
+
 func GetAlbum(ctx context.Context, id string) (*models.Album, error) {
 	doc, err := config.FirestoreClient.Collection("albums").Doc(id).Get(ctx)
 	if err != nil {
@@ -324,21 +521,16 @@ func GetAlbum(ctx context.Context, id string) (*models.Album, error) {
 	return &album, nil
 }
 
-func GetAlbumsByArtist(ctx context.Context, artistID string) ([]models.Album, error) {
-	iter := config.FirestoreClient.Collection("albums").
-		Where("artistId", "==", artistID).
-		Documents(ctx)
-	defer iter.Stop()
-
-	var albums []models.Album
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
+// GetAlbumsByArtist returns a page of an artist's albums in the named sort
+// order (see AlbumSorts)
+func GetAlbumsByArtist(ctx context.Context, artistID, sort, cursor string, limit int) ([]models.Album, string, *int, error) {
+	q := config.FirestoreClient.Collection("albums").Where("artistId", "==", artistID)
+	docs, next, total, err := pageQuery(ctx, q, AlbumSorts, sort, cursor, limit, true, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	albums := make([]models.Album, 0, len(docs))
+	for _, doc := range docs {
 		var album models.Album
 		if err := doc.DataTo(&album); err != nil {
 			continue
@@ -346,14 +538,82 @@ func GetAlbumsByArtist(ctx context.Context, artistID string) ([]models.Album, er
 		album.ID = doc.Ref.ID
 		albums = append(albums, album)
 	}
-	return albums, nil
+	return albums, next, total, nil
+}
+
+// ---- Track Mappings ----
+
+func GetTrackMapping(ctx context.Context, id string) (*models.TrackMapping, error) {
+	doc, err := config.FirestoreClient.Collection("trackMappings").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var m models.TrackMapping
+	if err := doc.DataTo(&m); err != nil {
+		return nil, err
+	}
+	m.ID = doc.Ref.ID
+	return &m, nil
+}
+
+// GetTrackMappingByISRC finds a mapping made for the same recording from any source
+func GetTrackMappingByISRC(ctx context.Context, isrc string) (*models.TrackMapping, error) {
+	iter := config.FirestoreClient.Collection("trackMappings").
+		Where("external.isrc", "==", isrc).
+		Limit(1).
+		Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err != nil {
+		return nil, err
+	}
+	var m models.TrackMapping
+	if err := doc.DataTo(&m); err != nil {
+		return nil, err
+	}
+	m.ID = doc.Ref.ID
+	return &m, nil
+}
+
+func SaveTrackMapping(ctx context.Context, m models.TrackMapping) error {
+	_, err := config.FirestoreClient.Collection("trackMappings").Doc(m.ID).Set(ctx, m)
+	return err
+}
+
+// ---- Import Jobs ----
+
+func CreateImportJob(ctx context.Context, job models.ImportJob) (string, error) {
+	ref, _, err := config.FirestoreClient.Collection("importJobs").Add(ctx, job)
+	if err != nil {
+		return "", err
+	}
+	_, err = ref.Update(ctx, []firestore.Update{{Path: "id", Value: ref.ID}})
+	return ref.ID, err
+}
+
+func GetImportJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	doc, err := config.FirestoreClient.Collection("importJobs").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var job models.ImportJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, err
+	}
+	job.ID = doc.Ref.ID
+	return &job, nil
 }
 
 // ---- Search ----
 
 func SearchSongs(ctx context.Context, queryStr string, limit int) ([]models.Song, error) {
-	// Firestore doesn't support full-text search natively,
-	// so we fetch approved songs and filter in memory
+	if searchReady.Load() {
+		return searchIndexedSongs(queryStr, limit), nil
+	}
+
+	// Firestore doesn't support full-text search natively, so until the
+	// index is loaded we fetch approved songs and filter in memory
 	iter := config.FirestoreClient.Collection("songs").
 		Where("status", "==", "approved").
 		Limit(200).
@@ -386,6 +646,10 @@ func SearchSongs(ctx context.Context, queryStr string, limit int) ([]models.Song
 }
 
 func SearchArtists(ctx context.Context, queryStr string, limit int) ([]models.Artist, error) {
+	if searchReady.Load() {
+		return searchIndexedArtists(queryStr, limit), nil
+	}
+
 	iter := config.FirestoreClient.Collection("artists").
 		Where("status", "==", "approved").
 		Limit(200).
@@ -415,30 +679,10 @@ func SearchArtists(ctx context.Context, queryStr string, limit int) ([]models.Ar
 	return artists, nil
 }
 
+// containsIgnoreCase reports whether substr occurs in s after Unicode case
+// folding and accent stripping
 func containsIgnoreCase(s, substr string) bool {
-	if len(substr) == 0 {
-		return true
-	}
-	sLower := toLower(s)
-	subLower := toLower(substr)
-	for i := 0; i <= len(sLower)-len(subLower); i++ {
-		if sLower[i:i+len(subLower)] == subLower {
-			return true
-		}
-	}
-	return false
-}
-
-func toLower(s string) string {
-	b := make([]byte, len(s))
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			c += 32
-		}
-		b[i] = c
-	}
-	return string(b)
+	return strings.Contains(foldText(s), foldText(substr))
 }
 
 // ---- Analytics ----
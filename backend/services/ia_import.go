@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"spotify-clone/models"
+)
+
+// Internet Archive item import
+// Turns an IA audio item into an album with one song per recording. Songs
+// reuse the IDs the resolver gives IA files, so tracks that were already
+// matched and played are enriched in place rather than duplicated.
+
+// ErrIAItemOwned is returned when another artist already imported the item
+var ErrIAItemOwned = errors.New("item already imported by another artist")
+
+// ErrIAItemNoAudio is returned for items without streamable audio files
+var ErrIAItemNoAudio = errors.New("item has no audio files")
+
+var (
+	iaIdentifierRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+	iaYearRe       = regexp.MustCompile(`\b(1[89]\d\d|20\d\d)\b`)
+)
+
+// IAImportOwner is who an imported item is attributed to
+type IAImportOwner struct {
+	ArtistID   string // empty for catalog imports
+	ArtistName string // used when IA has no creator
+	Status     string // status given to new songs
+}
+
+// ValidIAIdentifier reports whether s looks like an IA item identifier
+func ValidIAIdentifier(s string) bool {
+	return iaIdentifierRe.MatchString(s)
+}
+
+// ImportIAItem imports an IA item as an album of songs. Importing the same
+// item again refreshes its metadata. Songs that already exist, from an
+// earlier import or the resolver, keep their status and artist, so a
+// re-import doesn't send approved songs back to review or take over songs
+// the catalog already has.
+func ImportIAItem(ctx context.Context, identifier string, owner IAImportOwner) (*models.Album, []models.Song, error) {
+	meta, files, err := GetIAItem(identifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, ErrIAItemNoAudio
+	}
+
+	albumID := "ia-" + identifier
+	existing, err := GetAlbum(ctx, albumID)
+	if err == nil && existing.ArtistID != owner.ArtistID {
+		return nil, nil, ErrIAItemOwned
+	}
+
+	creator := meta.Creator.First()
+	if creator == "" {
+		creator = owner.ArtistName
+	}
+	title := meta.Title.First()
+	if title == "" {
+		title = identifier
+	}
+	tags := iaSubjects(meta.Subject)
+
+	album := models.Album{
+		ID:        albumID,
+		Title:     title,
+		ArtistID:  owner.ArtistID,
+		CoverURL:  fmt.Sprintf("https://archive.org/services/img/%s", identifier),
+		Year:      iaYear(meta.Date),
+		SongCount: len(files),
+		CreatedAt: time.Now(),
+	}
+	if existing != nil {
+		album.CreatedAt = existing.CreatedAt
+	}
+
+	ids := make([]string, len(files))
+	for i, f := range files {
+		ids[i] = iaSongID(identifier + "/" + f.Name)
+	}
+	prevSongs, _, err := GetSongsByIDs(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	prevByID := make(map[string]models.Song, len(prevSongs))
+	for _, prev := range prevSongs {
+		prevByID[prev.ID] = prev
+	}
+
+	songs := make([]models.Song, 0, len(files))
+	for i, f := range files {
+		song := models.Song{
+			ID:         ids[i],
+			Title:      strings.TrimSpace(f.Title),
+			ArtistID:   owner.ArtistID,
+			ArtistName: creator,
+			AlbumID:    albumID,
+			AlbumName:  title,
+			CoverURL:   album.CoverURL,
+			AudioURL:   GetIAStreamURL(identifier, f.Name),
+			Source:     "ia",
+			Duration:   ParseIALength(f.Length),
+			Status:     owner.Status,
+			Tags:       tags,
+			License:    meta.LicenseURL,
+			CreatedAt:  time.Now(),
+		}
+		if song.Title == "" {
+			song.Title = strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+		}
+		if f.Creator != "" {
+			song.ArtistName = strings.TrimSpace(f.Creator)
+		}
+		if len(tags) > 0 {
+			song.Genre = tags[0]
+		}
+		// Keep the history, status and owner of songs that already exist
+		if prev, ok := prevByID[song.ID]; ok {
+			song.PlayCount = prev.PlayCount
+			song.Featured = prev.Featured
+			song.CreatedAt = prev.CreatedAt
+			song.Status = prev.Status
+			song.ArtistID = prev.ArtistID
+		}
+		if err := CreateSongWithID(ctx, song.ID, song); err != nil {
+			return nil, nil, fmt.Errorf("failed to save song %q: %v", f.Name, err)
+		}
+		songs = append(songs, song)
+	}
+
+	if err := CreateAlbumWithID(ctx, albumID, album); err != nil {
+		return nil, nil, fmt.Errorf("failed to save album: %v", err)
+	}
+	return &album, songs, nil
+}
+
+// iaSubjects splits subject tags, which items give either as a list or as a
+// single ";"-separated string
+func iaSubjects(subjects iaStrings) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, s := range subjects {
+		for _, tag := range strings.Split(s, ";") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// iaYear extracts the year from dates like "1977-05-08", "1977" or "c. 1930"
+func iaYear(date string) int {
+	year, _ := strconv.Atoi(iaYearRe.FindString(date))
+	return year
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Instance pool for community-run API mirrors (Piped, Invidious)
+// Requests rotate round-robin across healthy instances. An instance that
+// errors is put on a cooldown that doubles with each consecutive failure and
+// is only retried once every healthy instance has been tried.
+
+const (
+	instanceBaseCooldown = 30 * time.Second
+	instanceMaxCooldown  = 10 * time.Minute
+)
+
+// ErrNoInstances is returned when a pool has no configured instances
+var ErrNoInstances = errors.New("no instances configured")
+
+// errInstanceNotFound marks a definitive 4xx answer that retrying elsewhere won't fix
+var errInstanceNotFound = errors.New("not found")
+
+// InstanceStatus is reported by the health endpoint
+type InstanceStatus struct {
+	URL         string    `json:"url"`
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"failures"`
+	DownUntil   time.Time `json:"downUntil"`
+	LastError   string    `json:"lastError,omitempty"`
+	LatencyMs   int64     `json:"latencyMs"`
+	LastSuccess time.Time `json:"lastSuccess"`
+}
+
+type apiInstance struct {
+	baseURL     string
+	failures    int
+	downUntil   time.Time
+	lastError   string
+	latency     time.Duration
+	lastSuccess time.Time
+}
+
+type instancePool struct {
+	name      string
+	client    *http.Client
+	mu        sync.Mutex
+	instances []*apiInstance
+	next      int
+}
+
+func newInstancePool(name string, baseURLs []string, client *http.Client) *instancePool {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	p := &instancePool{name: name, client: client}
+	for _, u := range baseURLs {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u != "" {
+			p.instances = append(p.instances, &apiInstance{baseURL: u})
+		}
+	}
+	return p
+}
+
+// instancesFromEnv splits a comma-separated list of base URLs
+func instancesFromEnv(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// candidates returns instances in the order they should be tried: healthy
+// ones starting from the rotation cursor, then cooling-down ones soonest first
+func (p *instancePool) candidates() []*apiInstance {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	n := len(p.instances)
+	var healthy, down []*apiInstance
+	for i := 0; i < n; i++ {
+		inst := p.instances[(p.next+i)%n]
+		if now.Before(inst.downUntil) {
+			down = append(down, inst)
+		} else {
+			healthy = append(healthy, inst)
+		}
+	}
+	if n > 0 {
+		p.next = (p.next + 1) % n
+	}
+	for i := 1; i < len(down); i++ {
+		for j := i; j > 0 && down[j].downUntil.Before(down[j-1].downUntil); j-- {
+			down[j], down[j-1] = down[j-1], down[j]
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (p *instancePool) markSuccess(inst *apiInstance, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	inst.failures = 0
+	inst.downUntil = time.Time{}
+	inst.lastError = ""
+	inst.latency = latency
+	inst.lastSuccess = time.Now()
+}
+
+func (p *instancePool) markFailure(inst *apiInstance, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	inst.failures++
+	cooldown := instanceBaseCooldown << (inst.failures - 1)
+	if cooldown > instanceMaxCooldown || cooldown <= 0 {
+		cooldown = instanceMaxCooldown
+	}
+	inst.downUntil = time.Now().Add(cooldown)
+	inst.lastError = err.Error()
+	slog.Warn("api instance failed", "pool", p.name, "instance", inst.baseURL, "failures", inst.failures, "cooldown", cooldown, "err", err)
+}
+
+// getJSON fetches path from the first instance that answers and decodes it
+// into out. Network errors, 5xx, 429 and undecodable bodies fail over to the
+// next instance; other 4xx answers are returned as-is.
+func (p *instancePool) getJSON(ctx context.Context, path string, out interface{}) error {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return fmt.Errorf("%s: %w", p.name, ErrNoInstances)
+	}
+
+	var lastErr error
+	for _, inst := range candidates {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		start := time.Now()
+		err := p.fetch(ctx, inst.baseURL+path, out)
+		if err == nil {
+			p.markSuccess(inst, time.Since(start))
+			return nil
+		}
+		if errors.Is(err, errInstanceNotFound) {
+			return fmt.Errorf("%s: %w", p.name, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.markFailure(inst, err)
+		lastErr = err
+	}
+	return fmt.Errorf("%s: all instances failed: %v", p.name, lastErr)
+}
+
+func (p *instancePool) fetch(ctx context.Context, fullURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("status %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("status %d: %w", resp.StatusCode, errInstanceNotFound)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode: %v", err)
+	}
+	return nil
+}
+
+// Status reports the health of every instance
+func (p *instancePool) Status() []InstanceStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]InstanceStatus, 0, len(p.instances))
+	for _, inst := range p.instances {
+		statuses = append(statuses, InstanceStatus{
+			URL:         inst.baseURL,
+			Healthy:     !now.Before(inst.downUntil),
+			Failures:    inst.failures,
+			DownUntil:   inst.downUntil,
+			LastError:   inst.lastError,
+			LatencyMs:   inst.latency.Milliseconds(),
+			LastSuccess: inst.lastSuccess,
+		})
+	}
+	return statuses
+}
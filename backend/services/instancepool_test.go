@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubInstance serves a fixed status and body and counts its requests
+func stubInstance(t *testing.T, status int, body string) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestInstancePoolFailsOver(t *testing.T) {
+	down, downHits := stubInstance(t, http.StatusBadGateway, "")
+	up, upHits := stubInstance(t, http.StatusOK, `{"ok":true}`)
+	pool := newInstancePool("test", []string{down.URL, up.URL}, nil)
+
+	var out struct{ OK bool }
+	if err := pool.getJSON(context.Background(), "/x", &out); err != nil {
+		t.Fatalf("getJSON: %v", err)
+	}
+	if !out.OK {
+		t.Fatal("response not decoded")
+	}
+	if *downHits != 1 || *upHits != 1 {
+		t.Fatalf("hits = %d, %d; want 1, 1", *downHits, *upHits)
+	}
+
+	st := pool.Status()
+	if st[0].Healthy || st[0].Failures != 1 || st[0].LastError == "" {
+		t.Errorf("failed instance status = %+v", st[0])
+	}
+	if !st[1].Healthy || st[1].LastSuccess.IsZero() {
+		t.Errorf("working instance status = %+v", st[1])
+	}
+}
+
+func TestInstancePoolCooldown(t *testing.T) {
+	down, downHits := stubInstance(t, http.StatusTooManyRequests, "")
+	up, _ := stubInstance(t, http.StatusOK, `{}`)
+	pool := newInstancePool("test", []string{down.URL, up.URL}, nil)
+
+	for i := 0; i < 4; i++ {
+		var out struct{}
+		if err := pool.getJSON(context.Background(), "/x", &out); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	// Cooling down, the failed instance is only tried after the healthy one
+	if *downHits != 1 {
+		t.Errorf("instance on cooldown was tried %d times, want 1", *downHits)
+	}
+
+	inst := pool.instances[0]
+	if d := time.Until(inst.downUntil); d <= 0 || d > instanceBaseCooldown {
+		t.Errorf("cooldown = %v, want up to %v", d, instanceBaseCooldown)
+	}
+	pool.markFailure(inst, errors.New("again"))
+	if d := time.Until(inst.downUntil); d <= instanceBaseCooldown {
+		t.Errorf("second cooldown = %v, want it doubled", d)
+	}
+	pool.markSuccess(inst, time.Millisecond)
+	if !pool.Status()[0].Healthy {
+		t.Error("instance still down after a success")
+	}
+}
+
+func TestInstancePoolRetriesInstancesOnCooldown(t *testing.T) {
+	srv, hits := stubInstance(t, http.StatusOK, `{}`)
+	pool := newInstancePool("test", []string{srv.URL}, nil)
+	pool.markFailure(pool.instances[0], errors.New("down"))
+
+	var out struct{}
+	if err := pool.getJSON(context.Background(), "/x", &out); err != nil {
+		t.Fatalf("getJSON: %v", err)
+	}
+	if *hits != 1 {
+		t.Fatalf("hits = %d, want 1", *hits)
+	}
+}
+
+func TestInstancePoolNotFoundDoesNotFailOver(t *testing.T) {
+	missing, _ := stubInstance(t, http.StatusNotFound, "")
+	other, otherHits := stubInstance(t, http.StatusOK, `{}`)
+	pool := newInstancePool("test", []string{missing.URL, other.URL}, nil)
+
+	var out struct{}
+	err := pool.getJSON(context.Background(), "/x", &out)
+	if !errors.Is(err, errInstanceNotFound) {
+		t.Fatalf("err = %v, want errInstanceNotFound", err)
+	}
+	if *otherHits != 0 {
+		t.Error("a 404 was retried on another instance")
+	}
+	if !pool.Status()[0].Healthy {
+		t.Error("a 404 put the instance on cooldown")
+	}
+}
+
+func TestInstancePoolAllFailing(t *testing.T) {
+	a, _ := stubInstance(t, http.StatusInternalServerError, "")
+	b, _ := stubInstance(t, http.StatusOK, `not json`)
+	pool := newInstancePool("test", []string{a.URL, b.URL}, nil)
+
+	var out struct{}
+	if err := pool.getJSON(context.Background(), "/x", &out); err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, st := range pool.Status() {
+		if st.Healthy {
+			t.Errorf("%s still healthy", st.URL)
+		}
+	}
+
+	empty := newInstancePool("test", nil, nil)
+	if err := empty.getJSON(context.Background(), "/x", &out); !errors.Is(err, ErrNoInstances) {
+		t.Errorf("err = %v, want ErrNoInstances", err)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,11 +15,9 @@ import (
 // No API key required!
 
 type IASearchResult struct {
-	ResponseHeader struct {
-		NumFound int `json:"numFound"`
-	} `json:"response"`
 	Response struct {
-		Docs []IAItem `json:"docs"`
+		NumFound int      `json:"numFound"`
+		Docs     []IAItem `json:"docs"`
 	} `json:"response"`
 }
 
@@ -36,11 +37,61 @@ type IAFileMetadata struct {
 }
 
 type IAFile struct {
-	Name   string `json:"name"`
-	Format string `json:"format"`
-	Size   string `json:"size"`
-	Length string `json:"length"`
-	Title  string `json:"title"`
+	Name     string `json:"name"`
+	Format   string `json:"format"`
+	Size     string `json:"size"`
+	Length   string `json:"length"`
+	Title    string `json:"title"`
+	Creator  string `json:"creator,omitempty"`
+	Track    string `json:"track,omitempty"`
+	Source   string `json:"source,omitempty"`   // original, derivative
+	Original string `json:"original,omitempty"` // file a derivative was made from
+}
+
+// IAItemMetadata is the descriptive metadata of an item
+type IAItemMetadata struct {
+	Identifier  string    `json:"identifier"`
+	Title       iaStrings `json:"title"`
+	Creator     iaStrings `json:"creator"`
+	Date        string    `json:"date"`
+	LicenseURL  string    `json:"licenseurl"`
+	Subject     iaStrings `json:"subject"`
+	Description iaStrings `json:"description"`
+}
+
+// iaStrings decodes metadata fields that IA returns either as a string or
+// as an array of strings
+type iaStrings []string
+
+func (s *iaStrings) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = iaStrings{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+// First returns the first value, or "" if there is none
+func (s iaStrings) First() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(s[0])
+}
+
+// iaAudioFormats ranks the audio formats we stream, most preferred first
+var iaAudioFormats = map[string]int{
+	"VBR MP3":     0,
+	"MP3":         1,
+	"128Kbps MP3": 2,
+	"Ogg Vorbis":  3,
+	"Flac":        4,
 }
 
 var iaClient = &http.Client{Timeout: 15 * time.Second}
@@ -57,11 +108,7 @@ func SearchInternetArchive(query string, limit int) ([]IAItem, error) {
 	}
 	defer resp.Body.Close()
 
-	var result struct {
-		Response struct {
-			Docs []IAItem `json:"docs"`
-		} `json:"response"`
-	}
+	var result IASearchResult
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to decode IA response: %v", err)
 	}
@@ -88,8 +135,7 @@ func GetIAItemFiles(identifier string) ([]IAFile, error) {
 	// Filter to audio files only
 	var audioFiles []IAFile
 	for _, f := range result.Result {
-		switch f.Format {
-		case "VBR MP3", "MP3", "128Kbps MP3", "Ogg Vorbis", "Flac":
+		if _, ok := iaAudioFormats[f.Format]; ok {
 			audioFiles = append(audioFiles, f)
 		}
 	}
@@ -97,6 +143,106 @@ func GetIAItemFiles(identifier string) ([]IAFile, error) {
 	return audioFiles, nil
 }
 
+// GetIAItem fetches an item's metadata and its audio tracks. Derivatives of
+// the same recording are collapsed to the most streamable format, and tracks
+// are ordered by track number, then file name.
+func GetIAItem(identifier string) (*IAItemMetadata, []IAFile, error) {
+	apiURL := fmt.Sprintf("https://archive.org/metadata/%s", url.PathEscape(identifier))
+
+	resp, err := iaClient.Get(apiURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("IA metadata error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Metadata *IAItemMetadata `json:"metadata"`
+		Files    []IAFile        `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode IA item metadata: %v", err)
+	}
+	// Unknown identifiers come back as an empty object
+	if result.Metadata == nil {
+		return nil, nil, fmt.Errorf("IA item %q not found", identifier)
+	}
+
+	best := make(map[string]IAFile)
+	var order []string
+	for _, f := range result.Files {
+		rank, ok := iaAudioFormats[f.Format]
+		if !ok {
+			continue
+		}
+		key := f.Name
+		if f.Source == "derivative" && f.Original != "" {
+			key = f.Original
+		}
+		current, seen := best[key]
+		if !seen {
+			order = append(order, key)
+		}
+		if seen && rank >= iaAudioFormats[current.Format] {
+			f, current = current, f
+		}
+		// Derivatives often lack the original's tags
+		if f.Title == "" {
+			f.Title = current.Title
+		}
+		if f.Creator == "" {
+			f.Creator = current.Creator
+		}
+		if f.Track == "" {
+			f.Track = current.Track
+		}
+		if f.Length == "" {
+			f.Length = current.Length
+		}
+		best[key] = f
+	}
+
+	tracks := make([]IAFile, 0, len(order))
+	for _, key := range order {
+		tracks = append(tracks, best[key])
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		ti, tj := iaTrackNumber(tracks[i].Track), iaTrackNumber(tracks[j].Track)
+		if ti != tj {
+			return ti < tj
+		}
+		return tracks[i].Name < tracks[j].Name
+	})
+	return result.Metadata, tracks, nil
+}
+
+// iaTrackNumber parses "3" or "3/12"; files without one sort last
+func iaTrackNumber(track string) int {
+	track, _, _ = strings.Cut(track, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(track))
+	if err != nil || n <= 0 {
+		return 1 << 30
+	}
+	return n
+}
+
+// ParseIALength converts a file's length, given either in seconds ("245.32")
+// or as "m:ss"/"h:mm:ss", to whole seconds. It returns 0 when unknown.
+func ParseIALength(length string) int {
+	length = strings.TrimSpace(length)
+	if length == "" {
+		return 0
+	}
+	total := 0.0
+	for _, part := range strings.Split(length, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + v
+	}
+	return int(total + 0.5)
+}
+
 // GetIAStreamURL returns a direct streaming URL for an Internet Archive file
 func GetIAStreamURL(identifier, filename string) string {
 	return fmt.Sprintf("https://archive.org/download/%s/%s", identifier, url.PathEscape(filename))
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Invidious API - alternative YouTube frontend with a public JSON API
+// Instances are community-run, so requests fail over across INVIDIOUS_INSTANCES
+// Docs: https://docs.invidious.io/api/
+
+type InvidiousVideo struct {
+	Type            string               `json:"type"`
+	VideoID         string               `json:"videoId"`
+	Title           string               `json:"title"`
+	Author          string               `json:"author"`
+	LengthSeconds   int                  `json:"lengthSeconds"`
+	ViewCount       int64                `json:"viewCount"`
+	VideoThumbnails []InvidiousThumbnail `json:"videoThumbnails"`
+	AdaptiveFormats []InvidiousFormat    `json:"adaptiveFormats"`
+}
+
+type InvidiousThumbnail struct {
+	Quality string `json:"quality"`
+	URL     string `json:"url"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+type InvidiousFormat struct {
+	URL     string      `json:"url"`
+	Type    string      `json:"type"`    // "audio/mp4; codecs=\"mp4a.40.2\""
+	Bitrate json.Number `json:"bitrate"` // sent as a string by most instances
+}
+
+// InvidiousClient talks to a pool of Invidious instances
+type InvidiousClient struct {
+	pool *instancePool
+}
+
+var (
+	invidiousClient     *InvidiousClient
+	invidiousClientOnce sync.Once
+)
+
+// NewInvidiousClient creates a client for the given instance base URLs
+// (e.g. "https://yewtu.be"). A nil httpClient uses a 10s timeout.
+func NewInvidiousClient(instances []string, httpClient *http.Client) *InvidiousClient {
+	return &InvidiousClient{pool: newInstancePool("invidious", instances, httpClient)}
+}
+
+// getInvidiousClient returns the shared client configured from INVIDIOUS_INSTANCES
+func getInvidiousClient() *InvidiousClient {
+	invidiousClientOnce.Do(func() {
+		invidiousClient = NewInvidiousClient(instancesFromEnv("INVIDIOUS_INSTANCES"), nil)
+	})
+	return invidiousClient
+}
+
+func (c *InvidiousClient) Name() string { return "invidious" }
+
+// Configured reports whether any instances are set up
+func (c *InvidiousClient) Configured() bool { return len(c.pool.instances) > 0 }
+
+func (c *InvidiousClient) Search(ctx context.Context, query string, limit int) ([]PipedTrack, error) {
+	var results []InvidiousVideo
+	path := "/api/v1/search?type=video&q=" + url.QueryEscape(query)
+	if err := c.pool.getJSON(ctx, path, &results); err != nil {
+		return nil, err
+	}
+
+	var tracks []PipedTrack
+	for _, v := range results {
+		if v.VideoID == "" || (v.Type != "" && v.Type != "video") {
+			continue
+		}
+		tracks = append(tracks, invidiousToTrack(v))
+		if len(tracks) >= limit {
+			break
+		}
+	}
+	return tracks, nil
+}
+
+// Trending returns the music trending chart for a region
+func (c *InvidiousClient) Trending(ctx context.Context, region string, limit int) ([]PipedTrack, error) {
+	var results []InvidiousVideo
+	path := "/api/v1/trending?type=music&region=" + url.QueryEscape(region)
+	if err := c.pool.getJSON(ctx, path, &results); err != nil {
+		return nil, err
+	}
+
+	var tracks []PipedTrack
+	for _, v := range results {
+		if v.VideoID == "" {
+			continue
+		}
+		tracks = append(tracks, invidiousToTrack(v))
+		if len(tracks) >= limit {
+			break
+		}
+	}
+	return tracks, nil
+}
+
+// Playlist lists every video in a playlist, following its pages
+func (c *InvidiousClient) Playlist(ctx context.Context, playlistID string) (*YouTubePlaylist, error) {
+	playlist := &YouTubePlaylist{}
+	seen := make(map[string]bool)
+	for page := 1; page <= 50; page++ {
+		var result struct {
+			Title      string           `json:"title"`
+			VideoCount int              `json:"videoCount"`
+			Videos     []InvidiousVideo `json:"videos"`
+		}
+		path := fmt.Sprintf("/api/v1/playlists/%s?page=%d", url.PathEscape(playlistID), page)
+		if err := c.pool.getJSON(ctx, path, &result); err != nil {
+			if page > 1 {
+				break
+			}
+			return nil, err
+		}
+		playlist.Title = result.Title
+
+		added := 0
+		for _, v := range result.Videos {
+			if v.VideoID == "" || seen[v.VideoID] {
+				continue
+			}
+			seen[v.VideoID] = true
+			playlist.Tracks = append(playlist.Tracks, invidiousToTrack(v))
+			added++
+		}
+		if added == 0 || len(playlist.Tracks) >= result.VideoCount {
+			break
+		}
+	}
+	return playlist, nil
+}
+
+func (c *InvidiousClient) AudioStream(ctx context.Context, videoID string) (*PipedStreamInfo, error) {
+	var video InvidiousVideo
+	if err := c.pool.getJSON(ctx, "/api/v1/videos/"+url.PathEscape(videoID), &video); err != nil {
+		return nil, err
+	}
+
+	info := &PipedStreamInfo{
+		Title:     video.Title,
+		Uploader:  video.Author,
+		Thumbnail: bestInvidiousThumbnail(video.VideoThumbnails),
+		Duration:  video.LengthSeconds,
+	}
+	for _, f := range video.AdaptiveFormats {
+		if !strings.HasPrefix(f.Type, "audio/") || f.URL == "" {
+			continue
+		}
+		bitrate, _ := f.Bitrate.Int64()
+		info.AudioStreams = append(info.AudioStreams, PipedAudioStream{
+			URL:      f.URL,
+			MimeType: f.Type,
+			Bitrate:  int(bitrate),
+		})
+	}
+	if len(info.AudioStreams) == 0 {
+		return nil, fmt.Errorf("invidious: no audio streams for %s", videoID)
+	}
+
+	streams := info.AudioStreams
+	for i := 1; i < len(streams); i++ {
+		for j := i; j > 0 && betterAudioStream(streams[j], streams[j-1]); j-- {
+			streams[j], streams[j-1] = streams[j-1], streams[j]
+		}
+	}
+	return info, nil
+}
+
+// InstanceStatus reports the health of every configured instance
+func (c *InvidiousClient) InstanceStatus() []InstanceStatus {
+	return c.pool.Status()
+}
+
+func invidiousToTrack(v InvidiousVideo) PipedTrack {
+	return PipedTrack{
+		VideoID:   v.VideoID,
+		Title:     v.Title,
+		Artist:    v.Author,
+		Thumbnail: bestInvidiousThumbnail(v.VideoThumbnails),
+		Duration:  v.LengthSeconds,
+		Views:     v.ViewCount,
+	}
+}
+
+// bestInvidiousThumbnail prefers "high" quality, else the widest
+func bestInvidiousThumbnail(thumbs []InvidiousThumbnail) string {
+	best := ""
+	bestWidth := -1
+	for _, t := range thumbs {
+		if t.Quality == "high" {
+			return t.URL
+		}
+		if t.Width > bestWidth {
+			best, bestWidth = t.URL, t.Width
+		}
+	}
+	return best
+}
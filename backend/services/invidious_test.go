@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInvidiousAudioStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/videos/5NV6Rdv1a3I" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"title":"Get Lucky","author":"Daft Punk","lengthSeconds":369,
+			"videoThumbnails":[{"quality":"default","url":"https://i/d","width":120},{"quality":"high","url":"https://i/h","width":480}],
+			"adaptiveFormats":[
+				{"url":"https://v/video","type":"video/mp4","bitrate":"900000"},
+				{"url":"https://v/opus","type":"audio/webm; codecs=\"opus\"","bitrate":"160000"},
+				{"url":"https://v/m4a","type":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":"128000"}
+			]}`))
+	}))
+	defer srv.Close()
+
+	client := NewInvidiousClient([]string{srv.URL}, nil)
+	info, err := client.AudioStream(context.Background(), "5NV6Rdv1a3I")
+	if err != nil {
+		t.Fatalf("AudioStream: %v", err)
+	}
+	if info.Thumbnail != "https://i/h" || info.Uploader != "Daft Punk" {
+		t.Errorf("info = %+v", info)
+	}
+	if len(info.AudioStreams) != 2 || info.AudioStreams[0].URL != "https://v/m4a" || info.AudioStreams[0].Bitrate != 128000 {
+		t.Errorf("streams = %+v", info.AudioStreams)
+	}
+
+	if _, err := client.AudioStream(context.Background(), "missing0000"); err == nil {
+		t.Error("expected an error for an unknown video")
+	}
+	if !client.InstanceStatus()[0].Healthy {
+		t.Error("a 404 put the instance on cooldown")
+	}
+}
@@ -2,116 +2,361 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"spotify-clone/models"
 )
 
 // Jamendo API - Free music with Creative Commons licenses
 // Register at https://devportal.jamendo.com for a free Client ID
 
 type JamendoTrack struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Duration    int    `json:"duration"`
-	ArtistID    string `json:"artist_id"`
-	ArtistName  string `json:"artist_name"`
-	AlbumName   string `json:"album_name"`
-	AlbumImage  string `json:"album_image"`
-	Audio       string `json:"audio"`
-	AudioDownload string `json:"audiodownload"`
-	Image       string `json:"image"`
-	ShareURL    string `json:"shareurl"`
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Duration      jamendoInt        `json:"duration"`
+	Position      jamendoInt        `json:"position,omitempty"`
+	ArtistID      string            `json:"artist_id"`
+	ArtistName    string            `json:"artist_name"`
+	AlbumID       string            `json:"album_id"`
+	AlbumName     string            `json:"album_name"`
+	AlbumImage    string            `json:"album_image"`
+	ReleaseDate   string            `json:"releasedate,omitempty"`
+	Audio         string            `json:"audio"`
+	AudioDownload string            `json:"audiodownload"`
+	Image         string            `json:"image"`
+	ShareURL      string            `json:"shareurl"`
+	LicenseURL    string            `json:"license_ccurl"`
+	MusicInfo     *JamendoMusicInfo `json:"musicinfo,omitempty"`
+}
+
+// JamendoMusicInfo describes how a track sounds
+type JamendoMusicInfo struct {
+	VocalInstrumental string `json:"vocalinstrumental"` // vocal, instrumental
+	Lang              string `json:"lang"`
+	Gender            string `json:"gender"`           // male, female
+	AcousticElectric  string `json:"acousticelectric"` // acoustic, electric
+	Speed             string `json:"speed"`            // verylow, low, medium, high, veryhigh
+	Tags              struct {
+		Genres      []string `json:"genres"`
+		Instruments []string `json:"instruments"`
+		Vartags     []string `json:"vartags"`
+	} `json:"tags"`
+}
+
+// UnmarshalJSON ignores musicinfo given as an empty array instead of an object
+func (m *JamendoMusicInfo) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '{' {
+		return nil
+	}
+	type plain JamendoMusicInfo
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// jamendoInt decodes numbers that some endpoints return as strings
+type jamendoInt int
+
+func (n *jamendoInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*n = jamendoInt(v)
+	return nil
+}
+
+type JamendoArtist struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Website  string `json:"website"`
+	JoinDate string `json:"joindate"`
+	Image    string `json:"image"`
+	ShareURL string `json:"shareurl"`
+}
+
+type JamendoAlbum struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	ReleaseDate string         `json:"releasedate"`
+	ArtistID    string         `json:"artist_id"`
+	ArtistName  string         `json:"artist_name"`
+	Image       string         `json:"image"`
+	ShareURL    string         `json:"shareurl"`
+	Tracks      []JamendoTrack `json:"tracks,omitempty"`
+}
+
+type JamendoPlaylist struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	CreationDate string         `json:"creationdate"`
+	UserID       string         `json:"user_id"`
+	UserName     string         `json:"user_name"`
+	ShareURL     string         `json:"shareurl"`
+	Tracks       []JamendoTrack `json:"tracks,omitempty"`
+}
+
+type JamendoRadio struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DispName   string `json:"dispname"`
+	Type       string `json:"type"`
+	Image      string `json:"image"`
+	Stream     string `json:"stream,omitempty"`
+	PlayingNow *struct {
+		TrackID    string `json:"track_id"`
+		TrackName  string `json:"track_name"`
+		ArtistID   string `json:"artist_id"`
+		ArtistName string `json:"artist_name"`
+		AlbumID    string `json:"album_id"`
+		AlbumName  string `json:"album_name"`
+		TrackImage string `json:"track_image"`
+	} `json:"playingnow,omitempty"`
 }
 
 type JamendoResponse struct {
 	Headers struct {
-		Status      string `json:"status"`
-		Code        int    `json:"code"`
-		ResultCount int    `json:"results_count"`
+		Status       string `json:"status"`
+		Code         int    `json:"code"`
+		ErrorMessage string `json:"error_message"`
+		ResultCount  int    `json:"results_count"`
 	} `json:"headers"`
-	Results []JamendoTrack `json:"results"`
+	Results json.RawMessage `json:"results"`
 }
 
 var jamendoClient = &http.Client{Timeout: 10 * time.Second}
 
+// ErrJamendoNotFound is returned when a Jamendo ID matches nothing
+var ErrJamendoNotFound = errors.New("not found on jamendo")
+
 func getJamendoClientID() string {
 	return os.Getenv("JAMENDO_CLIENT_ID")
 }
 
-func SearchJamendo(query string, limit int) ([]JamendoTrack, error) {
+// jamendoGet calls a v3.0 endpoint and decodes its results into out
+func jamendoGet(endpoint string, params url.Values, out interface{}) error {
 	clientID := getJamendoClientID()
 	if clientID == "" {
-		return nil, fmt.Errorf("JAMENDO_CLIENT_ID not set")
+		return fmt.Errorf("JAMENDO_CLIENT_ID not set")
 	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("client_id", clientID)
+	params.Set("format", "json")
 
-	apiURL := fmt.Sprintf(
-		"https://api.jamendo.com/v3.0/tracks/?client_id=%s&format=json&limit=%d&namesearch=%s&include=musicinfo&audioformat=mp32",
-		clientID, limit, url.QueryEscape(query),
-	)
-
-	resp, err := jamendoClient.Get(apiURL)
+	resp, err := jamendoClient.Get("https://api.jamendo.com/v3.0/" + endpoint + "/?" + params.Encode())
 	if err != nil {
-		return nil, fmt.Errorf("jamendo API error: %v", err)
+		return fmt.Errorf("jamendo API error: %v", err)
 	}
 	defer resp.Body.Close()
 
 	var result JamendoResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode jamendo response: %v", err)
+		return fmt.Errorf("failed to decode jamendo response: %v", err)
+	}
+	if result.Headers.Status == "failed" {
+		return fmt.Errorf("jamendo API error %d: %s", result.Headers.Code, result.Headers.ErrorMessage)
+	}
+	if err := json.Unmarshal(result.Results, out); err != nil {
+		return fmt.Errorf("failed to decode jamendo results: %v", err)
 	}
+	return nil
+}
+
+// jamendoTracks queries /tracks with musicinfo and license details included
+func jamendoTracks(params url.Values) ([]JamendoTrack, error) {
+	params.Set("include", "musicinfo licenses")
+	params.Set("audioformat", "mp32")
+	var tracks []JamendoTrack
+	if err := jamendoGet("tracks", params, &tracks); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
 
-	return result.Results, nil
+func SearchJamendo(query string, limit int) ([]JamendoTrack, error) {
+	return jamendoTracks(url.Values{
+		"namesearch": {query},
+		"limit":      {strconv.Itoa(limit)},
+	})
 }
 
 func GetJamendoTrending(limit int) ([]JamendoTrack, error) {
-	clientID := getJamendoClientID()
-	if clientID == "" {
-		return nil, fmt.Errorf("JAMENDO_CLIENT_ID not set")
-	}
+	return jamendoTracks(url.Values{
+		"order": {"popularity_total"},
+		"limit": {strconv.Itoa(limit)},
+	})
+}
 
-	apiURL := fmt.Sprintf(
-		"https://api.jamendo.com/v3.0/tracks/?client_id=%s&format=json&limit=%d&order=popularity_total&audioformat=mp32",
-		clientID, limit,
-	)
+func GetJamendoByGenre(genre string, limit int) ([]JamendoTrack, error) {
+	return jamendoTracks(url.Values{
+		"tags":  {genre},
+		"limit": {strconv.Itoa(limit)},
+	})
+}
 
-	resp, err := jamendoClient.Get(apiURL)
+// GetJamendoTrack fetches a single track by ID
+func GetJamendoTrack(id string) (*JamendoTrack, error) {
+	tracks, err := jamendoTracks(url.Values{"id": {id}})
 	if err != nil {
-		return nil, fmt.Errorf("jamendo API error: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if len(tracks) == 0 {
+		return nil, ErrJamendoNotFound
+	}
+	return &tracks[0], nil
+}
 
-	var result JamendoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+// GetJamendoArtist fetches an artist by ID
+func GetJamendoArtist(id string) (*JamendoArtist, error) {
+	var artists []JamendoArtist
+	if err := jamendoGet("artists", url.Values{"id": {id}}, &artists); err != nil {
+		return nil, err
+	}
+	if len(artists) == 0 {
+		return nil, ErrJamendoNotFound
 	}
+	return &artists[0], nil
+}
 
-	return result.Results, nil
+// GetJamendoArtistTracks returns an artist's most popular tracks
+func GetJamendoArtistTracks(artistID string, limit int) ([]JamendoTrack, error) {
+	return jamendoTracks(url.Values{
+		"artist_id": {artistID},
+		"order":     {"popularity_total"},
+		"limit":     {strconv.Itoa(limit)},
+	})
 }
 
-func GetJamendoByGenre(genre string, limit int) ([]JamendoTrack, error) {
-	clientID := getJamendoClientID()
-	if clientID == "" {
-		return nil, fmt.Errorf("JAMENDO_CLIENT_ID not set")
+// GetJamendoArtistAlbums returns an artist's albums, newest first
+func GetJamendoArtistAlbums(artistID string, limit int) ([]JamendoAlbum, error) {
+	var albums []JamendoAlbum
+	err := jamendoGet("albums", url.Values{
+		"artist_id": {artistID},
+		"order":     {"releasedate_desc"},
+		"limit":     {strconv.Itoa(limit)},
+	}, &albums)
+	return albums, err
+}
+
+// GetJamendoAlbum fetches an album with its tracks in album order
+func GetJamendoAlbum(id string) (*JamendoAlbum, error) {
+	var albums []JamendoAlbum
+	err := jamendoGet("albums/tracks", url.Values{
+		"id":          {id},
+		"audioformat": {"mp32"},
+	}, &albums)
+	if err != nil {
+		return nil, err
+	}
+	if len(albums) == 0 {
+		return nil, ErrJamendoNotFound
 	}
+	album := albums[0]
 
-	apiURL := fmt.Sprintf(
-		"https://api.jamendo.com/v3.0/tracks/?client_id=%s&format=json&limit=%d&tags=%s&audioformat=mp32",
-		clientID, limit, url.QueryEscape(genre),
-	)
+	// Album tracks only carry track-level fields
+	for i := range album.Tracks {
+		t := &album.Tracks[i]
+		t.ArtistID, t.ArtistName = album.ArtistID, album.ArtistName
+		t.AlbumID, t.AlbumName, t.AlbumImage = album.ID, album.Name, album.Image
+		t.ReleaseDate = album.ReleaseDate
+	}
+	sort.SliceStable(album.Tracks, func(i, j int) bool {
+		return album.Tracks[i].Position < album.Tracks[j].Position
+	})
+	return &album, nil
+}
+
+// SearchJamendoPlaylists finds user playlists by name, or the newest ones
+func SearchJamendoPlaylists(query string, limit int) ([]JamendoPlaylist, error) {
+	params := url.Values{"limit": {strconv.Itoa(limit)}}
+	if query != "" {
+		params.Set("namesearch", query)
+	} else {
+		params.Set("order", "creationdate_desc")
+	}
+	var playlists []JamendoPlaylist
+	err := jamendoGet("playlists", params, &playlists)
+	return playlists, err
+}
 
-	resp, err := jamendoClient.Get(apiURL)
+// GetJamendoPlaylist fetches a playlist with its tracks
+func GetJamendoPlaylist(id string) (*JamendoPlaylist, error) {
+	var playlists []JamendoPlaylist
+	err := jamendoGet("playlists/tracks", url.Values{
+		"id":          {id},
+		"audioformat": {"mp32"},
+		"limit":       {"200"},
+	}, &playlists)
 	if err != nil {
-		return nil, fmt.Errorf("jamendo API error: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if len(playlists) == 0 {
+		return nil, ErrJamendoNotFound
+	}
+	return &playlists[0], nil
+}
 
-	var result JamendoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+// GetJamendoRadios lists Jamendo's radio channels
+func GetJamendoRadios(limit int) ([]JamendoRadio, error) {
+	var radios []JamendoRadio
+	err := jamendoGet("radios", url.Values{"limit": {strconv.Itoa(limit)}}, &radios)
+	return radios, err
+}
+
+// GetJamendoRadioStream returns a radio with its stream URL and current track
+func GetJamendoRadioStream(id string) (*JamendoRadio, error) {
+	var radios []JamendoRadio
+	if err := jamendoGet("radios/stream", url.Values{"id": {id}}, &radios); err != nil {
+		return nil, err
+	}
+	if len(radios) == 0 {
+		return nil, ErrJamendoNotFound
 	}
+	return &radios[0], nil
+}
 
-	return result.Results, nil
+// JamendoSong converts a track to a catalog song, keeping its license and
+// musicinfo tags
+func JamendoSong(t JamendoTrack) models.Song {
+	song := models.Song{
+		ID:         "jam-" + t.ID,
+		Title:      t.Name,
+		ArtistName: t.ArtistName,
+		AlbumName:  t.AlbumName,
+		CoverURL:   t.AlbumImage,
+		AudioURL:   t.Audio,
+		Source:     "jamendo",
+		Duration:   int(t.Duration),
+		Status:     "approved",
+		Tags:       []string{},
+		License:    t.LicenseURL,
+		CreatedAt:  time.Now(),
+	}
+	if song.CoverURL == "" {
+		song.CoverURL = t.Image
+	}
+	if info := t.MusicInfo; info != nil {
+		if len(info.Tags.Genres) > 0 {
+			song.Genre = info.Tags.Genres[0]
+		}
+		song.Tags = append(song.Tags, info.Tags.Genres...)
+		song.Tags = append(song.Tags, info.Tags.Vartags...)
+		if info.VocalInstrumental == "instrumental" {
+			song.Tags = append(song.Tags, "instrumental")
+		}
+	}
+	return song
 }
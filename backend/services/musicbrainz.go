@@ -0,0 +1,464 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spotify-clone/models"
+
+	"golang.org/x/time/rate"
+)
+
+// MusicBrainz enrichment
+// Looks songs up on MusicBrainz by ISRC, or by title, artist and duration,
+// and attaches recording/artist/release MBIDs, the release year, genres and
+// Cover Art Archive artwork. Lookups run in a single background worker that
+// keeps to MusicBrainz's one request per second and identifies itself with a
+// User-Agent, as their API etiquette asks. MUSICBRAINZ_URL and COVERART_URL
+// can point at a mirror or a local stub.
+
+const (
+	// Minimum match score to accept a recording
+	mbMinScore = 0.8
+	// Songs waiting for enrichment; further requests are dropped
+	mbQueueSize = 256
+)
+
+// ErrMusicBrainzNoMatch is returned when no recording matches a song well enough
+var ErrMusicBrainzNoMatch = errors.New("no matching MusicBrainz recording")
+
+type mbConfig struct {
+	baseURL    string
+	coverURL   string
+	userAgent  string
+	limiter    *rate.Limiter
+	client     *http.Client
+	coverCheck *http.Client
+}
+
+var (
+	mbCfg     *mbConfig
+	mbCfgOnce sync.Once
+
+	enrichQueue   chan string
+	enrichPending = make(map[string]bool)
+	enrichMu      sync.Mutex
+)
+
+func getMusicBrainzConfig() *mbConfig {
+	mbCfgOnce.Do(func() {
+		cfg := &mbConfig{
+			baseURL:   strings.TrimRight(os.Getenv("MUSICBRAINZ_URL"), "/"),
+			coverURL:  strings.TrimRight(os.Getenv("COVERART_URL"), "/"),
+			userAgent: os.Getenv("MUSICBRAINZ_USER_AGENT"),
+			limiter:   rate.NewLimiter(rate.Every(envDuration("MUSICBRAINZ_INTERVAL", time.Second)), 1),
+			client:    &http.Client{Timeout: 15 * time.Second},
+			coverCheck: &http.Client{
+				Timeout: 10 * time.Second,
+				// The archive redirects to the image; its existence is enough
+				CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			},
+		}
+		if cfg.baseURL == "" {
+			cfg.baseURL = "https://musicbrainz.org/ws/2"
+		}
+		if cfg.coverURL == "" {
+			cfg.coverURL = "https://coverartarchive.org"
+		}
+		if cfg.userAgent == "" {
+			cfg.userAgent = "Ayrus/1.0 ( https://github.com/suryanarayan100406/ayrus )"
+		}
+		mbCfg = cfg
+	})
+	return mbCfg
+}
+
+type mbArtistCredit struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+	Artist     struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"artist"`
+}
+
+type mbRelease struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	Status       string `json:"status"`
+	Date         string `json:"date"`
+	ReleaseGroup struct {
+		ID             string   `json:"id"`
+		PrimaryType    string   `json:"primary-type"`
+		SecondaryTypes []string `json:"secondary-types"`
+	} `json:"release-group"`
+}
+
+type mbRecording struct {
+	ID               string           `json:"id"`
+	Score            int              `json:"score"`
+	Title            string           `json:"title"`
+	Length           int              `json:"length"` // milliseconds
+	FirstReleaseDate string           `json:"first-release-date"`
+	ArtistCredit     []mbArtistCredit `json:"artist-credit"`
+	Releases         []mbRelease      `json:"releases"`
+	ISRCs            []string         `json:"isrcs"`
+	Genres           []struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	} `json:"genres"`
+}
+
+func (r mbRecording) artistName() string {
+	var b strings.Builder
+	for _, c := range r.ArtistCredit {
+		b.WriteString(c.Name + c.JoinPhrase)
+	}
+	return b.String()
+}
+
+// mbGet calls the MusicBrainz API, waiting for the rate limiter first. A 503
+// means we were throttled anyway; it's retried once after a pause.
+func mbGet(ctx context.Context, path string, params url.Values, out interface{}) error {
+	cfg := getMusicBrainzConfig()
+	params.Set("fmt", "json")
+	apiURL := cfg.baseURL + path + "?" + params.Encode()
+
+	for attempt := 0; ; attempt++ {
+		if err := cfg.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", cfg.userAgent)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := cfg.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("musicbrainz API error: %v", err)
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable && attempt == 0 {
+			resp.Body.Close()
+			select {
+			case <-time.After(2 * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("musicbrainz API error: %s", resp.Status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode musicbrainz response: %v", err)
+		}
+		return nil
+	}
+}
+
+// searchRecordings queries the recording search index
+func searchRecordings(ctx context.Context, query string) ([]mbRecording, error) {
+	var result struct {
+		Recordings []mbRecording `json:"recordings"`
+	}
+	err := mbGet(ctx, "/recording", url.Values{"query": {query}, "limit": {"10"}}, &result)
+	return result.Recordings, err
+}
+
+// lookupRecording fetches a recording with its releases, genres and ISRCs
+func lookupRecording(ctx context.Context, id string) (*mbRecording, error) {
+	var rec mbRecording
+	err := mbGet(ctx, "/recording/"+url.PathEscape(id), url.Values{
+		"inc": {"artist-credits releases release-groups genres isrcs"},
+	}, &rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// luceneQuote quotes a phrase for the MusicBrainz search syntax
+func luceneQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// matchMusicBrainzRecording finds the recording for a song. With an ISRC the
+// ISRC decides; otherwise candidates are scored like resolver matches.
+func matchMusicBrainzRecording(ctx context.Context, song models.Song) (*mbRecording, error) {
+	if song.ISRC != "" {
+		recs, err := searchRecordings(ctx, "isrc:"+song.ISRC)
+		if err != nil {
+			return nil, err
+		}
+		if len(recs) > 0 {
+			return lookupRecording(ctx, recs[0].ID)
+		}
+	}
+	if strings.TrimSpace(song.Title) == "" {
+		return nil, ErrMusicBrainzNoMatch
+	}
+
+	query := "recording:" + luceneQuote(song.Title)
+	if song.ArtistName != "" {
+		query += " AND artist:" + luceneQuote(song.ArtistName)
+	}
+	recs, err := searchRecordings(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := models.ExternalTrack{Title: song.Title, Artist: song.ArtistName, Duration: song.Duration}
+	var best *mbRecording
+	bestScore := 0.0
+	for i := range recs {
+		score := scoreCandidate(ext, models.PlayableTrack{
+			Title:    recs[i].Title,
+			Artist:   recs[i].artistName(),
+			Duration: (recs[i].Length + 500) / 1000,
+		})
+		if score > bestScore {
+			best, bestScore = &recs[i], score
+		}
+	}
+	if best == nil || bestScore < mbMinScore {
+		return nil, ErrMusicBrainzNoMatch
+	}
+	return lookupRecording(ctx, best.ID)
+}
+
+// primaryRelease picks the release a recording is best known from: official
+// albums first, then singles/EPs, then anything, earliest first
+func primaryRelease(releases []mbRelease) *mbRelease {
+	if len(releases) == 0 {
+		return nil
+	}
+	rank := func(r mbRelease) int {
+		n := 0
+		if r.Status != "Official" {
+			n += 4
+		}
+		if len(r.ReleaseGroup.SecondaryTypes) > 0 { // compilations, live, ...
+			n += 2
+		}
+		if r.ReleaseGroup.PrimaryType != "Album" {
+			n++
+		}
+		return n
+	}
+	sorted := append([]mbRelease(nil), releases...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i]), rank(sorted[j])
+		if ri != rj {
+			return ri < rj
+		}
+		// Undated releases last
+		di, dj := sorted[i].Date, sorted[j].Date
+		if (di == "") != (dj == "") {
+			return di != ""
+		}
+		return di < dj
+	})
+	return &sorted[0]
+}
+
+// coverArtURL returns front artwork for a release, or its release group
+func coverArtURL(ctx context.Context, release *mbRelease) string {
+	cfg := getMusicBrainzConfig()
+	candidates := []string{cfg.coverURL + "/release/" + release.ID + "/front-500"}
+	if release.ReleaseGroup.ID != "" {
+		candidates = append(candidates, cfg.coverURL+"/release-group/"+release.ReleaseGroup.ID+"/front-500")
+	}
+	for _, u := range candidates {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("User-Agent", cfg.userAgent)
+		resp, err := cfg.coverCheck.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 400 {
+			return u
+		}
+	}
+	return ""
+}
+
+// EnrichSong looks a song up on MusicBrainz and stores what was found.
+// Songs without a match are still marked so they aren't looked up again.
+func EnrichSong(ctx context.Context, songID string) (*models.Song, error) {
+	song, err := GetSong(ctx, songID)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := musicBrainzUpdates(ctx, song)
+	if err != nil {
+		return nil, err
+	}
+	if err := UpdateSong(ctx, songID, updates); err != nil {
+		return nil, fmt.Errorf("failed to save enrichment: %v", err)
+	}
+	return song, nil
+}
+
+// musicBrainzUpdates matches a song on MusicBrainz, applies what was found
+// to it and returns the same changes as a Firestore update. Names are
+// canonicalized only for catalog songs; songs an artist owns, uploaded or
+// imported, keep their titles.
+func musicBrainzUpdates(ctx context.Context, song *models.Song) (map[string]interface{}, error) {
+	now := time.Now()
+	rec, err := matchMusicBrainzRecording(ctx, *song)
+	if errors.Is(err, ErrMusicBrainzNoMatch) {
+		song.EnrichedAt = &now
+		return map[string]interface{}{"enrichedAt": now}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"mbid":       rec.ID,
+		"enrichedAt": now,
+	}
+	song.MBID, song.EnrichedAt = rec.ID, &now
+
+	var artistIDs []string
+	for _, c := range rec.ArtistCredit {
+		artistIDs = append(artistIDs, c.Artist.ID)
+	}
+	if len(artistIDs) > 0 {
+		updates["artistMbids"], song.ArtistMBIDs = artistIDs, artistIDs
+	}
+	if len(rec.ISRCs) > 0 && song.ISRC == "" {
+		updates["isrc"], song.ISRC = rec.ISRCs[0], rec.ISRCs[0]
+	}
+	if year, err := strconv.Atoi(firstN(rec.FirstReleaseDate, 4)); err == nil && year > 0 {
+		updates["year"], song.Year = year, year
+	}
+
+	sort.SliceStable(rec.Genres, func(i, j int) bool { return rec.Genres[i].Count > rec.Genres[j].Count })
+	var genres []string
+	for _, g := range rec.Genres {
+		genres = append(genres, g.Name)
+	}
+	if len(genres) > 0 {
+		updates["genres"], song.Genres = genres, genres
+		if song.Genre == "" {
+			updates["genre"], song.Genre = genres[0], genres[0]
+		}
+	}
+
+	owned := song.ArtistID != ""
+	if !owned {
+		if rec.Title != "" {
+			updates["title"], song.Title = rec.Title, rec.Title
+		}
+		if name := rec.artistName(); name != "" {
+			updates["artistName"], song.ArtistName = name, name
+		}
+	}
+
+	if release := primaryRelease(rec.Releases); release != nil {
+		updates["releaseMbid"], song.ReleaseMBID = release.ID, release.ID
+		if song.AlbumName == "" || !owned {
+			updates["albumName"], song.AlbumName = release.Title, release.Title
+		}
+		// Video thumbnails make poor covers
+		if song.CoverURL == "" || song.Source == "youtube" {
+			if cover := coverArtURL(ctx, release); cover != "" {
+				updates["coverURL"], song.CoverURL = cover, cover
+			}
+		}
+	}
+	return updates, nil
+}
+
+func firstN(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+	return s[:n]
+}
+
+// EnqueueEnrichment schedules a song for background enrichment. It's a no-op
+// when the worker isn't running or the queue is full.
+func EnqueueEnrichment(songID string) {
+	if enrichQueue == nil || songID == "" {
+		return
+	}
+	enrichMu.Lock()
+	defer enrichMu.Unlock()
+	if enrichPending[songID] {
+		return
+	}
+	select {
+	case enrichQueue <- songID:
+		enrichPending[songID] = true
+	default:
+		slog.Debug("enrichment queue full, dropping song", "song", songID)
+	}
+}
+
+// StartEnrichmentWorker starts the background enrichment worker, unless
+// MUSICBRAINZ_ENRICH is false. Besides queued songs it periodically sweeps
+// recent songs that were never enriched.
+func StartEnrichmentWorker() {
+	if v, err := strconv.ParseBool(os.Getenv("MUSICBRAINZ_ENRICH")); err == nil && !v {
+		return
+	}
+	enrichQueue = make(chan string, mbQueueSize)
+
+	go func() {
+		for songID := range enrichQueue {
+			enrichMu.Lock()
+			delete(enrichPending, songID)
+			enrichMu.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if _, err := EnrichSong(ctx, songID); err != nil {
+				slog.Warn("song enrichment failed", "song", songID, "err", err)
+			}
+			cancel()
+		}
+	}()
+
+	go func() {
+		interval := envDuration("ENRICH_SWEEP_INTERVAL", time.Hour)
+		for {
+			sweepUnenrichedSongs()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func sweepUnenrichedSongs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	songs, _, _, err := GetSongs(ctx, models.SongFilter{}, "newest", "", 200)
+	if err != nil {
+		slog.Warn("enrichment sweep failed", "err", err)
+		return
+	}
+	for _, s := range songs {
+		if s.EnrichedAt == nil {
+			EnqueueEnrichment(s.ID)
+		}
+	}
+}
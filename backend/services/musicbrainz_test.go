@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spotify-clone/models"
+
+	"golang.org/x/time/rate"
+)
+
+const mbLookupJSON = `{
+	"id":"rec-1","title":"Get Lucky","length":369000,"first-release-date":"2013-04-19",
+	"isrcs":["USQX91300108"],
+	"artist-credit":[
+		{"name":"Daft Punk","joinphrase":" feat. ","artist":{"id":"art-1","name":"Daft Punk"}},
+		{"name":"Pharrell Williams","joinphrase":"","artist":{"id":"art-2","name":"Pharrell Williams"}}
+	],
+	"genres":[{"name":"disco","count":2},{"name":"funk","count":5}],
+	"releases":[
+		{"id":"rel-comp","title":"Now 85","status":"Official","date":"2013-07-22",
+			"release-group":{"id":"rg-comp","primary-type":"Album","secondary-types":["Compilation"]}},
+		{"id":"rel-album","title":"Random Access Memories","status":"Official","date":"2013-05-17",
+			"release-group":{"id":"rg-album","primary-type":"Album"}}
+	]
+}`
+
+// stubMusicBrainz points the MusicBrainz and Cover Art clients at a test
+// server for the duration of a test
+func stubMusicBrainz(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	getMusicBrainzConfig()
+	prev := mbCfg
+	cfg := *prev
+	cfg.baseURL = srv.URL + "/ws/2"
+	cfg.coverURL = srv.URL + "/caa"
+	cfg.limiter = rate.NewLimiter(rate.Inf, 1)
+	mbCfg = &cfg
+	t.Cleanup(func() { mbCfg = prev })
+}
+
+// musicBrainzHandler serves a search result list, the lookup above and
+// cover art for the album's release group only
+func musicBrainzHandler(t *testing.T, search string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ws/2/recording":
+			if r.URL.Query().Get("fmt") != "json" {
+				t.Errorf("search without fmt=json: %s", r.URL)
+			}
+			w.Write([]byte(search))
+		case r.URL.Path == "/ws/2/recording/rec-1":
+			w.Write([]byte(mbLookupJSON))
+		case r.Method == http.MethodHead && r.URL.Path == "/caa/release-group/rg-album/front-500":
+			w.WriteHeader(http.StatusTemporaryRedirect)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func TestMatchMusicBrainzRecording(t *testing.T) {
+	var queries []string
+	search := `{"recordings":[
+		{"id":"rec-cover","title":"Get Lucky","length":250000,"artist-credit":[{"name":"Some Tribute Band","artist":{"id":"x"}}]},
+		{"id":"rec-1","title":"Get Lucky","length":369000,"artist-credit":[{"name":"Daft Punk","artist":{"id":"art-1"}}]}
+	]}`
+	handler := musicBrainzHandler(t, search)
+	stubMusicBrainz(t, func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("query"); q != "" {
+			queries = append(queries, q)
+		}
+		handler(w, r)
+	})
+
+	rec, err := matchMusicBrainzRecording(context.Background(), models.Song{Title: "Get Lucky", ArtistName: "Daft Punk", Duration: 368})
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	if rec.ID != "rec-1" || len(rec.Releases) != 2 {
+		t.Errorf("matched %s with %d releases, want the looked up rec-1", rec.ID, len(rec.Releases))
+	}
+	if want := `recording:"Get Lucky" AND artist:"Daft Punk"`; len(queries) != 1 || queries[0] != want {
+		t.Errorf("queries = %q, want %q", queries, want)
+	}
+}
+
+func TestMatchMusicBrainzRecordingByISRC(t *testing.T) {
+	var queries []string
+	handler := musicBrainzHandler(t, `{"recordings":[{"id":"rec-1"}]}`)
+	stubMusicBrainz(t, func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("query"); q != "" {
+			queries = append(queries, q)
+		}
+		handler(w, r)
+	})
+
+	// The ISRC decides even when the title doesn't match
+	rec, err := matchMusicBrainzRecording(context.Background(), models.Song{Title: "Track 01", ISRC: "USQX91300108"})
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	if rec.ID != "rec-1" {
+		t.Errorf("matched %s, want rec-1", rec.ID)
+	}
+	if len(queries) != 1 || queries[0] != "isrc:USQX91300108" {
+		t.Errorf("queries = %q", queries)
+	}
+}
+
+func TestMatchMusicBrainzRecordingNoMatch(t *testing.T) {
+	search := `{"recordings":[
+		{"id":"rec-other","title":"Lucky Star","length":200000,"artist-credit":[{"name":"Madonna","artist":{"id":"m"}}]}
+	]}`
+	stubMusicBrainz(t, musicBrainzHandler(t, search))
+
+	_, err := matchMusicBrainzRecording(context.Background(), models.Song{Title: "Get Lucky", ArtistName: "Daft Punk", Duration: 369})
+	if !errors.Is(err, ErrMusicBrainzNoMatch) {
+		t.Errorf("err = %v, want ErrMusicBrainzNoMatch", err)
+	}
+	if _, err := matchMusicBrainzRecording(context.Background(), models.Song{Title: "  "}); !errors.Is(err, ErrMusicBrainzNoMatch) {
+		t.Errorf("untitled song: err = %v, want ErrMusicBrainzNoMatch", err)
+	}
+}
+
+func TestMatchMusicBrainzRecordingAPIError(t *testing.T) {
+	stubMusicBrainz(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	_, err := matchMusicBrainzRecording(context.Background(), models.Song{Title: "Get Lucky"})
+	if err == nil || errors.Is(err, ErrMusicBrainzNoMatch) {
+		t.Errorf("err = %v, want an API error", err)
+	}
+}
+
+func TestPrimaryRelease(t *testing.T) {
+	release := func(id, status, date, primary string, secondary ...string) mbRelease {
+		r := mbRelease{ID: id, Status: status, Date: date}
+		r.ReleaseGroup.PrimaryType = primary
+		r.ReleaseGroup.SecondaryTypes = secondary
+		return r
+	}
+	tests := []struct {
+		name     string
+		releases []mbRelease
+		want     string
+	}{
+		{"none", nil, ""},
+		{"album over single", []mbRelease{
+			release("single", "Official", "2013-04-19", "Single"),
+			release("album", "Official", "2013-05-17", "Album"),
+		}, "album"},
+		{"album over compilation", []mbRelease{
+			release("comp", "Official", "2010-01-01", "Album", "Compilation"),
+			release("album", "Official", "2013-05-17", "Album"),
+		}, "album"},
+		{"official over bootleg", []mbRelease{
+			release("bootleg", "Bootleg", "2012-01-01", "Album"),
+			release("single", "Official", "2013-04-19", "Single"),
+		}, "single"},
+		{"earliest first", []mbRelease{
+			release("reissue", "Official", "2023-05-12", "Album"),
+			release("undated", "Official", "", "Album"),
+			release("original", "Official", "2013-05-17", "Album"),
+		}, "original"},
+		{"undated last", []mbRelease{
+			release("undated", "Official", "", "Album"),
+			release("dated", "Official", "2013", "Album"),
+		}, "dated"},
+	}
+	for _, tt := range tests {
+		got := primaryRelease(tt.releases)
+		switch {
+		case got == nil && tt.want != "":
+			t.Errorf("%s: got nil, want %s", tt.name, tt.want)
+		case got != nil && got.ID != tt.want:
+			t.Errorf("%s: got %s, want %s", tt.name, got.ID, tt.want)
+		}
+	}
+}
+
+func TestMusicBrainzUpdatesCatalogSong(t *testing.T) {
+	search := `{"recordings":[{"id":"rec-1","title":"Get Lucky","length":369000,"artist-credit":[{"name":"Daft Punk","artist":{"id":"art-1"}}]}]}`
+	stubMusicBrainz(t, musicBrainzHandler(t, search))
+
+	song := &models.Song{
+		Title: "Get Lucky", ArtistName: "Daft Punk", Duration: 369,
+		Source: "youtube", CoverURL: "https://i.ytimg.com/vi/x/hq.jpg",
+	}
+	updates, err := musicBrainzUpdates(context.Background(), song)
+	if err != nil {
+		t.Fatalf("updates: %v", err)
+	}
+
+	if song.ArtistName != "Daft Punk feat. Pharrell Williams" || updates["artistName"] != song.ArtistName {
+		t.Errorf("artistName = %q", song.ArtistName)
+	}
+	if song.AlbumName != "Random Access Memories" || song.ReleaseMBID != "rel-album" {
+		t.Errorf("album = %q (%s)", song.AlbumName, song.ReleaseMBID)
+	}
+	if !strings.HasSuffix(song.CoverURL, "/caa/release-group/rg-album/front-500") {
+		t.Errorf("coverURL = %q, want the release group's artwork", song.CoverURL)
+	}
+	if song.Year != 2013 || song.ISRC != "USQX91300108" || song.MBID != "rec-1" {
+		t.Errorf("year/isrc/mbid = %d %s %s", song.Year, song.ISRC, song.MBID)
+	}
+	if len(song.Genres) != 2 || song.Genres[0] != "funk" || song.Genre != "funk" {
+		t.Errorf("genres = %v, genre = %q; want funk first", song.Genres, song.Genre)
+	}
+	if got := song.ArtistMBIDs; len(got) != 2 || got[0] != "art-1" || got[1] != "art-2" {
+		t.Errorf("artistMbids = %v", got)
+	}
+	if song.EnrichedAt == nil || updates["enrichedAt"] == nil {
+		t.Error("song not marked as enriched")
+	}
+}
+
+func TestMusicBrainzUpdatesOwnedSong(t *testing.T) {
+	search := `{"recordings":[{"id":"rec-1","title":"Get Lucky","length":369000,"artist-credit":[{"name":"Daft Punk","artist":{"id":"art-1"}}]}]}`
+	stubMusicBrainz(t, musicBrainzHandler(t, search))
+
+	// An artist's own song keeps its names, whatever its source
+	for _, source := range []string{"upload", "youtube", "archive"} {
+		song := &models.Song{
+			Title: "Get Lucky", ArtistName: "Daft Punk", AlbumName: "RAM", Duration: 369,
+			ArtistID: "artist-uid", Source: source,
+		}
+		updates, err := musicBrainzUpdates(context.Background(), song)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		for _, field := range []string{"title", "artistName", "albumName"} {
+			if _, ok := updates[field]; ok {
+				t.Errorf("%s: %s overwritten", source, field)
+			}
+		}
+		if song.Title != "Get Lucky" || song.ArtistName != "Daft Punk" || song.AlbumName != "RAM" {
+			t.Errorf("%s: names changed to %q / %q / %q", source, song.Title, song.ArtistName, song.AlbumName)
+		}
+		if song.MBID != "rec-1" || song.ReleaseMBID != "rel-album" {
+			t.Errorf("%s: ids not stored", source)
+		}
+	}
+}
+
+func TestMusicBrainzUpdatesNoMatch(t *testing.T) {
+	stubMusicBrainz(t, musicBrainzHandler(t, `{"recordings":[]}`))
+
+	song := &models.Song{Title: "Unknown Demo", ArtistName: "Nobody"}
+	updates, err := musicBrainzUpdates(context.Background(), song)
+	if err != nil {
+		t.Fatalf("updates: %v", err)
+	}
+	if len(updates) != 1 || updates["enrichedAt"] == nil || song.EnrichedAt == nil {
+		t.Errorf("updates = %v, want only enrichedAt", updates)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/utils"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/iterator"
+)
+
+// Pagination
+// List endpoints page with opaque cursors: a cursor holds the sort field
+// value and ID of the last document of a page, and the next page starts
+// after it with Firestore's StartAfter. Ties on the sort field are broken by
+// document ID so the order is stable. Firestore leaves documents without the
+// sort field out of a sorted query, so BackfillSortFields fills it in on
+// documents saved before it existed.
+
+// sortOrder is a field a list can be sorted on
+type sortOrder struct {
+	field string
+	dir   firestore.Direction
+	kind  string // time, int or string, to restore cursor values
+}
+
+// SongSorts are the ?sort= values of song lists, "newest" first
+var SongSorts = map[string]sortOrder{
+	"newest":  {"createdAt", firestore.Desc, "time"},
+	"oldest":  {"createdAt", firestore.Asc, "time"},
+	"popular": {"playCount", firestore.Desc, "int"},
+	"title":   {"title", firestore.Asc, "string"},
+}
+
+// ArtistSorts are the ?sort= values of artist lists, "newest" first
+var ArtistSorts = map[string]sortOrder{
+	"newest":    {"createdAt", firestore.Desc, "time"},
+	"oldest":    {"createdAt", firestore.Asc, "time"},
+	"name":      {"displayName", firestore.Asc, "string"},
+	"followers": {"followerCount", firestore.Desc, "int"},
+}
+
+// AlbumSorts are the ?sort= values of album lists, "newest" first
+var AlbumSorts = map[string]sortOrder{
+	"newest": {"createdAt", firestore.Desc, "time"},
+	"oldest": {"createdAt", firestore.Asc, "time"},
+	"title":  {"title", firestore.Asc, "string"},
+}
+
+// UserSorts are the ?sort= values of user lists, "newest" first
+var UserSorts = map[string]sortOrder{
+	"newest": {"createdAt", firestore.Desc, "time"},
+	"oldest": {"createdAt", firestore.Asc, "time"},
+	"name":   {"displayName", firestore.Asc, "string"},
+	"email":  {"email", firestore.Asc, "string"},
+}
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// maxPageScan caps the documents read for one page of a list filtered
+// while reading. A page that reaches it ends early, possibly empty, with a
+// cursor at the last document read.
+const maxPageScan = 500
+
+// cursorValue converts a sort field value for storing in a cursor
+func cursorValue(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// restoreCursorValue turns a cursor value decoded from JSON back into the
+// type Firestore compares the field as
+func restoreCursorValue(v interface{}, kind string) (interface{}, error) {
+	switch kind {
+	case "time":
+		s, _ := v.(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return t, nil
+	case "int":
+		f, ok := v.(float64)
+		if !ok {
+			return nil, utils.ErrInvalidCursor
+		}
+		return int64(f), nil
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return nil, utils.ErrInvalidCursor
+		}
+		return s, nil
+	}
+}
+
+// pageQuery returns up to limit documents of q accepted by keep (nil keeps
+// all), in the named sort order and starting after cursor, plus the cursor
+// of the next page. With keep, at most maxPageScan documents are read, so a
+// page can come back short with a next cursor. When count is set, the
+// sorted query is counted with an aggregation query, so the total covers
+// the same documents as the pages; there's no total with keep, which an
+// aggregation can't apply.
+func pageQuery(ctx context.Context, q firestore.Query, sorts map[string]sortOrder, sortName, cursor string, limit int, count bool, keep func(*firestore.DocumentSnapshot) bool) ([]*firestore.DocumentSnapshot, string, *int, error) {
+	order, ok := sorts[sortName]
+	if !ok {
+		return nil, "", nil, ErrInvalidSort
+	}
+	cur, err := utils.DecodeCursor(cursor, sortName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	sorted := q.OrderBy(order.field, order.dir)
+	var total *int
+	if count && keep == nil {
+		res, err := sorted.NewAggregationQuery().WithCount("all").Get(ctx)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to count: %v", err)
+		}
+		if v, ok := res["all"].(*firestorepb.Value); ok {
+			total = utils.Count(int(v.GetIntegerValue()))
+		}
+	}
+
+	paged := sorted.OrderBy(firestore.DocumentID, order.dir)
+	if cur.After != "" {
+		value, err := restoreCursorValue(cur.Value, order.kind)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		paged = paged.StartAfter(value, cur.After)
+	}
+	if keep == nil {
+		// One extra document tells whether there's a next page
+		paged = paged.Limit(limit + 1)
+	} else {
+		paged = paged.Limit(maxPageScan)
+	}
+
+	iter := paged.Documents(ctx)
+	defer iter.Stop()
+
+	var docs []*firestore.DocumentSnapshot
+	var last *firestore.DocumentSnapshot // last document the page covers
+	scanned := 0
+	more := false
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", nil, err
+		}
+		scanned++
+		if keep != nil && !keep(doc) {
+			last = doc
+			continue
+		}
+		if len(docs) == limit {
+			more = true
+			break
+		}
+		docs = append(docs, doc)
+		last = doc
+	}
+	if keep != nil && scanned == maxPageScan && !more {
+		// Ran out of budget; the rest may still match
+		more = true
+	}
+
+	next := ""
+	if more && last != nil {
+		value, _ := last.DataAt(order.field)
+		next = utils.EncodeCursor(utils.Cursor{Sort: sortName, After: last.Ref.ID, Value: cursorValue(value)})
+	}
+	return docs, next, total, nil
+}
+
+// Collections listed with pageQuery in sort orders of fields that documents
+// saved before them may lack
+var sortedCollections = map[string]map[string]sortOrder{
+	"songs":   SongSorts,
+	"artists": ArtistSorts,
+	"albums":  AlbumSorts,
+	"users":   UserSorts,
+}
+
+// BackfillSortFields sets the sort fields documents are missing, so sorted
+// lists include them: times default to when the document was created,
+// numbers to 0 and strings to "". It returns how many documents it updated.
+func BackfillSortFields(ctx context.Context) (int, error) {
+	updated := 0
+	for name, sorts := range sortedCollections {
+		iter := config.FirestoreClient.Collection(name).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return updated, fmt.Errorf("failed to read %s: %v", name, err)
+			}
+			if updates := missingSortFields(doc.Data(), sorts, doc.CreateTime); len(updates) > 0 {
+				if _, err := doc.Ref.Update(ctx, updates); err != nil {
+					iter.Stop()
+					return updated, fmt.Errorf("failed to update %s/%s: %v", name, doc.Ref.ID, err)
+				}
+				updated++
+			}
+		}
+		iter.Stop()
+	}
+	return updated, nil
+}
+
+// missingSortFields returns updates setting the sort fields data lacks to
+// their defaults
+func missingSortFields(data map[string]interface{}, sorts map[string]sortOrder, created time.Time) []firestore.Update {
+	var updates []firestore.Update
+	seen := make(map[string]bool)
+	for _, order := range sorts {
+		if _, ok := data[order.field]; ok || seen[order.field] {
+			continue
+		}
+		seen[order.field] = true
+		var value interface{}
+		switch order.kind {
+		case "time":
+			value = created
+		case "int":
+			value = 0
+		default:
+			value = ""
+		}
+		updates = append(updates, firestore.Update{Path: order.field, Value: value})
+	}
+	slices.SortFunc(updates, func(a, b firestore.Update) int { return strings.Compare(a.Path, b.Path) })
+	return updates
+}
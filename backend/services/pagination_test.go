@@ -0,0 +1,25 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMissingSortFields(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updates := missingSortFields(map[string]interface{}{"title": "Song", "playCount": nil}, SongSorts, created)
+	if len(updates) != 1 || updates[0].Path != "createdAt" || updates[0].Value != created {
+		t.Errorf("song updates = %+v", updates)
+	}
+
+	updates = missingSortFields(map[string]interface{}{}, ArtistSorts, created)
+	want := map[string]interface{}{"createdAt": created, "displayName": "", "followerCount": 0}
+	if len(updates) != len(want) {
+		t.Fatalf("artist updates = %+v", updates)
+	}
+	for _, u := range updates {
+		if want[u.Path] != u.Value {
+			t.Errorf("%s = %v, want %v", u.Path, u.Value, want[u.Path])
+		}
+	}
+}
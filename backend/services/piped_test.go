@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPipedSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("q") != "daft punk" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"items":[
+			{"url":"/channel/UC1","type":"channel","title":"Daft Punk"},
+			{"url":"/watch?v=5NV6Rdv1a3I","type":"stream","title":"Get Lucky","uploaderName":"Daft Punk","duration":369,"views":10},
+			{"url":"/watch?v=gAjR4_CbPpQ","type":"stream","title":"Harder, Better, Faster, Stronger","uploaderName":"Daft Punk","duration":226}
+		]}`))
+	}))
+	defer srv.Close()
+
+	tracks, err := NewPipedClient([]string{srv.URL + "/"}, nil).Search(context.Background(), "daft punk", 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("got %d tracks, want 1", len(tracks))
+	}
+	if got := tracks[0]; got.VideoID != "5NV6Rdv1a3I" || got.Artist != "Daft Punk" || got.Duration != 369 {
+		t.Errorf("track = %+v", got)
+	}
+}
+
+func TestPipedAudioStreamFailsOver(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"title":"Get Lucky","uploader":"Daft Punk","duration":369,"audioStreams":[
+			{"url":"https://a/webm","mimeType":"audio/webm","bitrate":160000},
+			{"url":"https://a/m4a-low","mimeType":"audio/mp4","bitrate":48000},
+			{"url":"https://a/m4a","mimeType":"audio/mp4","bitrate":128000}
+		]}`))
+	}))
+	defer up.Close()
+
+	client := NewPipedClient([]string{down.URL, up.URL}, nil)
+	info, err := client.AudioStream(context.Background(), "5NV6Rdv1a3I")
+	if err != nil {
+		t.Fatalf("AudioStream: %v", err)
+	}
+	// m4a first, then by bitrate
+	want := []string{"https://a/m4a", "https://a/m4a-low", "https://a/webm"}
+	for i, s := range info.AudioStreams {
+		if s.URL != want[i] {
+			t.Errorf("stream %d = %s, want %s", i, s.URL, want[i])
+		}
+	}
+	if st := client.InstanceStatus(); st[0].Healthy || !st[1].Healthy {
+		t.Errorf("statuses = %+v", st)
+	}
+}
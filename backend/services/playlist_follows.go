@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Followed playlists
+// Users save other people's playlists to their library by following them.
+// Like followed artists, the IDs are kept on the user (savedPlaylists) and
+// the playlist keeps a follower count. Songs added to followed playlists
+// show up in the user's feed.
+
+// How far back the feed looks for songs added to followed playlists
+const playlistUpdateWindow = 14 * 24 * time.Hour
+
+// FollowPlaylist adds a playlist to the user's saved playlists. Following
+// one twice changes nothing, so the follower count stays right.
+func FollowPlaylist(ctx context.Context, uid, playlistID string) error {
+	userRef := config.FirestoreClient.Collection("users").Doc(uid)
+	playlistRef := config.FirestoreClient.Collection("playlists").Doc(playlistID)
+	err := config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if slices.Contains(user.SavedPlaylists, playlistID) {
+			return nil
+		}
+		if err := tx.Update(userRef, []firestore.Update{{Path: "savedPlaylists", Value: firestore.ArrayUnion(playlistID)}}); err != nil {
+			return err
+		}
+		return tx.Update(playlistRef, []firestore.Update{{Path: "followerCount", Value: firestore.Increment(1)}})
+	})
+	if err == nil {
+		indexPlaylistByID(ctx, playlistID)
+	}
+	return err
+}
+
+// UnfollowPlaylist removes a playlist from the user's saved playlists,
+// including one that has since been deleted
+func UnfollowPlaylist(ctx context.Context, uid, playlistID string) error {
+	userRef := config.FirestoreClient.Collection("users").Doc(uid)
+	playlistRef := config.FirestoreClient.Collection("playlists").Doc(playlistID)
+	err := config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if !slices.Contains(user.SavedPlaylists, playlistID) {
+			return nil
+		}
+		plDoc, plErr := tx.Get(playlistRef)
+		if err := tx.Update(userRef, []firestore.Update{{Path: "savedPlaylists", Value: firestore.ArrayRemove(playlistID)}}); err != nil {
+			return err
+		}
+		if plErr != nil || !plDoc.Exists() {
+			return nil
+		}
+		return tx.Update(playlistRef, []firestore.Update{{Path: "followerCount", Value: firestore.Increment(-1)}})
+	})
+	if err == nil {
+		indexPlaylistByID(ctx, playlistID)
+	}
+	return err
+}
+
+// GetSavedPlaylists returns the playlists a user follows, most recently
+// followed first. Deleted playlists, and private ones the user can no
+// longer open, are left out.
+func GetSavedPlaylists(ctx context.Context, user *models.User) ([]models.Playlist, error) {
+	ids := slices.Clone(user.SavedPlaylists)
+	slices.Reverse(ids)
+	playlists, err := GetPlaylistsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(playlists, func(pl models.Playlist) bool {
+		return !CanReadPlaylist(&pl, user.UID)
+	}), nil
+}
+
+// GetPlaylistUpdates returns up to limit songs that other people added to
+// the user's followed playlists recently, newest first
+func GetPlaylistUpdates(ctx context.Context, user *models.User, limit int) ([]models.PlaylistUpdate, error) {
+	playlists, err := GetSavedPlaylists(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-playlistUpdateWindow)
+	var updates []models.PlaylistUpdate
+	for _, pl := range playlists {
+		for _, item := range pl.Items {
+			if item.AddedAt.After(cutoff) && item.AddedBy != user.UID && !isLegacyItem(item) {
+				updates = append(updates, models.PlaylistUpdate{
+					PlaylistID:   pl.ID,
+					PlaylistName: pl.Name,
+					CoverURL:     pl.CoverURL,
+					Item:         item,
+				})
+			}
+		}
+	}
+	sort.SliceStable(updates, func(i, j int) bool {
+		return updates[i].Item.AddedAt.After(updates[j].Item.AddedAt)
+	})
+	if len(updates) > limit {
+		updates = updates[:limit]
+	}
+
+	songIDs := make([]string, len(updates))
+	for i, u := range updates {
+		songIDs[i] = u.Item.SongID
+	}
+	songs, _, err := GetSongsByIDs(ctx, songIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Song, len(songs))
+	for _, s := range songs {
+		byID[s.ID] = s
+	}
+
+	out := make([]models.PlaylistUpdate, 0, len(updates))
+	for _, u := range updates {
+		if song, ok := byID[u.Item.SongID]; ok {
+			u.Song = song
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
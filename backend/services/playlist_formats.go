@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"spotify-clone/models"
+)
+
+// Playlist files
+// Playlists are exported and imported as M3U8 (extended M3U), XSPF
+// (https://xspf.org) and JSPF, its JSON form. Every exported track carries an
+// "ayrus:song:<id>" identifier so files exported from here re-import exactly;
+// other files are matched by title, artist and duration. M3U8 has no field
+// for it, so it goes in an #EXTAYRUS directive, which other players ignore.
+
+// ErrUnknownPlaylistFormat is returned for formats other than m3u8, xspf and jspf
+var ErrUnknownPlaylistFormat = errors.New("unknown playlist format")
+
+const (
+	songIdentifierPrefix = "ayrus:song:"
+	// M3U8 directives for the artist and song identifier of an entry
+	m3uArtistDirective     = "#EXTART:"
+	m3uIdentifierDirective = "#EXTAYRUS:"
+)
+
+// PlaylistFileEntry is one track of a playlist file
+type PlaylistFileEntry struct {
+	Title      string
+	Artist     string
+	Album      string
+	Duration   int // seconds
+	Location   string
+	Identifier string
+}
+
+// PlaylistFileFormats maps each format to its content type and file extension
+var PlaylistFileFormats = map[string][2]string{
+	"m3u8": {"audio/x-mpegurl; charset=utf-8", ".m3u8"},
+	"xspf": {"application/xspf+xml; charset=utf-8", ".xspf"},
+	"jspf": {"application/jspf+json; charset=utf-8", ".jspf"},
+}
+
+// PlaylistFileEntries converts songs to file entries. Relative audio URLs
+// (uploads) are made absolute with baseURL; YouTube tracks point at the watch
+// page since proxy URLs expire.
+func PlaylistFileEntries(songs []models.Song, baseURL string) []PlaylistFileEntry {
+	entries := make([]PlaylistFileEntry, 0, len(songs))
+	for _, s := range songs {
+		location := s.AudioURL
+		switch {
+		case strings.HasPrefix(location, "youtube:"):
+			location = "https://www.youtube.com/watch?v=" + strings.TrimPrefix(location, "youtube:")
+		case strings.HasPrefix(location, "/"):
+			location = strings.TrimRight(baseURL, "/") + location
+		}
+		entries = append(entries, PlaylistFileEntry{
+			Title:      s.Title,
+			Artist:     s.ArtistName,
+			Album:      s.AlbumName,
+			Duration:   s.Duration,
+			Location:   location,
+			Identifier: songIdentifierPrefix + s.ID,
+		})
+	}
+	return entries
+}
+
+// EncodePlaylistFile writes a playlist in the given format
+func EncodePlaylistFile(format, name string, entries []PlaylistFileEntry) ([]byte, error) {
+	switch format {
+	case "m3u8":
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n")
+		fmt.Fprintf(&b, "#PLAYLIST:%s\n", oneLine(name))
+		for _, e := range entries {
+			duration := e.Duration
+			if duration <= 0 {
+				duration = -1
+			}
+			label := oneLine(e.Title)
+			if e.Artist != "" {
+				label = oneLine(e.Artist) + " - " + label
+			}
+			fmt.Fprintf(&b, "#EXTINF:%d,%s\n", duration, label)
+			if e.Artist != "" {
+				b.WriteString(m3uArtistDirective + oneLine(e.Artist) + "\n")
+			}
+			if e.Album != "" {
+				fmt.Fprintf(&b, "#EXTALB:%s\n", oneLine(e.Album))
+			}
+			if e.Identifier != "" {
+				b.WriteString(m3uIdentifierDirective + oneLine(e.Identifier) + "\n")
+			}
+			b.WriteString(oneLine(e.Location) + "\n")
+		}
+		return []byte(b.String()), nil
+
+	case "xspf":
+		doc := xspfPlaylist{Version: "1", Xmlns: "http://xspf.org/ns/0/", Title: name}
+		for _, e := range entries {
+			doc.Tracks = append(doc.Tracks, xspfTrack{
+				Location:   nonEmpty(e.Location),
+				Identifier: nonEmpty(e.Identifier),
+				Title:      e.Title,
+				Creator:    e.Artist,
+				Album:      e.Album,
+				Duration:   e.Duration * 1000,
+			})
+		}
+		out, err := xml.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), out...), nil
+
+	case "jspf":
+		doc := jspfDocument{}
+		doc.Playlist.Title = name
+		doc.Playlist.Track = []jspfTrack{}
+		for _, e := range entries {
+			doc.Playlist.Track = append(doc.Playlist.Track, jspfTrack{
+				Location:   nonEmpty(e.Location),
+				Identifier: nonEmpty(e.Identifier),
+				Title:      e.Title,
+				Creator:    e.Artist,
+				Album:      e.Album,
+				Duration:   e.Duration * 1000,
+			})
+		}
+		return json.MarshalIndent(doc, "", "  ")
+	}
+	return nil, ErrUnknownPlaylistFormat
+}
+
+// DecodePlaylistFile parses a playlist file, detecting the format from its
+// content when format is empty. It returns the playlist title, if any.
+func DecodePlaylistFile(format string, data []byte) (string, []PlaylistFileEntry, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "" {
+		trimmed := bytes.TrimSpace(data)
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("<")):
+			format = "xspf"
+		case bytes.HasPrefix(trimmed, []byte("{")):
+			format = "jspf"
+		default:
+			format = "m3u8"
+		}
+	}
+
+	switch format {
+	case "m3u", "m3u8":
+		name, entries := decodeM3U(data)
+		return name, entries, nil
+
+	case "xspf":
+		var doc xspfPlaylist
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return "", nil, fmt.Errorf("invalid XSPF: %v", err)
+		}
+		var entries []PlaylistFileEntry
+		for _, t := range doc.Tracks {
+			entries = append(entries, PlaylistFileEntry{
+				Title:      strings.TrimSpace(t.Title),
+				Artist:     strings.TrimSpace(t.Creator),
+				Album:      strings.TrimSpace(t.Album),
+				Duration:   t.Duration / 1000,
+				Location:   firstNonEmpty(t.Location),
+				Identifier: firstNonEmpty(t.Identifier),
+			})
+		}
+		return doc.Title, entries, nil
+
+	case "jspf":
+		var doc jspfDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return "", nil, fmt.Errorf("invalid JSPF: %v", err)
+		}
+		var entries []PlaylistFileEntry
+		for _, t := range doc.Playlist.Track {
+			entries = append(entries, PlaylistFileEntry{
+				Title:      strings.TrimSpace(t.Title),
+				Artist:     strings.TrimSpace(t.Creator),
+				Album:      strings.TrimSpace(t.Album),
+				Duration:   t.Duration / 1000,
+				Location:   firstNonEmpty(t.Location),
+				Identifier: firstNonEmpty(t.Identifier),
+			})
+		}
+		return doc.Playlist.Title, entries, nil
+	}
+	return "", nil, ErrUnknownPlaylistFormat
+}
+
+func decodeM3U(data []byte) (string, []PlaylistFileEntry) {
+	var name, label string
+	var entries []PlaylistFileEntry
+	var pending PlaylistFileEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line == "#EXTM3U":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:<seconds>[ attributes],<Artist - Title>
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(info, ","); i >= 0 {
+				info, label = info[:i], strings.TrimSpace(info[i+1:])
+			}
+			if fields := strings.Fields(info); len(fields) > 0 {
+				if d, err := strconv.ParseFloat(fields[0], 64); err == nil && d > 0 {
+					pending.Duration = int(d + 0.5)
+				}
+			}
+		case strings.HasPrefix(line, "#EXTALB:"):
+			pending.Album = strings.TrimSpace(strings.TrimPrefix(line, "#EXTALB:"))
+		case strings.HasPrefix(line, m3uArtistDirective):
+			pending.Artist = strings.TrimSpace(strings.TrimPrefix(line, m3uArtistDirective))
+		case strings.HasPrefix(line, m3uIdentifierDirective):
+			pending.Identifier = strings.TrimSpace(strings.TrimPrefix(line, m3uIdentifierDirective))
+		case strings.HasPrefix(line, "#"):
+			// Other directives and comments
+		default:
+			pending.Location = line
+			// With #EXTART the label is "<artist> - <title>" whatever
+			// either contains, and our own exports only leave it out when
+			// there's no artist. Otherwise guess where the artist ends.
+			switch prefix := pending.Artist + " - "; {
+			case pending.Artist != "" && strings.HasPrefix(label, prefix):
+				pending.Title = strings.TrimSpace(strings.TrimPrefix(label, prefix))
+			case pending.Artist != "" || strings.HasPrefix(pending.Identifier, songIdentifierPrefix):
+				pending.Title = label
+			default:
+				pending.Artist, pending.Title = splitEntryLabel(label)
+			}
+			if pending.Title == "" {
+				// Plain M3U: derive "Artist - Title" from the file name
+				base := path.Base(strings.ReplaceAll(line, "\\", "/"))
+				if u, err := url.Parse(line); err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "file") {
+					base = path.Base(u.Path)
+				}
+				base = strings.TrimSuffix(base, path.Ext(base))
+				if unescaped, err := url.PathUnescape(base); err == nil {
+					base = unescaped
+				}
+				pending.Artist, pending.Title = splitEntryLabel(strings.ReplaceAll(base, "_", " "))
+			}
+			entries = append(entries, pending)
+			pending, label = PlaylistFileEntry{}, ""
+		}
+	}
+	return name, entries
+}
+
+// splitEntryLabel splits "Artist - Title"; labels without a separator are titles
+func splitEntryLabel(label string) (artist, title string) {
+	if loc := separatorRe.FindStringIndex(label); loc != nil {
+		artist = strings.TrimSpace(label[:loc[0]])
+		title = strings.TrimSpace(label[loc[1]:])
+		if artist != "" && title != "" {
+			return artist, title
+		}
+	}
+	return "", strings.TrimSpace(label)
+}
+
+// ExternalTrackFromFileEntry converts a file entry for matching. Entries
+// exported from here map straight back to their song and YouTube links to
+// their video; the rest are matched by metadata.
+func ExternalTrackFromFileEntry(e PlaylistFileEntry) models.ExternalTrack {
+	ext := models.ExternalTrack{
+		Source:   "file",
+		Title:    e.Title,
+		Artist:   e.Artist,
+		Album:    e.Album,
+		Duration: e.Duration,
+	}
+	if strings.HasPrefix(e.Identifier, songIdentifierPrefix) {
+		ext.Source, ext.SourceID = "catalog", strings.TrimPrefix(e.Identifier, songIdentifierPrefix)
+	} else if id := youtubeVideoIDFromURL(e.Location); id != "" {
+		ext.Source, ext.SourceID = "youtube", id
+	}
+	return ext
+}
+
+// youtubeVideoIDFromURL extracts the video ID of a watch or youtu.be link
+func youtubeVideoIDFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	var id string
+	switch strings.TrimPrefix(strings.ToLower(u.Host), "www.") {
+	case "youtube.com", "music.youtube.com", "m.youtube.com":
+		id = u.Query().Get("v")
+	case "youtu.be":
+		id = strings.TrimPrefix(u.Path, "/")
+	}
+	if !ValidYouTubeID(id) {
+		return ""
+	}
+	return id
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   []string `xml:"location,omitempty"`
+	Identifier []string `xml:"identifier,omitempty"`
+	Title      string   `xml:"title,omitempty"`
+	Creator    string   `xml:"creator,omitempty"`
+	Album      string   `xml:"album,omitempty"`
+	Duration   int      `xml:"duration,omitempty"` // milliseconds
+}
+
+type jspfDocument struct {
+	Playlist struct {
+		Title string      `json:"title,omitempty"`
+		Track []jspfTrack `json:"track"`
+	} `json:"playlist"`
+}
+
+type jspfTrack struct {
+	Location   []string `json:"location,omitempty"`
+	Identifier []string `json:"identifier,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Creator    string   `json:"creator,omitempty"`
+	Album      string   `json:"album,omitempty"`
+	Duration   int      `json:"duration,omitempty"` // milliseconds
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func firstNonEmpty(values []string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
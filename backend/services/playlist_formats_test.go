@@ -0,0 +1,103 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"spotify-clone/models"
+)
+
+var playlistFileSongs = []models.Song{
+	{ID: "s1", Title: "Song, One", ArtistName: "A - B", AlbumName: "First", Duration: 200, AudioURL: "/uploads/songs/one.mp3"},
+	{ID: "s2", Title: "Tum Hi Ho", ArtistName: "Arijit Singh", Duration: 262, AudioURL: "youtube:Umqb9KENgmk"},
+	{ID: "s3", Title: "Untitled - Demo", AudioURL: "https://example.com/demo.ogg"},
+}
+
+func TestPlaylistFileRoundTrip(t *testing.T) {
+	entries := PlaylistFileEntries(playlistFileSongs, "https://ayrus.example/")
+	for _, format := range []string{"m3u8", "xspf", "jspf"} {
+		data, err := EncodePlaylistFile(format, "Road <Trip> & more", entries)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", format, err)
+		}
+		// Detected from the content, as uploads don't name a format
+		name, got, err := DecodePlaylistFile("", data)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", format, err)
+		}
+		if name != "Road <Trip> & more" {
+			t.Errorf("%s: name = %q", format, name)
+		}
+		if !reflect.DeepEqual(got, entries) {
+			t.Errorf("%s: entries differ\ngot  %+v\nwant %+v\nfile:\n%s", format, got, entries, data)
+		}
+		for i, e := range got {
+			if ext := ExternalTrackFromFileEntry(e); ext.Source != "catalog" || ext.SourceID != playlistFileSongs[i].ID {
+				t.Errorf("%s: entry %d maps to %s/%s", format, i, ext.Source, ext.SourceID)
+			}
+		}
+	}
+}
+
+func TestPlaylistFileEntriesLocations(t *testing.T) {
+	entries := PlaylistFileEntries(playlistFileSongs, "https://ayrus.example/")
+	want := []string{
+		"https://ayrus.example/uploads/songs/one.mp3",
+		"https://www.youtube.com/watch?v=Umqb9KENgmk",
+		"https://example.com/demo.ogg",
+	}
+	for i, e := range entries {
+		if e.Location != want[i] {
+			t.Errorf("entry %d location = %q, want %q", i, e.Location, want[i])
+		}
+	}
+}
+
+func TestDecodeM3U(t *testing.T) {
+	data := "\xef\xbb\xbf#EXTM3U\n" +
+		"#PLAYLIST:Mix\n" +
+		"#EXTINF:200,A - B - Song, One\n" +
+		"#EXTART:A - B\n" +
+		"https://example.com/1.mp3\n" +
+		"#EXTINF:180.4 tvg-id=\"x\",Artist – Title\n" +
+		"https://youtu.be/Umqb9KENgmk\n" +
+		"# a comment\n" +
+		"C:\\Music\\Some_Artist - Some%20Song.mp3\n" +
+		"#EXTINF:-1,Just A Title\n" +
+		"stream.mp3\n"
+	name, entries, err := DecodePlaylistFile("m3u8", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Mix" {
+		t.Errorf("name = %q", name)
+	}
+	want := []PlaylistFileEntry{
+		{Title: "Song, One", Artist: "A - B", Duration: 200, Location: "https://example.com/1.mp3"},
+		{Title: "Title", Artist: "Artist", Duration: 180, Location: "https://youtu.be/Umqb9KENgmk"},
+		{Title: "Some Song", Artist: "Some Artist", Location: `C:\Music\Some_Artist - Some%20Song.mp3`},
+		{Title: "Just A Title", Location: "stream.mp3"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries\ngot  %+v\nwant %+v", entries, want)
+	}
+	if ext := ExternalTrackFromFileEntry(entries[1]); ext.Source != "youtube" || ext.SourceID != "Umqb9KENgmk" {
+		t.Errorf("YouTube entry maps to %s/%s", ext.Source, ext.SourceID)
+	}
+}
+
+func TestDecodePlaylistFileErrors(t *testing.T) {
+	if _, _, err := DecodePlaylistFile("xspf", []byte("<playlist><trackList>")); err == nil {
+		t.Error("decoded truncated XSPF")
+	}
+	if _, _, err := DecodePlaylistFile("", []byte(`{"playlist": [`)); err == nil || !strings.Contains(err.Error(), "JSPF") {
+		t.Errorf("truncated JSPF: err = %v", err)
+	}
+	if _, _, err := DecodePlaylistFile("pls", nil); err != ErrUnknownPlaylistFormat {
+		t.Errorf("pls: err = %v", err)
+	}
+	if _, err := EncodePlaylistFile("pls", "", nil); err != ErrUnknownPlaylistFormat {
+		t.Errorf("encode pls: err = %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Playlist history
+// Every change to a playlist saves a snapshot of it, and the snapshot ID
+// becomes the playlist's snapshotId, like Spotify's snapshot_id. Clients
+// send the snapshotId their edit is based on; if someone else changed the
+// playlist since, the edit is rejected with ErrStaleSnapshot instead of
+// overwriting their change. Snapshots are full copies, so restoring one is
+// just another change.
+
+const (
+	// Snapshots kept per playlist; older ones are pruned
+	maxPlaylistSnapshots = 100
+	// How many snapshots over the limit to let pile up before pruning
+	pruneSnapshotsBatch = 20
+	// Time allowed for one pruning pass
+	pruneSnapshotsTimeout = time.Minute
+)
+
+var ErrStaleSnapshot = errors.New("playlist has changed since this snapshot")
+
+// snapshotSorts orders playlist history
+var snapshotSorts = map[string]sortOrder{
+	"newest": {"createdAt", firestore.Desc, "time"},
+}
+
+func snapshotRef(playlistID, snapshotID string) *firestore.DocumentRef {
+	return config.FirestoreClient.Collection("playlists").Doc(playlistID).Collection("snapshots").Doc(snapshotID)
+}
+
+// playlistSnapshot records a playlist's current state
+func playlistSnapshot(pl models.Playlist, edit PlaylistEdit) models.PlaylistSnapshot {
+	return models.PlaylistSnapshot{
+		ID:           pl.SnapshotID,
+		Action:       edit.Action,
+		Name:         pl.Name,
+		IsPublic:     pl.IsPublic,
+		Items:        pl.Items,
+		SongCount:    len(pl.Items),
+		RestoredFrom: edit.RestoredFrom,
+		CreatedBy:    edit.By,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// GetPlaylistHistory returns a page of a playlist's snapshots, newest
+// first, without their items
+func GetPlaylistHistory(ctx context.Context, playlistID, cursor string, limit int) ([]models.PlaylistSnapshot, string, error) {
+	q := config.FirestoreClient.Collection("playlists").Doc(playlistID).Collection("snapshots").
+		Select("id", "action", "name", "isPublic", "songCount", "restoredFrom", "createdBy", "createdAt")
+	docs, next, _, err := pageQuery(ctx, q, snapshotSorts, "newest", cursor, limit, false, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	snapshots := make([]models.PlaylistSnapshot, 0, len(docs))
+	for _, doc := range docs {
+		var s models.PlaylistSnapshot
+		if err := doc.DataTo(&s); err != nil {
+			continue
+		}
+		s.ID = doc.Ref.ID
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, next, nil
+}
+
+// GetPlaylistSnapshot returns one snapshot with its items
+func GetPlaylistSnapshot(ctx context.Context, playlistID, snapshotID string) (*models.PlaylistSnapshot, error) {
+	doc, err := snapshotRef(playlistID, snapshotID).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var s models.PlaylistSnapshot
+	if err := doc.DataTo(&s); err != nil {
+		return nil, err
+	}
+	s.ID = doc.Ref.ID
+	for i := range s.Items {
+		s.Items[i].Position = i
+	}
+	return &s, nil
+}
+
+// RestorePlaylist sets a playlist back to an earlier snapshot. The restore
+// is a change of its own, so it can be undone the same way.
+func RestorePlaylist(ctx context.Context, playlistID string, edit PlaylistEdit, snap *models.PlaylistSnapshot) (*models.Playlist, error) {
+	edit.Action = "restore"
+	edit.RestoredFrom = snap.ID
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		pl.Name = snap.Name
+		pl.IsPublic = snap.IsPublic
+		pl.Items = slices.Clone(snap.Items)
+		return nil
+	})
+}
+
+// DiffPlaylistSnapshots compares two snapshots. Items kept in both are
+// moved only if they're off the longest run that stayed in order, so one
+// song dragged to the top shows as one move rather than every song shifting.
+func DiffPlaylistSnapshots(from, to *models.PlaylistSnapshot) models.PlaylistDiff {
+	diff := models.PlaylistDiff{
+		From:    from.ID,
+		To:      to.ID,
+		Added:   []models.PlaylistItem{},
+		Removed: []models.PlaylistItem{},
+		Moved:   []models.PlaylistMove{},
+		Changes: map[string][2]interface{}{},
+	}
+	if from.Name != to.Name {
+		diff.Changes["name"] = [2]interface{}{from.Name, to.Name}
+	}
+	if from.IsPublic != to.IsPublic {
+		diff.Changes["isPublic"] = [2]interface{}{from.IsPublic, to.IsPublic}
+	}
+
+	oldPos := make(map[string]int, len(from.Items))
+	for i, item := range from.Items {
+		oldPos[item.ItemID] = i
+	}
+	newIDs := make(map[string]bool, len(to.Items))
+	var kept []models.PlaylistItem // items in both, in the new order
+	for i, item := range to.Items {
+		item.Position = i
+		newIDs[item.ItemID] = true
+		if _, ok := oldPos[item.ItemID]; ok {
+			kept = append(kept, item)
+		} else {
+			diff.Added = append(diff.Added, item)
+		}
+	}
+	for i, item := range from.Items {
+		if !newIDs[item.ItemID] {
+			item.Position = i
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+
+	inOrder := longestIncreasingRun(kept, oldPos)
+	for i, item := range kept {
+		if !inOrder[i] {
+			diff.Moved = append(diff.Moved, models.PlaylistMove{
+				ItemID: item.ItemID,
+				SongID: item.SongID,
+				From:   oldPos[item.ItemID],
+				To:     item.Position,
+			})
+		}
+	}
+	return diff
+}
+
+// longestIncreasingRun marks the longest subsequence of items whose old
+// positions are increasing (patience sorting, O(n log n))
+func longestIncreasingRun(items []models.PlaylistItem, oldPos map[string]int) []bool {
+	tails := []int{} // index into items of the last element of each run length
+	prev := make([]int, len(items))
+	for i, item := range items {
+		p := oldPos[item.ItemID]
+		k := sort.Search(len(tails), func(j int) bool { return oldPos[items[tails[j]].ItemID] >= p })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	marked := make([]bool, len(items))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			marked[i] = true
+		}
+	}
+	return marked
+}
+
+// prunePlaylistSnapshots deletes all but the newest snapshots of a
+// playlist, once its snapshotCount shows a batch of them has piled up.
+// Skipped docs are billed as reads, so pruning one at a time would be costly.
+func prunePlaylistSnapshots(playlistID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pruneSnapshotsTimeout)
+	defer cancel()
+
+	playlist := config.FirestoreClient.Collection("playlists").Doc(playlistID)
+	iter := playlist.Collection("snapshots").
+		OrderBy("createdAt", firestore.Desc).
+		Offset(maxPlaylistSnapshots).
+		Select().
+		Documents(ctx)
+	defer iter.Stop()
+	deleted := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.Warn("failed to prune playlist snapshots", "playlist", playlistID, "err", err)
+			break
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			slog.Warn("failed to delete playlist snapshot", "playlist", playlistID, "snapshot", doc.Ref.ID, "err", err)
+			continue
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		return
+	}
+	if _, err := playlist.Update(ctx, []firestore.Update{{Path: "snapshotCount", Value: firestore.Increment(-deleted)}}); err != nil {
+		slog.Warn("failed to update playlist snapshot count", "playlist", playlistID, "err", err)
+	}
+}
+
+// deletePlaylistSnapshots deletes a playlist's history with the playlist
+func deletePlaylistSnapshots(ctx context.Context, playlistID string) {
+	iter := config.FirestoreClient.Collection("playlists").Doc(playlistID).Collection("snapshots").
+		Select().
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			slog.Warn("failed to delete playlist history", "playlist", playlistID, "err", err)
+			return
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			slog.Warn("failed to delete playlist snapshot", "playlist", playlistID, "snapshot", doc.Ref.ID, "err", err)
+		}
+	}
+}
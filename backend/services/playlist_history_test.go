@@ -0,0 +1,125 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"spotify-clone/models"
+)
+
+// snapshotOf makes a snapshot whose items are named by the letters of ids;
+// item "a" holds song "song-a"
+func snapshotOf(id, ids string) *models.PlaylistSnapshot {
+	s := &models.PlaylistSnapshot{ID: id, Name: "Mix", Items: []models.PlaylistItem{}}
+	for _, r := range ids {
+		s.Items = append(s.Items, models.PlaylistItem{ItemID: string(r), SongID: "song-" + string(r)})
+	}
+	return s
+}
+
+func itemIDs(items []models.PlaylistItem) string {
+	var b strings.Builder
+	for _, item := range items {
+		b.WriteString(item.ItemID)
+	}
+	return b.String()
+}
+
+func TestDiffPlaylistSnapshots(t *testing.T) {
+	tests := []struct {
+		name, from, to string
+		added, removed string
+		moved          []models.PlaylistMove
+	}{
+		{name: "unchanged", from: "abcd", to: "abcd"},
+		{name: "add at end", from: "abc", to: "abcd", added: "d"},
+		{name: "add in middle", from: "abc", to: "axbc", added: "x"},
+		{name: "remove", from: "abcd", to: "acd", removed: "b"},
+		{name: "replace", from: "abc", to: "axc", added: "x", removed: "b"},
+		{name: "move to top", from: "abcde", to: "eabcd",
+			moved: []models.PlaylistMove{{ItemID: "e", SongID: "song-e", From: 4, To: 0}}},
+		{name: "move to end", from: "abcde", to: "bcdea",
+			moved: []models.PlaylistMove{{ItemID: "a", SongID: "song-a", From: 0, To: 4}}},
+		// Either of two swapped items could be the one moved; it's always
+		// a single move
+		{name: "swap neighbors", from: "abcd", to: "bacd",
+			moved: []models.PlaylistMove{{ItemID: "b", SongID: "song-b", From: 1, To: 0}}},
+		{name: "swap ends", from: "abcd", to: "dbca",
+			moved: []models.PlaylistMove{{ItemID: "d", SongID: "song-d", From: 3, To: 0}, {ItemID: "a", SongID: "song-a", From: 0, To: 3}}},
+		{name: "move with add and remove", from: "abcde", to: "xdabe", added: "x", removed: "c",
+			moved: []models.PlaylistMove{{ItemID: "d", SongID: "song-d", From: 3, To: 1}}},
+		{name: "reversed", from: "abc", to: "cba",
+			moved: []models.PlaylistMove{{ItemID: "c", SongID: "song-c", From: 2, To: 0}, {ItemID: "b", SongID: "song-b", From: 1, To: 1}}},
+		{name: "from empty", from: "", to: "ab", added: "ab"},
+		{name: "to empty", from: "ab", to: "", removed: "ab"},
+	}
+	for _, tt := range tests {
+		diff := DiffPlaylistSnapshots(snapshotOf("s1", tt.from), snapshotOf("s2", tt.to))
+		if got := itemIDs(diff.Added); got != tt.added {
+			t.Errorf("%s: added %q, want %q", tt.name, got, tt.added)
+		}
+		if got := itemIDs(diff.Removed); got != tt.removed {
+			t.Errorf("%s: removed %q, want %q", tt.name, got, tt.removed)
+		}
+		if tt.moved == nil {
+			tt.moved = []models.PlaylistMove{}
+		}
+		if !reflect.DeepEqual(diff.Moved, tt.moved) {
+			t.Errorf("%s: moved %+v, want %+v", tt.name, diff.Moved, tt.moved)
+		}
+		if len(diff.Changes) != 0 {
+			t.Errorf("%s: changes %v", tt.name, diff.Changes)
+		}
+	}
+}
+
+func TestDiffPlaylistSnapshotsPositions(t *testing.T) {
+	diff := DiffPlaylistSnapshots(snapshotOf("s1", "abc"), snapshotOf("s2", "xac"))
+	if diff.From != "s1" || diff.To != "s2" {
+		t.Errorf("from/to = %s/%s", diff.From, diff.To)
+	}
+	if diff.Added[0].Position != 0 || diff.Removed[0].Position != 1 {
+		t.Errorf("added at %d, removed from %d", diff.Added[0].Position, diff.Removed[0].Position)
+	}
+}
+
+func TestDiffPlaylistSnapshotsChanges(t *testing.T) {
+	from, to := snapshotOf("s1", "ab"), snapshotOf("s2", "ab")
+	to.Name, to.IsPublic = "Road Trip", true
+	diff := DiffPlaylistSnapshots(from, to)
+	want := map[string][2]interface{}{"name": {"Mix", "Road Trip"}, "isPublic": {false, true}}
+	if !reflect.DeepEqual(diff.Changes, want) {
+		t.Errorf("changes = %v", diff.Changes)
+	}
+}
+
+func TestLongestIncreasingRun(t *testing.T) {
+	tests := []struct {
+		old, order string
+		want       string // items left in place
+	}{
+		{"abcde", "abcde", "abcde"},
+		{"abcde", "eabcd", "abcd"},
+		{"abcde", "edcba", "a"},
+		{"abcdef", "badcfe", "ace"},
+		{"abcde", "", ""},
+	}
+	for _, tt := range tests {
+		oldPos := make(map[string]int)
+		for i, r := range tt.old {
+			oldPos[string(r)] = i
+		}
+		items := snapshotOf("", tt.order).Items
+		marked := longestIncreasingRun(items, oldPos)
+		var got strings.Builder
+		for i, ok := range marked {
+			if ok {
+				got.WriteString(items[i].ItemID)
+			}
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s -> %s: in order %q, want %q", tt.old, tt.order, got.String(), tt.want)
+		}
+	}
+}
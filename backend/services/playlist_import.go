@@ -0,0 +1,482 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/models"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+)
+
+// Playlist import
+// Copies a Spotify, Deezer or YouTube playlist, or an uploaded playlist file,
+// into a local playlist. The track list is fetched and every track resolved
+// to a playable source in a background job stored in "importJobs". Progress
+// is checkpointed as it goes, so a job interrupted by a restart or failures
+// can be resumed where it stopped. The run processing a job holds a lease on
+// its document, renewed at every checkpoint, so no two replicas run the same
+// job; a job whose run died can be resumed once its lease expires.
+
+const (
+	// Largest playlist accepted; keeps the job document well under 1 MiB
+	maxImportTracks = 1000
+	// Tracks resolved between progress saves
+	importCheckpointEvery = 10
+	// Time allowed to resolve a single track
+	importTrackTimeout = 90 * time.Second
+	// How long a run holds a job without checkpointing
+	importLeaseTTL = 5 * time.Minute
+)
+
+// ErrUnsupportedPlaylistURL is returned for URLs that aren't a known playlist
+var ErrUnsupportedPlaylistURL = errors.New("unsupported playlist URL")
+
+// errImportLeaseLost stops a run whose job another run has taken over
+var errImportLeaseLost = errors.New("import job taken over by another run")
+
+var (
+	spotifyPlaylistRe = regexp.MustCompile(`^(?:https?://open\.spotify\.com/(?:intl-[a-z-]+/)?playlist/|spotify:playlist:)([A-Za-z0-9]{22})`)
+	deezerPlaylistRe  = regexp.MustCompile(`^https?://(?:www\.)?deezer\.com/(?:[a-z]{2}/)?playlist/(\d+)`)
+	youtubeListRe     = regexp.MustCompile(`^[A-Za-z0-9_-]{12,64}$`)
+)
+
+// ParsePlaylistURL identifies the provider and playlist ID of a playlist URL
+func ParsePlaylistURL(raw string) (source, id string, err error) {
+	raw = strings.TrimSpace(raw)
+	if m := spotifyPlaylistRe.FindStringSubmatch(raw); m != nil {
+		return "spotify", m[1], nil
+	}
+	if m := deezerPlaylistRe.FindStringSubmatch(raw); m != nil {
+		return "deezer", m[1], nil
+	}
+
+	// youtube.com/playlist?list=, music.youtube.com/playlist?list=,
+	// youtube.com/watch?v=...&list=, youtu.be/<id>?list=
+	u, err := url.Parse(raw)
+	if err == nil {
+		host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+		if host == "youtube.com" || host == "music.youtube.com" || host == "m.youtube.com" || host == "youtu.be" {
+			if list := u.Query().Get("list"); youtubeListRe.MatchString(list) {
+				return "youtube", list, nil
+			}
+		}
+	}
+	return "", "", ErrUnsupportedPlaylistURL
+}
+
+// StartPlaylistImport creates an import job for a playlist URL and starts it
+func StartPlaylistImport(ctx context.Context, uid string, req models.ImportPlaylistRequest) (*models.ImportJob, error) {
+	source, id, err := ParsePlaylistURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := models.ImportJob{
+		UserID:    uid,
+		URL:       req.URL,
+		Source:    source,
+		SourceID:  id,
+		Name:      strings.TrimSpace(req.Name),
+		IsPublic:  req.IsPublic,
+		Status:    "pending",
+		Tracks:    []models.ImportTrack{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	takeImportLease(&job)
+	jobID, err := CreateImportJob(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import job: %v", err)
+	}
+	job.ID = jobID
+
+	startImportJob(job)
+	return &job, nil
+}
+
+// StartPlaylistFileImport creates an import job for the entries of an
+// uploaded playlist file and starts it
+func StartPlaylistFileImport(ctx context.Context, uid, name string, isPublic bool, entries []PlaylistFileEntry) (*models.ImportJob, error) {
+	if len(entries) > maxImportTracks {
+		entries = entries[:maxImportTracks]
+	}
+	tracks := make([]models.ImportTrack, len(entries))
+	for i, e := range entries {
+		tracks[i] = models.ImportTrack{External: ExternalTrackFromFileEntry(e), Status: "pending"}
+	}
+	if name == "" {
+		name = "Imported playlist"
+	}
+
+	now := time.Now()
+	job := models.ImportJob{
+		UserID:    uid,
+		Source:    "file",
+		Name:      name,
+		IsPublic:  isPublic,
+		Status:    "pending",
+		Total:     len(tracks),
+		Tracks:    tracks,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	takeImportLease(&job)
+	jobID, err := CreateImportJob(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import job: %v", err)
+	}
+	job.ID = jobID
+
+	startImportJob(job)
+	return &job, nil
+}
+
+// ResumePlaylistImport restarts an unfinished job, retrying failed tracks.
+// Jobs another run holds the lease of are returned as they are.
+func ResumePlaylistImport(ctx context.Context, jobID string) (*models.ImportJob, error) {
+	ref := config.FirestoreClient.Collection("importJobs").Doc(jobID)
+	var job models.ImportJob
+	var start bool
+	err := config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		job, start = models.ImportJob{}, false
+		if err := doc.DataTo(&job); err != nil {
+			return err
+		}
+		job.ID = doc.Ref.ID
+		if job.LeaseUntil.After(time.Now()) {
+			return nil
+		}
+
+		retried := 0
+		for i := range job.Tracks {
+			if job.Tracks[i].Status == "failed" {
+				job.Tracks[i].Status = "pending"
+				job.Tracks[i].Error = ""
+				retried++
+			}
+		}
+		if job.Status == "completed" && retried == 0 {
+			return nil
+		}
+
+		job.Processed -= retried
+		job.Status = "pending"
+		job.Error = ""
+		takeImportLease(&job)
+		start = true
+		return tx.Set(ref, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if start {
+		startImportJob(job)
+	}
+	return &job, nil
+}
+
+// takeImportLease gives job a new lease, for a run about to start
+func takeImportLease(job *models.ImportJob) {
+	job.LeaseID = uuid.NewString()
+	job.LeaseUntil = time.Now().Add(importLeaseTTL)
+}
+
+// startImportJob runs a job in the background. The job must hold a lease.
+func startImportJob(job models.ImportJob) {
+	go runImportJob(context.Background(), &job)
+}
+
+func runImportJob(ctx context.Context, job *models.ImportJob) {
+	job.Status = "running"
+	if !saveImportProgress(ctx, job) {
+		return
+	}
+
+	if len(job.Tracks) == 0 {
+		name, tracks, err := fetchImportTracks(ctx, job.Source, job.SourceID)
+		if err != nil {
+			failImportJob(ctx, job, err)
+			return
+		}
+		if job.Name == "" {
+			job.Name = name
+		}
+		if job.Name == "" {
+			job.Name = "Imported playlist"
+		}
+		job.Tracks = tracks
+		job.Total = len(tracks)
+		if !saveImportProgress(ctx, job) {
+			return
+		}
+	}
+
+	if job.PlaylistID == "" {
+		playlist, err := CreatePlaylist(ctx, models.Playlist{
+			Name:      job.Name,
+			UserID:    job.UserID,
+			IsPublic:  job.IsPublic,
+			SongIDs:   []string{},
+			Items:     []models.PlaylistItem{},
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			failImportJob(ctx, job, fmt.Errorf("failed to create playlist: %v", err))
+			return
+		}
+		job.PlaylistID = playlist.ID
+		if !saveImportProgress(ctx, job) {
+			return
+		}
+	}
+
+	sinceCheckpoint := 0
+	for i := range job.Tracks {
+		t := &job.Tracks[i]
+		if t.Status != "pending" {
+			continue
+		}
+		importTrack(ctx, t)
+		job.Processed++
+		if t.Status == "matched" {
+			job.Matched++
+		}
+
+		// Checkpoint early if the lease would run out before the next one
+		sinceCheckpoint++
+		if sinceCheckpoint >= importCheckpointEvery || time.Until(job.LeaseUntil) < importLeaseTTL/2 {
+			sinceCheckpoint = 0
+			syncImportedPlaylist(ctx, job)
+			if !saveImportProgress(ctx, job) {
+				return
+			}
+		}
+	}
+
+	job.Status = "completed"
+	syncImportedPlaylist(ctx, job)
+	saveImportProgress(ctx, job)
+	slog.Info("playlist import finished", "job", job.ID, "matched", job.Matched, "total", job.Total)
+}
+
+// importTrack resolves one track and records the outcome on it
+func importTrack(ctx context.Context, t *models.ImportTrack) {
+	ctx, cancel := context.WithTimeout(ctx, importTrackTimeout)
+	defer cancel()
+
+	if t.External.Source == "catalog" {
+		// Exported from here: use the song itself while it still exists and
+		// is approved. Files can name any song ID, so pending and rejected
+		// songs are matched like any other track instead.
+		if song, err := GetSong(ctx, t.External.SourceID); err == nil && song.Status == "approved" {
+			t.Status, t.SongID = "matched", song.ID
+			return
+		}
+		t.External.Source, t.External.SourceID = "file", ""
+	}
+
+	var match *models.PlayableTrack
+	if t.External.Source == "youtube" {
+		// Already playable, nothing to resolve
+		match = &models.PlayableTrack{
+			Source:   "youtube",
+			ID:       t.External.SourceID,
+			Title:    t.External.Title,
+			Artist:   t.External.Artist,
+			Duration: t.External.Duration,
+			CoverURL: t.External.CoverURL,
+			Score:    1,
+		}
+	} else if mapping, ok := GetResolvedTrack(ctx, t.External); ok {
+		match = &mapping.Match
+	} else {
+		var mapping *models.TrackMapping
+		var err error
+		// Back off while the extractor pool is saturated rather than
+		// failing the track
+		for attempt := 0; attempt < 3; attempt++ {
+			mapping, err = ResolveTrack(ctx, t.External)
+			if !errors.Is(err, ErrExtractorBusy) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				t.Status, t.Error = "failed", ctx.Err().Error()
+				return
+			case <-time.After(time.Duration(attempt+1) * 2 * time.Second):
+			}
+		}
+		switch {
+		case errors.Is(err, ErrNoMatch):
+			t.Status = "unmatched"
+			return
+		case err != nil:
+			t.Status, t.Error = "failed", err.Error()
+			return
+		}
+		match = &mapping.Match
+	}
+
+	songID, err := SongForMatch(ctx, t.External, *match)
+	if err != nil {
+		t.Status, t.Error = "failed", err.Error()
+		return
+	}
+	t.Status, t.SongID, t.Match = "matched", songID, match
+}
+
+// fetchImportTracks loads a provider playlist as pending import tracks
+func fetchImportTracks(ctx context.Context, source, id string) (string, []models.ImportTrack, error) {
+	var name string
+	var externals []models.ExternalTrack
+
+	switch source {
+	case "spotify":
+		pl, err := GetSpotifyPlaylist(id, maxImportTracks)
+		if err != nil {
+			return "", nil, err
+		}
+		name = pl.Name
+		for _, t := range pl.Tracks {
+			externals = append(externals, ExternalTrackFromSpotify(t))
+		}
+	case "deezer":
+		pl, err := GetDeezerPlaylist(id, maxImportTracks)
+		if err != nil {
+			return "", nil, err
+		}
+		name = pl.Title
+		for _, t := range pl.Tracks {
+			externals = append(externals, ExternalTrackFromDeezer(t))
+		}
+	case "youtube":
+		pl, err := getExtractor().Playlist(ctx, id)
+		if err != nil {
+			return "", nil, err
+		}
+		name = pl.Title
+		for _, t := range pl.Tracks {
+			meta := ParseYouTubeTitle(t.Title, t.Artist)
+			externals = append(externals, models.ExternalTrack{
+				Source:   "youtube",
+				SourceID: t.VideoID,
+				Title:    meta.Title,
+				Artist:   meta.Artist,
+				Duration: t.Duration,
+				CoverURL: t.Thumbnail,
+			})
+		}
+	default:
+		return "", nil, ErrUnsupportedPlaylistURL
+	}
+
+	if len(externals) > maxImportTracks {
+		externals = externals[:maxImportTracks]
+	}
+	tracks := make([]models.ImportTrack, len(externals))
+	for i, ext := range externals {
+		tracks[i] = models.ImportTrack{External: ext, Status: "pending"}
+	}
+	return name, tracks, nil
+}
+
+// syncImportedPlaylist appends newly matched songs to the playlist, in
+// playlist order. Songs already in the playlist are skipped, and songs
+// added earlier aren't touched, so changes people make to the playlist
+// while the import runs are kept.
+func syncImportedPlaylist(ctx context.Context, job *models.ImportJob) {
+	var pending []*models.ImportTrack
+	for i := range job.Tracks {
+		if t := &job.Tracks[i]; t.SongID != "" && !t.Added {
+			pending = append(pending, t)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	playlist, err := GetPlaylist(ctx, job.PlaylistID)
+	if err != nil {
+		slog.Warn("failed to update imported playlist", "job", job.ID, "playlist", job.PlaylistID, "err", err)
+		return
+	}
+	present := make(map[string]bool, len(playlist.SongIDs))
+	for _, id := range playlist.SongIDs {
+		present[id] = true
+	}
+	var songIDs []string
+	for _, t := range pending {
+		if !present[t.SongID] {
+			present[t.SongID] = true
+			songIDs = append(songIDs, t.SongID)
+		}
+	}
+
+	if len(songIDs) > 0 {
+		if _, err := InsertPlaylistSongs(ctx, job.PlaylistID, PlaylistEdit{By: job.UserID}, songIDs, -1, true); err != nil {
+			slog.Warn("failed to update imported playlist", "job", job.ID, "playlist", job.PlaylistID, "err", err)
+			return
+		}
+	}
+	for _, t := range pending {
+		t.Added = true
+	}
+}
+
+// saveImportProgress checkpoints a job, renewing its lease while it runs
+// and releasing it once it stops. It reports false when another run has
+// taken the job over, which the caller must then leave alone.
+func saveImportProgress(ctx context.Context, job *models.ImportJob) bool {
+	leaseID := job.LeaseID
+	job.UpdatedAt = time.Now()
+	if job.Status == "running" {
+		job.LeaseUntil = job.UpdatedAt.Add(importLeaseTTL)
+	} else {
+		job.LeaseID, job.LeaseUntil = "", time.Time{}
+	}
+
+	ref := config.FirestoreClient.Collection("importJobs").Doc(job.ID)
+	err := config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var current models.ImportJob
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.LeaseID != leaseID {
+			return errImportLeaseLost
+		}
+		return tx.Set(ref, *job)
+	})
+	if errors.Is(err, errImportLeaseLost) {
+		slog.Warn("playlist import stopped", "job", job.ID, "err", err)
+		return false
+	}
+	if err != nil {
+		slog.Warn("failed to save import job", "job", job.ID, "err", err)
+	}
+	return true
+}
+
+func failImportJob(ctx context.Context, job *models.ImportJob, err error) {
+	slog.Warn("playlist import failed", "job", job.ID, "err", err)
+	job.Status = "failed"
+	job.Error = err.Error()
+	saveImportProgress(ctx, job)
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/models"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+)
+
+// Playlist items
+// A playlist's songs are an ordered list of items, each with its own ID,
+// who added it and when. songIds mirrors the items' song IDs for clients and
+// code that only need the songs. Every change runs in a transaction, so two
+// edits at once can't drop each other's songs, and records a snapshot (see
+// playlist_history.go).
+
+// Most items a playlist can hold; the items live in the playlist document
+const maxPlaylistItems = 5000
+
+var (
+	ErrPlaylistItemNotFound  = errors.New("playlist item not found")
+	ErrDuplicatePlaylistSong = errors.New("song already in playlist")
+	ErrInvalidPosition       = errors.New("invalid position")
+	ErrPlaylistFull          = fmt.Errorf("playlists hold at most %d songs", maxPlaylistItems)
+	ErrPlaylistForbidden     = errors.New("not allowed to make this change to the playlist")
+)
+
+// PlaylistEdit describes a change to a playlist for its snapshot
+type PlaylistEdit struct {
+	By           string // user making the change, checked against the playlist's roles
+	Action       string // add, move, remove, update or restore
+	IfSnapshot   string // when set, the change fails with ErrStaleSnapshot unless this is the current snapshot
+	RestoredFrom string
+}
+
+// newShortID makes item and snapshot IDs, unique within a playlist
+func newShortID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+}
+
+// normalizePlaylistItems fills in positions and mirrors the song IDs.
+// Playlists saved before items existed get items made from their song IDs,
+// with IDs derived from the position so they stay the same until the
+// playlist is next changed and they're saved.
+func normalizePlaylistItems(pl *models.Playlist) {
+	if len(pl.Items) == 0 && len(pl.SongIDs) > 0 {
+		pl.Items = make([]models.PlaylistItem, len(pl.SongIDs))
+		for i, songID := range pl.SongIDs {
+			pl.Items[i] = models.PlaylistItem{
+				ItemID:  fmt.Sprintf("s%d", i),
+				SongID:  songID,
+				AddedBy: pl.UserID,
+				AddedAt: pl.CreatedAt,
+			}
+		}
+	}
+	if pl.Items == nil {
+		pl.Items = []models.PlaylistItem{}
+	}
+	pl.SongIDs = make([]string, len(pl.Items))
+	for i := range pl.Items {
+		pl.Items[i].Position = i
+		pl.SongIDs[i] = pl.Items[i].SongID
+	}
+}
+
+// isLegacyItem reports whether an item was made from a song ID by
+// normalizePlaylistItems, so it has no real add time. Other item IDs are
+// hex and never start with "s".
+func isLegacyItem(item models.PlaylistItem) bool {
+	return strings.HasPrefix(item.ItemID, "s")
+}
+
+// MutatePlaylist applies fn to a playlist in a transaction and saves its
+// name, visibility and items with a new snapshot, returning the updated
+// playlist. The editor's role is checked in the transaction, so someone
+// removed from the playlist meanwhile can't change it: items are for the
+// owner and collaborators, and renames, visibility and restores for the
+// owner. Other changes fail with ErrPlaylistForbidden.
+func MutatePlaylist(ctx context.Context, id string, edit PlaylistEdit, fn func(pl *models.Playlist) error) (*models.Playlist, error) {
+	ref := config.FirestoreClient.Collection("playlists").Doc(id)
+	var out models.Playlist
+	err := config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var pl models.Playlist
+		if err := doc.DataTo(&pl); err != nil {
+			return err
+		}
+		pl.ID = doc.Ref.ID
+		normalizePlaylistItems(&pl)
+		if !CanEditPlaylistItems(&pl, edit.By) {
+			return ErrPlaylistForbidden
+		}
+		if edit.IfSnapshot != "" && edit.IfSnapshot != pl.SnapshotID {
+			return ErrStaleSnapshot
+		}
+		if pl.SnapshotID == "" {
+			// Keep the state from before history was recorded, so the
+			// first change can be undone too
+			pl.SnapshotID = newShortID()
+			initial := playlistSnapshot(pl, PlaylistEdit{By: pl.UserID, Action: "initial"})
+			initial.CreatedAt = pl.CreatedAt
+			if err := tx.Create(snapshotRef(pl.ID, pl.SnapshotID), initial); err != nil {
+				return err
+			}
+			pl.SnapshotCount++
+		}
+
+		name, isPublic := pl.Name, pl.IsPublic
+		if err := fn(&pl); err != nil {
+			return err
+		}
+		ownerOnly := pl.Name != name || pl.IsPublic != isPublic || edit.Action == "restore"
+		if ownerOnly && PlaylistRole(&pl, edit.By) != PlaylistRoleOwner {
+			return ErrPlaylistForbidden
+		}
+		if len(pl.Items) > maxPlaylistItems {
+			return ErrPlaylistFull
+		}
+		normalizePlaylistItems(&pl)
+		pl.SnapshotID = newShortID()
+		if err := tx.Create(snapshotRef(pl.ID, pl.SnapshotID), playlistSnapshot(pl, edit)); err != nil {
+			return err
+		}
+		pl.SnapshotCount++
+		out = pl
+		return tx.Update(ref, []firestore.Update{
+			{Path: "name", Value: pl.Name},
+			{Path: "isPublic", Value: pl.IsPublic},
+			{Path: "items", Value: pl.Items},
+			{Path: "songIds", Value: pl.SongIDs},
+			{Path: "snapshotId", Value: pl.SnapshotID},
+			{Path: "snapshotCount", Value: pl.SnapshotCount},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	indexDoc(playlistSearchDoc(out))
+	if out.SnapshotCount >= maxPlaylistSnapshots+pruneSnapshotsBatch {
+		go prunePlaylistSnapshots(id)
+	}
+	return &out, nil
+}
+
+// InsertPlaylistSongs adds songs before the item at position, or at the end
+// when position is negative. Unless allowDuplicates is set, songs already in
+// the playlist are rejected with ErrDuplicatePlaylistSong.
+func InsertPlaylistSongs(ctx context.Context, playlistID string, edit PlaylistEdit, songIDs []string, position int, allowDuplicates bool) (*models.Playlist, error) {
+	edit.Action = "add"
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		// The closure reruns when the transaction retries; a negative
+		// position has to mean the end of the list each time
+		pos := position
+		if pos > len(pl.Items) {
+			return ErrInvalidPosition
+		}
+		if pos < 0 {
+			pos = len(pl.Items)
+		}
+		if !allowDuplicates {
+			present := make(map[string]bool, len(pl.Items)+len(songIDs))
+			for _, item := range pl.Items {
+				present[item.SongID] = true
+			}
+			for _, songID := range songIDs {
+				if present[songID] {
+					return ErrDuplicatePlaylistSong
+				}
+				present[songID] = true
+			}
+		}
+
+		now := time.Now()
+		added := make([]models.PlaylistItem, len(songIDs))
+		for i, songID := range songIDs {
+			added[i] = models.PlaylistItem{ItemID: newShortID(), SongID: songID, AddedBy: edit.By, AddedAt: now}
+		}
+		pl.Items = slices.Insert(pl.Items, pos, added...)
+		return nil
+	})
+}
+
+// MovePlaylistItems moves length items starting at start to before the item
+// at insertBefore. Positions are counted before the move, so moving a range
+// to before itself or the item right after it changes nothing.
+func MovePlaylistItems(ctx context.Context, playlistID string, edit PlaylistEdit, start, length, insertBefore int) (*models.Playlist, error) {
+	edit.Action = "move"
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		n := len(pl.Items)
+		if start < 0 || length < 1 || start+length > n || insertBefore < 0 || insertBefore > n {
+			return ErrInvalidPosition
+		}
+		if insertBefore >= start && insertBefore <= start+length {
+			return nil
+		}
+		moved := slices.Clone(pl.Items[start : start+length])
+		pl.Items = slices.Delete(pl.Items, start, start+length)
+		if insertBefore > start {
+			insertBefore -= length
+		}
+		pl.Items = slices.Insert(pl.Items, insertBefore, moved...)
+		return nil
+	})
+}
+
+// RemovePlaylistItems removes items by item ID
+func RemovePlaylistItems(ctx context.Context, playlistID string, edit PlaylistEdit, itemIDs []string) (*models.Playlist, error) {
+	edit.Action = "remove"
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		remove := make(map[string]bool, len(itemIDs))
+		for _, id := range itemIDs {
+			remove[id] = true
+		}
+		kept := pl.Items[:0]
+		for _, item := range pl.Items {
+			if !remove[item.ItemID] {
+				kept = append(kept, item)
+			}
+		}
+		if len(pl.Items)-len(kept) != len(remove) {
+			return ErrPlaylistItemNotFound
+		}
+		pl.Items = kept
+		return nil
+	})
+}
+
+// RemovePlaylistSong removes every item of a song
+func RemovePlaylistSong(ctx context.Context, playlistID string, edit PlaylistEdit, songID string) (*models.Playlist, error) {
+	edit.Action = "remove"
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		pl.Items = slices.DeleteFunc(pl.Items, func(item models.PlaylistItem) bool {
+			return item.SongID == songID
+		})
+		return nil
+	})
+}
+
+// setPlaylistSongs replaces a playlist's songs. Items for songs that stay
+// keep their ID and who added them; new songs are added by edit.By.
+func setPlaylistSongs(pl *models.Playlist, edit PlaylistEdit, songIDs []string) {
+	existing := make(map[string][]models.PlaylistItem)
+	for _, item := range pl.Items {
+		existing[item.SongID] = append(existing[item.SongID], item)
+	}
+
+	now := time.Now()
+	items := make([]models.PlaylistItem, len(songIDs))
+	for i, songID := range songIDs {
+		if prev := existing[songID]; len(prev) > 0 {
+			items[i] = prev[0]
+			existing[songID] = prev[1:]
+			continue
+		}
+		items[i] = models.PlaylistItem{ItemID: newShortID(), SongID: songID, AddedBy: edit.By, AddedAt: now}
+	}
+	pl.Items = items
+}
+
+// SetPlaylistSongs replaces a playlist's songs (see setPlaylistSongs)
+func SetPlaylistSongs(ctx context.Context, playlistID string, edit PlaylistEdit, songIDs []string) (*models.Playlist, error) {
+	edit.Action = "update"
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		setPlaylistSongs(pl, edit, songIDs)
+		return nil
+	})
+}
+
+// EditPlaylist renames a playlist (unless name is empty), sets whether it's
+// public (unless isPublic is nil) and replaces its songs (unless songIDs is
+// nil), as one change
+func EditPlaylist(ctx context.Context, playlistID string, edit PlaylistEdit, name string, isPublic *bool, songIDs []string) (*models.Playlist, error) {
+	edit.Action = "update"
+	return MutatePlaylist(ctx, playlistID, edit, func(pl *models.Playlist) error {
+		if name != "" {
+			pl.Name = name
+		}
+		if isPublic != nil {
+			pl.IsPublic = *isPublic
+		}
+		if songIDs != nil {
+			setPlaylistSongs(pl, edit, songIDs)
+		}
+		return nil
+	})
+}
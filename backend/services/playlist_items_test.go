@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"spotify-clone/models"
+)
+
+func TestNormalizePlaylistItemsLegacy(t *testing.T) {
+	pl := &models.Playlist{UserID: "u1", SongIDs: []string{"a", "b"}, CreatedAt: time.Now()}
+	normalizePlaylistItems(pl)
+	if len(pl.Items) != 2 {
+		t.Fatalf("items = %d, want 2", len(pl.Items))
+	}
+	for _, item := range pl.Items {
+		if !isLegacyItem(item) {
+			t.Errorf("item %q not reported as legacy", item.ItemID)
+		}
+	}
+	if item := (models.PlaylistItem{ItemID: newShortID()}); isLegacyItem(item) {
+		t.Errorf("new item %q reported as legacy", item.ItemID)
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/models"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Collaborative playlists
+// Besides its owner, a playlist has members: collaborators can add, move
+// and remove songs, and viewers can open it while it's private. Renaming,
+// visibility, restoring history, members and invites stay with the owner.
+// People join through invite links, which the owner can revoke.
+
+const (
+	PlaylistRoleOwner        = "owner"
+	PlaylistRoleCollaborator = "collaborator"
+	PlaylistRoleViewer       = "viewer"
+)
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteExpired  = errors.New("invite has expired")
+	ErrInvalidRole    = errors.New("role must be collaborator or viewer")
+)
+
+// PlaylistRole is the user's role in a playlist, or "" if they have none
+func PlaylistRole(pl *models.Playlist, uid string) string {
+	if uid == "" {
+		return ""
+	}
+	if pl.UserID == uid {
+		return PlaylistRoleOwner
+	}
+	return pl.Members[uid]
+}
+
+// HidePlaylistMembers clears a playlist's member roles unless the user owns
+// it; everyone else only sees members among its contributors
+func HidePlaylistMembers(pl *models.Playlist, uid string) {
+	if PlaylistRole(pl, uid) != PlaylistRoleOwner {
+		pl.Members = nil
+	}
+}
+
+// CanReadPlaylist reports whether the user can open a playlist
+func CanReadPlaylist(pl *models.Playlist, uid string) bool {
+	return pl.IsPublic || PlaylistRole(pl, uid) != ""
+}
+
+// CanEditPlaylistItems reports whether the user can change a playlist's songs
+func CanEditPlaylistItems(pl *models.Playlist, uid string) bool {
+	role := PlaylistRole(pl, uid)
+	return role == PlaylistRoleOwner || role == PlaylistRoleCollaborator
+}
+
+func validMemberRole(role string) bool {
+	return role == PlaylistRoleCollaborator || role == PlaylistRoleViewer
+}
+
+// GetSharedPlaylists returns the playlists the user is a member of
+func GetSharedPlaylists(ctx context.Context, uid string) ([]models.Playlist, error) {
+	iter := config.FirestoreClient.Collection("playlists").
+		Where("memberIds", "array-contains", uid).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var playlists []models.Playlist
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var pl models.Playlist
+		if err := doc.DataTo(&pl); err != nil {
+			continue
+		}
+		pl.ID = doc.Ref.ID
+		normalizePlaylistItems(&pl)
+		playlists = append(playlists, pl)
+	}
+	return playlists, nil
+}
+
+// SetPlaylistMember adds a member or changes their role
+func SetPlaylistMember(ctx context.Context, playlistID, uid, role string) error {
+	if !validMemberRole(role) {
+		return ErrInvalidRole
+	}
+	_, err := config.FirestoreClient.Collection("playlists").Doc(playlistID).Update(ctx, []firestore.Update{
+		{FieldPath: firestore.FieldPath{"members", uid}, Value: role},
+		{Path: "memberIds", Value: firestore.ArrayUnion(uid)},
+	})
+	if err == nil {
+		indexPlaylistByID(ctx, playlistID)
+	}
+	return err
+}
+
+// RemovePlaylistMember removes a member. Songs they added stay, still
+// credited to them.
+func RemovePlaylistMember(ctx context.Context, playlistID, uid string) error {
+	_, err := config.FirestoreClient.Collection("playlists").Doc(playlistID).Update(ctx, []firestore.Update{
+		{FieldPath: firestore.FieldPath{"members", uid}, Value: firestore.Delete},
+		{Path: "memberIds", Value: firestore.ArrayRemove(uid)},
+	})
+	if err == nil {
+		indexPlaylistByID(ctx, playlistID)
+	}
+	return err
+}
+
+// ---- Invites ----
+
+// CreatePlaylistInvite makes an invite link token for a playlist. A zero
+// expiresIn never expires.
+func CreatePlaylistInvite(ctx context.Context, playlistID, createdBy, role string, expiresIn time.Duration) (*models.PlaylistInvite, error) {
+	if role == "" {
+		role = PlaylistRoleCollaborator
+	}
+	if !validMemberRole(role) {
+		return nil, ErrInvalidRole
+	}
+	invite := models.PlaylistInvite{
+		Token:      strings.ReplaceAll(uuid.NewString(), "-", ""),
+		PlaylistID: playlistID,
+		Role:       role,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now(),
+	}
+	if expiresIn > 0 {
+		expiresAt := invite.CreatedAt.Add(expiresIn)
+		invite.ExpiresAt = &expiresAt
+	}
+	if _, err := config.FirestoreClient.Collection("playlistInvites").Doc(invite.Token).Set(ctx, invite); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// GetPlaylistInvite returns an invite that can still be used
+func GetPlaylistInvite(ctx context.Context, token string) (*models.PlaylistInvite, error) {
+	if token == "" || strings.Contains(token, "/") {
+		return nil, ErrInviteNotFound
+	}
+	doc, err := config.FirestoreClient.Collection("playlistInvites").Doc(token).Get(ctx)
+	if err != nil {
+		return nil, ErrInviteNotFound
+	}
+	var invite models.PlaylistInvite
+	if err := doc.DataTo(&invite); err != nil {
+		return nil, ErrInviteNotFound
+	}
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		return nil, ErrInviteExpired
+	}
+	return &invite, nil
+}
+
+// inviteSorts orders a playlist's invites
+var inviteSorts = map[string]sortOrder{
+	"newest": {"createdAt", firestore.Desc, "time"},
+}
+
+// GetPlaylistInvites returns a page of a playlist's invites, newest first
+func GetPlaylistInvites(ctx context.Context, playlistID, cursor string, limit int) ([]models.PlaylistInvite, string, error) {
+	q := config.FirestoreClient.Collection("playlistInvites").Where("playlistId", "==", playlistID)
+	docs, next, _, err := pageQuery(ctx, q, inviteSorts, "newest", cursor, limit, false, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	invites := make([]models.PlaylistInvite, 0, len(docs))
+	for _, doc := range docs {
+		var invite models.PlaylistInvite
+		if err := doc.DataTo(&invite); err != nil {
+			continue
+		}
+		invites = append(invites, invite)
+	}
+	return invites, next, nil
+}
+
+// RevokePlaylistInvite deletes an invite so its link stops working
+func RevokePlaylistInvite(ctx context.Context, playlistID, token string) error {
+	if token == "" || strings.Contains(token, "/") {
+		return ErrInviteNotFound
+	}
+	ref := config.FirestoreClient.Collection("playlistInvites").Doc(token)
+	return config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return ErrInviteNotFound
+		}
+		if id, _ := doc.DataAt("playlistId"); id != playlistID {
+			return ErrInviteNotFound
+		}
+		return tx.Delete(ref)
+	})
+}
+
+// AcceptPlaylistInvite makes the user a member of the invite's playlist.
+// Members keep the better of their current role and the invite's, and the
+// owner stays the owner.
+func AcceptPlaylistInvite(ctx context.Context, token, uid string) (*models.Playlist, error) {
+	invite, err := GetPlaylistInvite(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := config.FirestoreClient.Collection("playlists").Doc(invite.PlaylistID)
+	var out models.Playlist
+	err = config.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			// The playlist was deleted
+			return ErrInviteNotFound
+		}
+		var pl models.Playlist
+		if err := doc.DataTo(&pl); err != nil {
+			return err
+		}
+		pl.ID = doc.Ref.ID
+		normalizePlaylistItems(&pl)
+		out = pl
+
+		role := PlaylistRole(&pl, uid)
+		if role == PlaylistRoleOwner || role == PlaylistRoleCollaborator || role == invite.Role {
+			return nil
+		}
+		if out.Members == nil {
+			out.Members = make(map[string]string)
+		}
+		out.Members[uid] = invite.Role
+		if err := tx.Update(config.FirestoreClient.Collection("playlistInvites").Doc(invite.Token), []firestore.Update{
+			{Path: "uses", Value: firestore.Increment(1)},
+		}); err != nil {
+			return err
+		}
+		return tx.Update(ref, []firestore.Update{
+			{FieldPath: firestore.FieldPath{"members", uid}, Value: invite.Role},
+			{Path: "memberIds", Value: firestore.ArrayUnion(uid)},
+		})
+	})
+	if status.Code(err) == codes.NotFound {
+		// The invite was revoked meanwhile
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(out.MemberIDs, uid) && out.UserID != uid {
+		out.MemberIDs = append(out.MemberIDs, uid)
+	}
+	indexDoc(playlistSearchDoc(out))
+	return &out, nil
+}
+
+// deletePlaylistInvites deletes a playlist's invites with the playlist
+func deletePlaylistInvites(ctx context.Context, playlistID string) {
+	iter := config.FirestoreClient.Collection("playlistInvites").
+		Where("playlistId", "==", playlistID).
+		Select().
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			slog.Warn("failed to delete playlist invites", "playlist", playlistID, "err", err)
+			return
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			slog.Warn("failed to delete playlist invite", "playlist", playlistID, "err", err)
+		}
+	}
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"context"
-	"math/rand"
+	"hash/fnv"
 	"sort"
+	"time"
 
 	"spotify-clone/config"
 	"spotify-clone/models"
+	"spotify-clone/utils"
 
 	"google.golang.org/api/iterator"
 )
@@ -16,20 +18,26 @@ type ScoredSong struct {
 	Score float64
 }
 
-func GetRecommendations(ctx context.Context, userID string, limit int) ([]models.Song, error) {
+// GetRecommendations returns a page of songs picked for the user, best
+// first, the next page's cursor and how many there are
+func GetRecommendations(ctx context.Context, userID, cursor string, limit int) ([]models.Song, string, int, error) {
+	cur, err := utils.DecodeCursor(cursor, "recommended")
+	if err != nil {
+		return nil, "", 0, err
+	}
 	user, err := GetUser(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, "", 0, err
 	}
 
 	genreScores := make(map[string]int)
 	artistScores := make(map[string]int)
 
-	for _, songID := range user.LikedSongs {
-		song, err := GetSong(ctx, songID)
-		if err != nil {
-			continue
-		}
+	liked, _, err := GetSongsByIDs(ctx, user.LikedSongs)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	for _, song := range liked {
 		if song.Genre != "" {
 			genreScores[song.Genre]++
 		}
@@ -38,11 +46,11 @@ func GetRecommendations(ctx context.Context, userID string, limit int) ([]models
 		}
 	}
 
-	for _, songID := range user.RecentlyPlayed {
-		song, err := GetSong(ctx, songID)
-		if err != nil {
-			continue
-		}
+	recent, _, err := GetSongsByIDs(ctx, user.RecentlyPlayed)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	for _, song := range recent {
 		if song.Genre != "" {
 			genreScores[song.Genre]++
 		}
@@ -50,7 +58,7 @@ func GetRecommendations(ctx context.Context, userID string, limit int) ([]models
 
 	candidates, err := getRecommendationCandidates(ctx, 100)
 	if err != nil {
-		return nil, err
+		return nil, "", 0, err
 	}
 
 	var scored []ScoredSong
@@ -78,7 +86,7 @@ func GetRecommendations(ctx context.Context, userID string, limit int) ([]models
 		}
 
 		score += float64(song.PlayCount) * 0.1
-		score += rand.Float64() * 5
+		score += recommendationJitter(userID, song.ID)
 
 		scored = append(scored, ScoredSong{Song: song, Score: score})
 	}
@@ -87,12 +95,26 @@ func GetRecommendations(ctx context.Context, userID string, limit int) ([]models
 		return scored[i].Score > scored[j].Score
 	})
 
-	result := make([]models.Song, 0, limit)
-	for i := 0; i < len(scored) && i < limit; i++ {
-		result = append(result, scored[i].Song)
+	ids := make([]string, len(scored))
+	byID := make(map[string]models.Song, len(scored))
+	for i, s := range scored {
+		ids[i] = s.Song.ID
+		byID[s.Song.ID] = s.Song
+	}
+	page, next := utils.IDPage(ids, cur, limit)
+	result := make([]models.Song, len(page))
+	for i, id := range page {
+		result[i] = byID[id]
 	}
+	return result, next, len(ids), nil
+}
 
-	return result, nil
+// recommendationJitter shuffles songs that score about the same. It's fixed
+// for a user and song through the day, so pages of recommendations line up.
+func recommendationJitter(userID, songID string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(userID + "|" + songID + "|" + time.Now().UTC().Format(time.DateOnly)))
+	return float64(h.Sum64()%1000) / 200
 }
 
 func getRecommendationCandidates(ctx context.Context, limit int) ([]models.Song, error) {
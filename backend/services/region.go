@@ -0,0 +1,104 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Regions
+// A region (Spotify calls it a market) is an ISO 3166-1 alpha-2 country code
+// such as "IN" or "US". Providers that support one use it to localize trending
+// feeds and catalog availability; the rest ignore it.
+
+// NormalizeRegion upper-cases a country code, returning "" if it isn't one
+func NormalizeRegion(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 {
+		return ""
+	}
+	r, err := language.ParseRegion(code)
+	if err != nil || !r.IsCountry() {
+		return ""
+	}
+	return r.String()
+}
+
+// DefaultRegion is used when neither the user nor the request names one
+// (DEFAULT_REGION, default "US")
+func DefaultRegion() string {
+	if r := NormalizeRegion(os.Getenv("DEFAULT_REGION")); r != "" {
+		return r
+	}
+	return "US"
+}
+
+// RegionFromAcceptLanguage returns the first country named in an
+// Accept-Language header ("en-IN,en;q=0.9" gives "IN"), or ""
+func RegionFromAcceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return ""
+	}
+	for _, tag := range tags {
+		if r, conf := tag.Region(); conf == language.Exact && r.IsCountry() {
+			return r.String()
+		}
+	}
+	return ""
+}
+
+// regionName returns the English country name, e.g. "India" for "IN"
+func regionName(code string) string {
+	r, err := language.ParseRegion(code)
+	if err != nil {
+		return code
+	}
+	if name := display.English.Regions().Name(r); name != "" {
+		return name
+	}
+	return code
+}
+
+// regionCache holds per-region results such as trending feeds
+type regionCache[T any] struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]regionCacheEntry[T]
+}
+
+type regionCacheEntry[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+func newRegionCache[T any](ttl time.Duration) *regionCache[T] {
+	return &regionCache[T]{ttl: ttl, entries: make(map[string]regionCacheEntry[T])}
+}
+
+func (c *regionCache[T]) get(key string) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *regionCache[T]) set(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = regionCacheEntry[T]{value: value, expiresAt: now.Add(c.ttl)}
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"spotify-clone/models"
+)
+
+// Cross-source track resolution
+// Spotify, Deezer and MusicBrainz only give us metadata. ResolveTrack finds
+// the same recording somewhere we can stream it from - the local catalog,
+// Jamendo, the Internet Archive or YouTube - by scoring candidates on title,
+// artist and duration. The chosen match is stored in "trackMappings" so later
+// plays skip the search.
+
+// ErrNoMatch is returned when no candidate is close enough
+var ErrNoMatch = errors.New("no playable match found")
+
+const (
+	// Minimum score for a candidate to be accepted
+	resolveMinScore = 0.7
+	// Free sources scoring this high end the search before YouTube is tried
+	resolveGoodScore = 0.85
+)
+
+// ExternalTrackFromSpotify converts Spotify metadata
+func ExternalTrackFromSpotify(t SpotifyTrack) models.ExternalTrack {
+	ext := models.ExternalTrack{
+		Source:   "spotify",
+		SourceID: t.ID,
+		Title:    t.Name,
+		Album:    t.Album.Name,
+		Duration: (t.Duration + 500) / 1000,
+		ISRC:     t.ExternalIDs.ISRC,
+	}
+	if len(t.Artists) > 0 {
+		ext.Artist = t.Artists[0].Name
+	}
+	if len(t.Album.Images) > 0 {
+		ext.CoverURL = t.Album.Images[0].URL
+	}
+	return ext
+}
+
+// ExternalTrackFromDeezer converts Deezer metadata
+func ExternalTrackFromDeezer(t DeezerTrack) models.ExternalTrack {
+	return models.ExternalTrack{
+		Source:   "deezer",
+		SourceID: strconv.Itoa(t.ID),
+		Title:    t.Title,
+		Artist:   t.Artist.Name,
+		Album:    t.Album.Title,
+		Duration: t.Duration,
+		ISRC:     t.ISRC,
+		CoverURL: t.Album.CoverXL,
+	}
+}
+
+// LookupExternalTrack fetches metadata for a Spotify or Deezer track ID
+func LookupExternalTrack(source, id string) (*models.ExternalTrack, error) {
+	var ext models.ExternalTrack
+	switch source {
+	case "spotify":
+		t, err := GetSpotifyTrack(id)
+		if err != nil {
+			return nil, err
+		}
+		ext = ExternalTrackFromSpotify(*t)
+	case "deezer":
+		t, err := GetDeezerTrack(id)
+		if err != nil {
+			return nil, err
+		}
+		ext = ExternalTrackFromDeezer(*t)
+	default:
+		return nil, fmt.Errorf("can't look up %s tracks by ID", source)
+	}
+	return &ext, nil
+}
+
+func trackMappingID(source, sourceID string) string {
+	return source + "_" + sourceID
+}
+
+// GetResolvedTrack returns a stored mapping for an external track, if any
+func GetResolvedTrack(ctx context.Context, ext models.ExternalTrack) (*models.TrackMapping, bool) {
+	if ext.SourceID != "" {
+		if m, err := GetTrackMapping(ctx, trackMappingID(ext.Source, ext.SourceID)); err == nil {
+			return m, true
+		}
+	}
+	if ext.ISRC != "" {
+		if m, err := GetTrackMappingByISRC(ctx, ext.ISRC); err == nil {
+			// Same recording resolved from another source; remember it under this ID too
+			if ext.SourceID != "" {
+				m.ID = trackMappingID(ext.Source, ext.SourceID)
+				m.External = ext
+				if err := SaveTrackMapping(ctx, *m); err != nil {
+					slog.Warn("failed to save track mapping", "id", m.ID, "err", err)
+				}
+			}
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// ResolveTrack finds the best playable source for an external track and
+// stores the mapping when the track has a source ID
+func ResolveTrack(ctx context.Context, ext models.ExternalTrack) (*models.TrackMapping, error) {
+	if strings.TrimSpace(ext.Title) == "" {
+		return nil, fmt.Errorf("track title required")
+	}
+
+	// Catalog and free sources first; they're cheap and fully licensed
+	candidates, _ := gatherCandidates(ctx, ext, []candidateSource{
+		catalogCandidates, jamendoCandidates, archiveCandidates,
+	})
+	best := bestCandidate(ext, candidates)
+	var busyErr error
+	if best == nil || best.Score < resolveGoodScore {
+		candidates, busyErr = gatherCandidates(ctx, ext, []candidateSource{youtubeCandidates})
+		if yt := bestCandidate(ext, candidates); yt != nil && (best == nil || yt.Score > best.Score) {
+			best = yt
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if best == nil || best.Score < resolveMinScore {
+		// Not finding YouTube candidates because the pool was full isn't a miss
+		if busyErr != nil {
+			return nil, busyErr
+		}
+		return nil, ErrNoMatch
+	}
+
+	mapping := &models.TrackMapping{
+		ID:         trackMappingID(ext.Source, ext.SourceID),
+		External:   ext,
+		Match:      *best,
+		ResolvedAt: time.Now(),
+	}
+	if ext.SourceID != "" {
+		if err := SaveTrackMapping(ctx, *mapping); err != nil {
+			slog.Warn("failed to save track mapping", "id", mapping.ID, "err", err)
+		}
+	}
+	return mapping, nil
+}
+
+// SongForMatch returns the catalog song ID for a resolved track, creating a
+// stub song for external sources the way the web client and RecordPlay do
+// ("yt-<videoId>" with a "youtube:<videoId>" audio URL, "jam-<id>", ...)
+func SongForMatch(ctx context.Context, ext models.ExternalTrack, match models.PlayableTrack) (string, error) {
+	var id, audioURL string
+	switch match.Source {
+	case "catalog":
+		return match.ID, nil
+	case "youtube":
+		id, audioURL = "yt-"+match.ID, "youtube:"+match.ID
+	case "jamendo":
+		id, audioURL = "jam-"+match.ID, match.AudioURL
+	case "ia":
+		id, audioURL = iaSongID(match.ID), match.AudioURL
+	default:
+		return "", fmt.Errorf("unknown source %q", match.Source)
+	}
+
+	if _, err := GetSong(ctx, id); err == nil {
+		return id, nil
+	}
+
+	// Prefer the external metadata; it's cleaner than upload titles
+	song := models.Song{
+		ID:         id,
+		Title:      ext.Title,
+		ArtistName: ext.Artist,
+		AlbumName:  ext.Album,
+		CoverURL:   ext.CoverURL,
+		AudioURL:   audioURL,
+		Source:     match.Source,
+		Duration:   match.Duration,
+		Status:     "approved",
+		License:    match.License,
+		CreatedAt:  time.Now(),
+	}
+	if song.Title == "" {
+		song.Title = match.Title
+	}
+	if song.ArtistName == "" {
+		song.ArtistName = match.Artist
+	}
+	if song.CoverURL == "" {
+		song.CoverURL = match.CoverURL
+	}
+	if song.Duration == 0 {
+		song.Duration = ext.Duration
+	}
+	if err := CreateSongWithID(ctx, id, song); err != nil {
+		return "", err
+	}
+	EnqueueEnrichment(id)
+	return id, nil
+}
+
+// iaSongID is the song ID of an IA file given as "identifier/file", which
+// can't be a document ID itself
+func iaSongID(file string) string {
+	sum := sha1.Sum([]byte(file))
+	return "ia-" + hex.EncodeToString(sum[:8])
+}
+
+// candidateSource searches one provider for an external track
+type candidateSource func(ctx context.Context, ext models.ExternalTrack) ([]models.PlayableTrack, error)
+
+// gatherCandidates queries the sources concurrently. Failing sources are
+// skipped; the returned error is set only when one was ErrExtractorBusy.
+func gatherCandidates(ctx context.Context, ext models.ExternalTrack, sources []candidateSource) ([]models.PlayableTrack, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		all     []models.PlayableTrack
+		busyErr error
+	)
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src candidateSource) {
+			defer wg.Done()
+			found, err := src(ctx, ext)
+			if err != nil {
+				slog.Debug("resolver source failed", "err", err)
+				if errors.Is(err, ErrExtractorBusy) {
+					mu.Lock()
+					busyErr = err
+					mu.Unlock()
+				}
+				return
+			}
+			mu.Lock()
+			all = append(all, found...)
+			mu.Unlock()
+		}(src)
+	}
+	wg.Wait()
+	return all, busyErr
+}
+
+func catalogCandidates(ctx context.Context, ext models.ExternalTrack) ([]models.PlayableTrack, error) {
+	songs, err := SearchSongs(ctx, ext.Title, 10)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.PlayableTrack
+	for _, s := range songs {
+		// Only uploads; stubs of external tracks are found through their provider
+		if s.Source != "upload" || s.AudioURL == "" {
+			continue
+		}
+		out = append(out, models.PlayableTrack{
+			Source:   "catalog",
+			ID:       s.ID,
+			Title:    s.Title,
+			Artist:   s.ArtistName,
+			Duration: s.Duration,
+			AudioURL: s.AudioURL,
+			CoverURL: s.CoverURL,
+		})
+	}
+	return out, nil
+}
+
+func jamendoCandidates(ctx context.Context, ext models.ExternalTrack) ([]models.PlayableTrack, error) {
+	if getJamendoClientID() == "" {
+		return nil, nil
+	}
+	tracks, err := SearchJamendo(ext.Title, 10)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.PlayableTrack
+	for _, t := range tracks {
+		out = append(out, models.PlayableTrack{
+			Source:   "jamendo",
+			ID:       t.ID,
+			Title:    t.Name,
+			Artist:   t.ArtistName,
+			Duration: int(t.Duration),
+			AudioURL: t.Audio,
+			CoverURL: t.AlbumImage,
+			License:  t.LicenseURL,
+		})
+	}
+	return out, nil
+}
+
+func archiveCandidates(ctx context.Context, ext models.ExternalTrack) ([]models.PlayableTrack, error) {
+	query := fmt.Sprintf("title:(%s)", matchText(ext.Title))
+	if artist := matchText(ext.Artist); artist != "" {
+		query += fmt.Sprintf(" AND creator:(%s)", artist)
+	}
+	items, err := SearchInternetArchive(query, 3)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.PlayableTrack
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		files, err := GetIAItemFiles(item.Identifier)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			title := f.Title
+			if title == "" {
+				title = item.Title
+			}
+			out = append(out, models.PlayableTrack{
+				Source:   "ia",
+				ID:       item.Identifier + "/" + f.Name,
+				Title:    title,
+				Artist:   item.Creator,
+				Duration: ParseIALength(f.Length),
+				AudioURL: GetIAStreamURL(item.Identifier, f.Name),
+			})
+		}
+	}
+	return out, nil
+}
+
+func youtubeCandidates(ctx context.Context, ext models.ExternalTrack) ([]models.PlayableTrack, error) {
+	tracks, err := SearchYouTubeMusic(ctx, strings.TrimSpace(ext.Artist+" "+ext.Title), 8)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.PlayableTrack
+	for _, t := range tracks {
+		title := t.Title
+		if t.Version != "" && t.Version != "lyric video" {
+			// Keep the version visible to the scorer ("Song (Live)")
+			title += " (" + t.Version + ")"
+		}
+		out = append(out, models.PlayableTrack{
+			Source:   "youtube",
+			ID:       t.VideoID,
+			Title:    title,
+			Artist:   t.Artist,
+			Duration: t.Duration,
+			CoverURL: t.Thumbnail,
+		})
+	}
+	return out, nil
+}
+
+// bestCandidate scores every candidate and returns the highest
+func bestCandidate(ext models.ExternalTrack, candidates []models.PlayableTrack) *models.PlayableTrack {
+	var best *models.PlayableTrack
+	for i := range candidates {
+		c := &candidates[i]
+		c.Score = scoreCandidate(ext, *c)
+		if best == nil || c.Score > best.Score {
+			best = c
+		}
+	}
+	return best
+}
+
+// Per-source bonus so an equally good match prefers our own and free sources
+var candidateSourceBonus = map[string]float64{
+	"catalog": 0.05,
+	"jamendo": 0.02,
+	"ia":      0.02,
+}
+
+// scoreCandidate weighs title (45%), artist (35%) and duration (20%)
+// similarity. A version the external track doesn't mention (live, remix,
+// ...) is penalized.
+func scoreCandidate(ext models.ExternalTrack, c models.PlayableTrack) float64 {
+	title := textSimilarity(matchText(ext.Title), matchText(c.Title))
+	artist := textSimilarity(matchText(ext.Artist), matchText(c.Artist))
+	if ext.Artist == "" {
+		artist = 0.5
+	} else if artist < 0.5 && strings.Contains(matchText(c.Title), matchText(ext.Artist)) {
+		// Compilation uploads often credit the artist only in the title
+		artist = 0.7
+	}
+
+	score := 0.45*title + 0.35*artist + 0.2*durationSimilarity(ext.Duration, c.Duration)
+	if versionMismatch(ext.Title, c.Title) {
+		score -= 0.3
+	}
+	return score + candidateSourceBonus[c.Source]
+}
+
+// durationSimilarity is 1 within 3 seconds, falling to 0 at 30 seconds apart.
+// Unknown durations score neutrally.
+func durationSimilarity(a, b int) float64 {
+	if a <= 0 || b <= 0 {
+		return 0.5
+	}
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	switch {
+	case diff <= 3:
+		return 1
+	case diff >= 30:
+		return 0
+	}
+	return 1 - float64(diff-3)/27
+}
+
+// Words marking a different recording of the same song
+var versionWords = []string{"live", "remix", "acoustic", "instrumental", "karaoke", "cover", "slowed", "sped up", "nightcore", "8d", "reverb"}
+
+func versionMismatch(want, got string) bool {
+	want, got = " "+matchText(want)+" ", " "+matchText(got)+" "
+	for _, w := range versionWords {
+		if strings.Contains(got, " "+w+" ") != strings.Contains(want, " "+w+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchText lower-cases s, drops "feat." credits and punctuation, and
+// collapses whitespace
+func matchText(s string) string {
+	s = strings.ToLower(s)
+	for _, marker := range []string{" feat.", " feat ", " ft.", " ft ", " featuring "} {
+		if i := strings.Index(s, marker); i > 0 {
+			s = s[:i]
+		}
+	}
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// textSimilarity is the Dice coefficient over character bigrams, raised to
+// 0.9 when one string contains the other ("Song" vs "Song Remastered")
+func textSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	dice := bigramDice(a, b)
+	if len(a) >= 4 && len(b) >= 4 && (strings.Contains(a, b) || strings.Contains(b, a)) && dice < 0.9 {
+		return 0.9
+	}
+	return dice
+}
+
+func bigramDice(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+	counts := make(map[[2]rune]int)
+	for i := 0; i < len(ra)-1; i++ {
+		counts[[2]rune{ra[i], ra[i+1]}]++
+	}
+	shared := 0
+	for i := 0; i < len(rb)-1; i++ {
+		bg := [2]rune{rb[i], rb[i+1]}
+		if counts[bg] > 0 {
+			counts[bg]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ra)-1+len(rb)-1)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+
+	"spotify-clone/models"
+)
+
+func TestScoreCandidate(t *testing.T) {
+	ext := models.ExternalTrack{Source: "spotify", Title: "Blinding Lights", Artist: "The Weeknd", Duration: 200}
+	tests := []struct {
+		name   string
+		ext    models.ExternalTrack
+		c      models.PlayableTrack
+		accept bool
+	}{
+		{"exact", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights", Artist: "The Weeknd", Duration: 200}, true},
+		{"case and punctuation", ext, models.PlayableTrack{Source: "youtube", Title: "BLINDING LIGHTS!", Artist: "the weeknd", Duration: 201}, true},
+		{"featured artist", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights feat. Someone", Artist: "The Weeknd", Duration: 200}, true},
+		{"remastered", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights Remastered", Artist: "The Weeknd", Duration: 202}, true},
+		{"live", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights (Live)", Artist: "The Weeknd", Duration: 200}, false},
+		{"remix", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights - Remix", Artist: "The Weeknd", Duration: 200}, false},
+		{"sped up", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights (sped up)", Artist: "The Weeknd", Duration: 160}, false},
+		{"live wanted", models.ExternalTrack{Title: "Blinding Lights (Live)", Artist: "The Weeknd", Duration: 230},
+			models.PlayableTrack{Source: "youtube", Title: "Blinding Lights - Live", Artist: "The Weeknd", Duration: 231}, true},
+		{"duration drift within tolerance", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights", Artist: "The Weeknd", Duration: 203}, true},
+		{"duration drift and other artist", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights", Artist: "Weekend Band", Duration: 260}, false},
+		{"artist channel", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights", Artist: "The Weeknd - Topic", Duration: 200}, true},
+		{"artist accent", models.ExternalTrack{Title: "Halo", Artist: "Beyoncé", Duration: 261},
+			models.PlayableTrack{Source: "youtube", Title: "Halo", Artist: "Beyonce", Duration: 261}, true},
+		{"artist only in title", ext, models.PlayableTrack{Source: "ia", Title: "The Weeknd - Blinding Lights", Artist: "Various Artists", Duration: 200}, true},
+		{"other artist", ext, models.PlayableTrack{Source: "youtube", Title: "Blinding Lights", Artist: "Some Cover Band", Duration: 215}, false},
+		// Labels upload under their own channel, so an exact title and
+		// duration carry an unknown artist
+		{"label upload", models.ExternalTrack{Title: "Tum Hi Ho", Artist: "Arijit Singh", Duration: 262},
+			models.PlayableTrack{Source: "youtube", Title: "Tum Hi Ho", Artist: "T-Series", Duration: 262}, true},
+		{"other song", ext, models.PlayableTrack{Source: "youtube", Title: "Save Your Tears", Artist: "The Weeknd", Duration: 215}, false},
+	}
+	for _, tt := range tests {
+		score := scoreCandidate(tt.ext, tt.c)
+		if (score >= resolveMinScore) != tt.accept {
+			t.Errorf("%s: score %.3f, accept = %v", tt.name, score, tt.accept)
+		}
+	}
+}
+
+func TestBestCandidatePrefersCloserDurationAndCatalog(t *testing.T) {
+	ext := models.ExternalTrack{Title: "Song", Artist: "Artist", Duration: 180}
+	best := bestCandidate(ext, []models.PlayableTrack{
+		{Source: "youtube", ID: "far", Title: "Song", Artist: "Artist", Duration: 240},
+		{Source: "youtube", ID: "near", Title: "Song", Artist: "Artist", Duration: 181},
+	})
+	if best.ID != "near" {
+		t.Errorf("best = %s, want near", best.ID)
+	}
+
+	best = bestCandidate(ext, []models.PlayableTrack{
+		{Source: "youtube", ID: "yt", Title: "Song", Artist: "Artist", Duration: 180},
+		{Source: "catalog", ID: "cat", Title: "Song", Artist: "Artist", Duration: 180},
+	})
+	if best.ID != "cat" {
+		t.Errorf("best = %s, want the catalog song", best.ID)
+	}
+}
+
+func TestDurationSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b int
+		want float64
+	}{
+		{200, 200, 1},
+		{200, 203, 1},
+		{203, 200, 1},
+		{200, 230, 0},
+		{200, 300, 0},
+		{0, 200, 0.5},
+		{200, 0, 0.5},
+	}
+	for _, tt := range tests {
+		if got := durationSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("durationSimilarity(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if mid := durationSimilarity(200, 216); mid <= 0 || mid >= 1 {
+		t.Errorf("durationSimilarity(200, 216) = %v, want between 0 and 1", mid)
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	tests := []struct {
+		want, got string
+		mismatch  bool
+	}{
+		{"Song", "Song", false},
+		{"Song", "Song (Live at Wembley)", true},
+		{"Song (Live)", "Song - Live", false},
+		{"Song", "Song Remix", true},
+		{"Song (Remix)", "Song", true},
+		{"Song", "Song (Acoustic)", true},
+		{"Alive", "Alive", false},
+		{"Song", "Song Official Video", false},
+	}
+	for _, tt := range tests {
+		if got := versionMismatch(tt.want, tt.got); got != tt.mismatch {
+			t.Errorf("versionMismatch(%q, %q) = %v", tt.want, tt.got, got)
+		}
+	}
+}
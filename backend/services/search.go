@@ -0,0 +1,464 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"spotify-clone/config"
+	"spotify-clone/models"
+
+	"google.golang.org/api/iterator"
+)
+
+// Search
+// Keeps the full-text index in sync with Firestore: documents are indexed on
+// create, update and delete (see the hooks in firestore.go), the index is
+// saved to SEARCH_INDEX_PATH periodically and loaded at startup. It's
+// rebuilt from Firestore when there's no usable saved index, and on demand
+// through the admin API, e.g. after writes this instance didn't see. Until
+// it's loaded, SearchSongs and SearchArtists fall back to scanning Firestore.
+
+var (
+	searchIdx        atomic.Pointer[searchIndex]
+	searchReady      atomic.Bool
+	searchRebuilding atomic.Bool
+	searchInitOnce   sync.Once
+
+	// Changes made while a rebuild runs, replayed onto the new index since
+	// its scan may have read the documents before they changed
+	searchPending   []func(*searchIndex)
+	searchPendingMu sync.Mutex
+)
+
+func searchIndexPath() string {
+	if p := os.Getenv("SEARCH_INDEX_PATH"); p != "" {
+		return p
+	}
+	return "./data/search-index.json.gz"
+}
+
+func getSearchIndex() *searchIndex {
+	if idx := searchIdx.Load(); idx != nil {
+		return idx
+	}
+	searchIdx.CompareAndSwap(nil, newSearchIndex())
+	return searchIdx.Load()
+}
+
+// InitSearchIndex loads the saved index, rebuilding it in the background
+// when it's missing, unreadable or from an older version, and starts saving
+// changes periodically
+func InitSearchIndex() {
+	searchInitOnce.Do(func() {
+		path := searchIndexPath()
+		if idx, err := loadSearchIndex(path); err == nil {
+			searchIdx.Store(idx)
+			searchReady.Store(true)
+			slog.Info("search index loaded", "path", path, "docs", idx.count())
+		} else {
+			if !os.IsNotExist(err) {
+				slog.Warn("failed to load search index, rebuilding", "path", path, "err", err)
+			}
+			StartSearchReindex()
+		}
+
+		go loadPopularQueries(context.Background())
+
+		go func() {
+			interval := envDuration("SEARCH_INDEX_SAVE_INTERVAL", 30*time.Second)
+			for {
+				time.Sleep(interval)
+				saveSearchIndex()
+			}
+		}()
+	})
+}
+
+func saveSearchIndex() {
+	idx := getSearchIndex()
+	idx.mu.RLock()
+	dirty := idx.dirty
+	idx.mu.RUnlock()
+	if !dirty || !searchReady.Load() {
+		return
+	}
+	if err := idx.save(searchIndexPath()); err != nil {
+		slog.Warn("failed to save search index", "err", err)
+	}
+}
+
+// ErrReindexRunning is returned when a rebuild is already in progress
+var ErrReindexRunning = fmt.Errorf("search index rebuild already running")
+
+// RebuildSearchIndex indexes every song, artist, album, playlist and user
+// into a fresh index, swaps it in and saves it. The live index keeps being
+// updated meanwhile; those changes are replayed onto the new one.
+func RebuildSearchIndex(ctx context.Context) error {
+	searchPendingMu.Lock()
+	if !searchRebuilding.CompareAndSwap(false, true) {
+		searchPendingMu.Unlock()
+		return ErrReindexRunning
+	}
+	searchPending = nil
+	searchPendingMu.Unlock()
+	defer func() {
+		searchPendingMu.Lock()
+		searchPending = nil
+		searchRebuilding.Store(false)
+		searchPendingMu.Unlock()
+	}()
+
+	started := time.Now()
+	idx := newSearchIndex()
+	artistNames := make(map[string]string)
+
+	err := scanCollection(ctx, "artists", func(id string, data func(interface{}) error) {
+		var a models.Artist
+		if data(&a) == nil {
+			a.UID = id
+			artistNames[id] = a.DisplayName
+			idx.put(artistSearchDoc(a))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index artists: %v", err)
+	}
+	err = scanCollection(ctx, "songs", func(id string, data func(interface{}) error) {
+		var s models.Song
+		if data(&s) == nil {
+			s.ID = id
+			idx.put(songSearchDoc(s))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index songs: %v", err)
+	}
+	err = scanCollection(ctx, "albums", func(id string, data func(interface{}) error) {
+		var a models.Album
+		if data(&a) == nil {
+			a.ID = id
+			idx.put(albumSearchDoc(a, artistNames[a.ArtistID]))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index albums: %v", err)
+	}
+	err = scanCollection(ctx, "playlists", func(id string, data func(interface{}) error) {
+		var p models.Playlist
+		if data(&p) == nil {
+			p.ID = id
+			idx.put(playlistSearchDoc(p))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index playlists: %v", err)
+	}
+	err = scanCollection(ctx, "users", func(id string, data func(interface{}) error) {
+		var u models.User
+		if data(&u) == nil {
+			u.UID = id
+			idx.put(userSearchDoc(u))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index users: %v", err)
+	}
+
+	searchPendingMu.Lock()
+	for _, apply := range searchPending {
+		apply(idx)
+	}
+	replayed := len(searchPending)
+	searchPending = nil
+	idx.rebuildSuggest()
+	searchIdx.Store(idx)
+	searchPendingMu.Unlock()
+	searchReady.Store(true)
+	slog.Info("search index rebuilt", "docs", idx.count(), "replayed", replayed, "took", time.Since(started))
+	if err := idx.save(searchIndexPath()); err != nil {
+		slog.Warn("failed to save search index", "err", err)
+	}
+	return nil
+}
+
+// StartSearchReindex runs RebuildSearchIndex in the background
+func StartSearchReindex() error {
+	if searchRebuilding.Load() {
+		return ErrReindexRunning
+	}
+	go func() {
+		if err := RebuildSearchIndex(context.Background()); err != nil && err != ErrReindexRunning {
+			slog.Warn("search index rebuild failed", "err", err)
+		}
+	}()
+	return nil
+}
+
+// scanCollection iterates over every document of a collection
+func scanCollection(ctx context.Context, name string, fn func(id string, data func(interface{}) error)) error {
+	iter := config.FirestoreClient.Collection(name).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(doc.Ref.ID, doc.DataTo)
+	}
+}
+
+// GetSearchIndexStatus reports index size and state for /health
+func GetSearchIndexStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"ready":      searchReady.Load(),
+		"rebuilding": searchRebuilding.Load(),
+		"docs":       getSearchIndex().count(),
+	}
+}
+
+// ---- Documents ----
+
+func songSearchDoc(s models.Song) *SearchDoc {
+	tags := append([]string{s.Genre}, s.Tags...)
+	tags = append(tags, s.Genres...)
+	facets, numbers := songFacets(s)
+	return &SearchDoc{
+		Type: "song",
+		ID:   s.ID,
+		Fields: map[string]string{
+			"title":  s.Title,
+			"artist": strings.Join(append([]string{s.ArtistName}, s.FeaturedArtists...), " "),
+			"album":  s.AlbumName,
+			"tags":   strings.Join(tags, " "),
+		},
+		Status:     s.Status,
+		Public:     true,
+		OwnerID:    s.ArtistID,
+		Popularity: float64(s.PlayCount),
+		Image:      s.CoverURL,
+		AlbumID:    s.AlbumID,
+		Facets:     facets,
+		Numbers:    numbers,
+		Source:     mustJSON(s),
+	}
+}
+
+func artistSearchDoc(a models.Artist) *SearchDoc {
+	return &SearchDoc{
+		Type:       "artist",
+		ID:         a.UID,
+		Fields:     map[string]string{"title": a.DisplayName},
+		Status:     a.Status,
+		Public:     true,
+		OwnerID:    a.UID,
+		Popularity: float64(a.FollowerCount),
+		Image:      a.PhotoURL,
+		Source:     mustJSON(a),
+	}
+}
+
+func albumSearchDoc(a models.Album, artistName string) *SearchDoc {
+	return &SearchDoc{
+		Type:    "album",
+		ID:      a.ID,
+		Fields:  map[string]string{"title": a.Title, "artist": artistName},
+		Public:  true,
+		OwnerID: a.ArtistID,
+		Image:   a.CoverURL,
+		Source:  mustJSON(a),
+	}
+}
+
+// userSearchDoc indexes only the public part of a profile
+func userSearchDoc(u models.User) *SearchDoc {
+	return &SearchDoc{
+		Type:    "user",
+		ID:      u.UID,
+		Fields:  map[string]string{"title": u.DisplayName},
+		Public:  true,
+		OwnerID: u.UID,
+		Image:   u.PhotoURL,
+		Source: mustJSON(models.UserSummary{
+			UID:         u.UID,
+			DisplayName: u.DisplayName,
+			PhotoURL:    u.PhotoURL,
+			Role:        u.Role,
+		}),
+	}
+}
+
+func playlistSearchDoc(p models.Playlist) *SearchDoc {
+	p.Items = nil   // results only need the song IDs
+	p.Members = nil // roles are for the owner
+	return &SearchDoc{
+		Type:      "playlist",
+		ID:        p.ID,
+		Fields:    map[string]string{"title": p.Name},
+		Public:    p.IsPublic,
+		OwnerID:   p.UserID,
+		MemberIDs: p.MemberIDs,
+		Source:    mustJSON(p),
+	}
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+// ---- Incremental updates ----
+
+// updateIndex applies a change to the live index, and keeps it for replay
+// when a rebuild is running
+func updateIndex(apply func(*searchIndex)) {
+	searchPendingMu.Lock()
+	defer searchPendingMu.Unlock()
+	if searchRebuilding.Load() {
+		searchPending = append(searchPending, apply)
+	}
+	apply(getSearchIndex())
+}
+
+func indexDoc(doc *SearchDoc) {
+	updateIndex(func(idx *searchIndex) { idx.put(doc) })
+}
+
+// indexSongByID re-reads a song and updates the index
+func indexSongByID(ctx context.Context, id string) {
+	if song, err := GetSong(ctx, id); err == nil {
+		indexDoc(songSearchDoc(*song))
+	}
+}
+
+func indexArtistByID(ctx context.Context, uid string) {
+	if artist, err := GetArtist(ctx, uid); err == nil {
+		indexDoc(artistSearchDoc(*artist))
+	}
+}
+
+func indexAlbum(ctx context.Context, album models.Album) {
+	artistName := ""
+	if artist, err := GetArtist(ctx, album.ArtistID); err == nil {
+		artistName = artist.DisplayName
+	}
+	indexDoc(albumSearchDoc(album, artistName))
+}
+
+func indexUserByID(ctx context.Context, uid string) {
+	if user, err := GetUser(ctx, uid); err == nil {
+		user.UID = uid
+		indexDoc(userSearchDoc(*user))
+	}
+}
+
+func indexPlaylistByID(ctx context.Context, id string) {
+	if playlist, err := GetPlaylist(ctx, id); err == nil {
+		indexDoc(playlistSearchDoc(*playlist))
+	}
+}
+
+func unindex(docType, id string) {
+	updateIndex(func(idx *searchIndex) { idx.remove(docType, id) })
+}
+
+// ---- Queries ----
+
+// searchDocs runs a query against the index, keeping docs accepted by filter
+func searchDocs(query string, limit int, filter func(*SearchDoc) bool) []SearchHit {
+	hits := getSearchIndex().search(query, filter)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// searchPage returns hits offset..offset+limit and the total match count
+func searchPage(query string, offset, limit int, filter func(*SearchDoc) bool) ([]SearchHit, int) {
+	hits := getSearchIndex().search(query, filter)
+	return pageOf(hits, offset, limit), len(hits)
+}
+
+func pageOf[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+// decodeHits unmarshals the stored models of hits into T
+func decodeHits[T any](hits []SearchHit) []T {
+	out := make([]T, 0, len(hits))
+	for _, h := range hits {
+		var v T
+		if json.Unmarshal(h.Doc.Source, &v) == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func ofType(docType string, extra func(*SearchDoc) bool) func(*SearchDoc) bool {
+	return func(d *SearchDoc) bool {
+		return d.Type == docType && (extra == nil || extra(d))
+	}
+}
+
+func approved(d *SearchDoc) bool { return d.Status == "approved" }
+
+// searchIndexedSongs returns approved songs matching the query, best first
+func searchIndexedSongs(query string, limit int) []models.Song {
+	return decodeHits[models.Song](searchDocs(query, limit, ofType("song", approved)))
+}
+
+// searchIndexedArtists returns approved artists matching the query, best first
+func searchIndexedArtists(query string, limit int) []models.Artist {
+	return decodeHits[models.Artist](searchDocs(query, limit, ofType("artist", approved)))
+}
+
+// SearchArtistsPage returns a page of approved artists matching the query
+// and the total number of matches
+func SearchArtistsPage(ctx context.Context, query string, offset, limit int) ([]models.Artist, int, error) {
+	if !searchReady.Load() {
+		artists, err := SearchArtists(ctx, query, offset+limit)
+		return pageOf(artists, offset, limit), len(artists), err
+	}
+	hits, total := searchPage(query, offset, limit, ofType("artist", approved))
+	return decodeHits[models.Artist](hits), total, nil
+}
+
+// SearchAlbums returns a page of albums matching the query and the total
+// number of matches
+func SearchAlbums(ctx context.Context, query string, offset, limit int) ([]models.Album, int, error) {
+	hits, total := searchPage(query, offset, limit, ofType("album", nil))
+	return decodeHits[models.Album](hits), total, nil
+}
+
+// SearchPlaylists returns a page of playlists matching the query: public
+// ones, and private ones uid owns or is a member of
+func SearchPlaylists(ctx context.Context, query, uid string, offset, limit int) ([]models.Playlist, int, error) {
+	visible := func(d *SearchDoc) bool {
+		return d.Public || (uid != "" && (d.OwnerID == uid || slices.Contains(d.MemberIDs, uid)))
+	}
+	hits, total := searchPage(query, offset, limit, ofType("playlist", visible))
+	return decodeHits[models.Playlist](hits), total, nil
+}
+
+// SearchUsers returns a page of user profiles matching the query
+func SearchUsers(ctx context.Context, query string, offset, limit int) ([]models.UserSummary, int, error) {
+	hits, total := searchPage(query, offset, limit, ofType("user", nil))
+	return decodeHits[models.UserSummary](hits), total, nil
+}
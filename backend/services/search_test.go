@@ -0,0 +1,74 @@
+package services
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateIndexReplaysChangesMadeDuringRebuild(t *testing.T) {
+	live := newSearchIndex()
+	searchIdx.Store(live)
+	t.Cleanup(func() { searchIdx.Store(nil) })
+
+	song := func(id, title string) *SearchDoc {
+		return &SearchDoc{Type: "song", ID: id, Fields: map[string]string{"title": title}, Public: true}
+	}
+	indexDoc(song("s0", "Before"))
+	if len(searchPending) != 0 {
+		t.Fatal("change kept with no rebuild running")
+	}
+
+	// A rebuild scanned s1 and s2 before these changes
+	searchRebuilding.Store(true)
+	t.Cleanup(func() { searchRebuilding.Store(false); searchPending = nil })
+	rebuilt := newSearchIndex()
+	rebuilt.put(song("s1", "Old Title"))
+	rebuilt.put(song("s2", "Deleted"))
+
+	indexDoc(song("s1", "New Title"))
+	unindex("song", "s2")
+	if len(live.search("new title", nil)) != 1 {
+		t.Error("live index not updated during the rebuild")
+	}
+
+	for _, apply := range searchPending {
+		apply(rebuilt)
+	}
+	if hits := rebuilt.search("new title", nil); len(hits) != 1 || hits[0].Doc.ID != "s1" {
+		t.Errorf("update not replayed: %v", hits)
+	}
+	if hits := rebuilt.search("deleted", nil); len(hits) != 0 {
+		t.Error("removal not replayed")
+	}
+}
+
+func TestSearchIndexSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json.gz")
+	idx := newSearchIndex()
+	idx.put(&SearchDoc{Type: "song", ID: "s1", Fields: map[string]string{"title": "Tum Hi Ho"}, Public: true})
+	if err := idx.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSearchIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := loaded.search("tum hi ho", nil); len(hits) != 1 || hits[0].Doc.ID != "s1" {
+		t.Errorf("loaded index search = %v", hits)
+	}
+
+	// Files from before the index was versioned hold a bare document list
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(`[{"type":"song","id":"s1"}]`))
+	zw.Close()
+	f.Close()
+	if _, err := loadSearchIndex(path); err == nil {
+		t.Error("loaded an unversioned index")
+	}
+}
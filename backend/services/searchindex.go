@@ -0,0 +1,428 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Full-text index
+// An in-memory inverted index over songs, artists, albums, playlists and users,
+// ranked with BM25F: term frequencies are weighted per field (title over
+// artist over album over tags) and normalized by field length before BM25
+// saturation. Query terms also match indexed terms they're a prefix of, and
+// terms within a few typos of them (found through a trigram index). Only the
+// indexed documents are persisted; postings are rebuilt from them on load.
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// Weight of a term matched as a prefix of an indexed term
+	prefixMatchWeight = 0.5
+	// Cap on indexed terms a single query prefix can expand to
+	maxPrefixExpansions = 50
+	// Weight of a term matched within maxEditDistance typos
+	fuzzyMatchWeight = 0.4
+	// Share of a query term's trigrams a fuzzy candidate has to contain
+	minTrigramOverlap = 0.4
+	// Version of the saved index file; bump it when SearchDoc changes so
+	// older files are rebuilt instead of loaded
+	searchIndexVersion = 2
+)
+
+// searchIndexFile is the saved form of an index
+type searchIndexFile struct {
+	Version int          `json:"version"`
+	Docs    []*SearchDoc `json:"docs"`
+}
+
+// searchFieldBoosts weighs matches per field
+var searchFieldBoosts = map[string]float64{
+	"title":  3,
+	"artist": 2,
+	"album":  1,
+	"tags":   0.5,
+}
+
+// SearchDoc is one indexed document
+type SearchDoc struct {
+	Type    string            `json:"type"` // song, artist, album, playlist, user
+	ID      string            `json:"id"`
+	Fields  map[string]string `json:"fields"`
+	Status  string            `json:"status,omitempty"` // songs and artists
+	Public  bool              `json:"public"`
+	OwnerID string            `json:"ownerId,omitempty"`
+	// Members of a playlist, who can find it while it's private
+	MemberIDs []string `json:"memberIds,omitempty"`
+	// For suggestions: play or follower count, artwork and a song's album
+	Popularity float64 `json:"popularity,omitempty"`
+	Image      string  `json:"image,omitempty"`
+	AlbumID    string  `json:"albumId,omitempty"`
+	// For filters and facet counts on songs, see facets.go
+	Facets  map[string]string `json:"facets,omitempty"`
+	Numbers map[string]int    `json:"numbers,omitempty"`
+	Source  json.RawMessage   `json:"source"` // the stored model, returned with hits
+}
+
+func (d *SearchDoc) key() string {
+	return d.Type + ":" + d.ID
+}
+
+// SearchHit is a scored search result
+type SearchHit struct {
+	Doc   *SearchDoc
+	Score float64
+}
+
+type indexedDoc struct {
+	doc         *SearchDoc
+	fieldLens   map[string]int
+	titleTokens []string
+}
+
+type searchIndex struct {
+	mu          sync.RWMutex
+	docs        map[string]*indexedDoc
+	postings    map[string]map[string]map[string]int // term -> doc key -> field -> tf
+	fieldTotals map[string]int                       // summed length per field
+	fieldDocs   map[string]int                       // docs having the field
+	terms       []string                             // sorted, for prefix lookups
+	grams       map[string]map[string]bool           // trigram -> terms, for fuzzy lookups
+	termsStale  bool
+	dirty       bool // changed since last save
+
+	suggestKeys     []suggestKey // sorted, see suggest.go
+	suggestStale    bool
+	suggestBuilding bool
+	suggestBuiltAt  time.Time
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:        make(map[string]*indexedDoc),
+		postings:    make(map[string]map[string]map[string]int),
+		fieldTotals: make(map[string]int),
+		fieldDocs:   make(map[string]int),
+		grams:       make(map[string]map[string]bool),
+	}
+}
+
+// analyzeText splits text into normalized tokens, see searchTokens
+func analyzeText(s string) []string {
+	return searchTokens(s)
+}
+
+func (idx *searchIndex) addTermLocked(term string) {
+	idx.termsStale = true
+	for _, g := range trigrams(term) {
+		if idx.grams[g] == nil {
+			idx.grams[g] = make(map[string]bool)
+		}
+		idx.grams[g][term] = true
+	}
+}
+
+func (idx *searchIndex) dropTermLocked(term string) {
+	idx.termsStale = true
+	for _, g := range trigrams(term) {
+		delete(idx.grams[g], term)
+		if len(idx.grams[g]) == 0 {
+			delete(idx.grams, g)
+		}
+	}
+}
+
+// put adds or replaces a document
+func (idx *searchIndex) put(doc *SearchDoc) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(doc.key())
+
+	key := doc.key()
+	entry := &indexedDoc{doc: doc, fieldLens: make(map[string]int)}
+	for field, text := range doc.Fields {
+		forms := searchTokenForms(text)
+		if len(forms) == 0 {
+			continue
+		}
+		entry.fieldLens[field] = len(forms)
+		if field == "title" {
+			entry.titleTokens = analyzeText(text)
+		}
+		idx.fieldTotals[field] += len(forms)
+		idx.fieldDocs[field]++
+		for _, t := range slices.Concat(forms...) {
+			docs := idx.postings[t]
+			if docs == nil {
+				docs = make(map[string]map[string]int)
+				idx.postings[t] = docs
+				idx.addTermLocked(t)
+			}
+			if docs[key] == nil {
+				docs[key] = make(map[string]int)
+			}
+			docs[key][field]++
+		}
+	}
+	idx.docs[key] = entry
+	idx.dirty = true
+	idx.suggestStale = true
+}
+
+// remove drops a document, if indexed
+func (idx *searchIndex) remove(docType, id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(docType + ":" + id)
+}
+
+func (idx *searchIndex) removeLocked(key string) {
+	entry, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for field, text := range entry.doc.Fields {
+		forms := searchTokenForms(text)
+		if len(forms) == 0 {
+			continue
+		}
+		idx.fieldTotals[field] -= len(forms)
+		idx.fieldDocs[field]--
+		for _, t := range slices.Concat(forms...) {
+			if docs := idx.postings[t]; docs != nil {
+				delete(docs, key)
+				if len(docs) == 0 {
+					delete(idx.postings, t)
+					idx.dropTermLocked(t)
+				}
+			}
+		}
+	}
+	delete(idx.docs, key)
+	idx.dirty = true
+	idx.suggestStale = true
+}
+
+// expandTerm returns the indexed terms a query term matches with their
+// weights: itself, terms it's a prefix of, and terms within a few typos
+func (idx *searchIndex) expandTerm(term string) map[string]float64 {
+	out := make(map[string]float64)
+	if _, ok := idx.postings[term]; ok {
+		out[term] = 1
+	}
+	if len([]rune(term)) < 2 {
+		return out
+	}
+	i := sort.SearchStrings(idx.terms, term)
+	for n := 0; i < len(idx.terms) && n < maxPrefixExpansions; i++ {
+		t := idx.terms[i]
+		if !strings.HasPrefix(t, term) {
+			break
+		}
+		if t != term {
+			out[t] = prefixMatchWeight
+			n++
+		}
+	}
+	for t, w := range idx.fuzzyTerms(term) {
+		if _, ok := out[t]; !ok {
+			out[t] = w
+		}
+	}
+	return out
+}
+
+// fuzzyTerms finds indexed terms within maxEditDistance of term. Candidates
+// come from the trigram index, so only terms sharing enough trigrams are
+// compared.
+func (idx *searchIndex) fuzzyTerms(term string) map[string]float64 {
+	max := maxEditDistance(term)
+	if max == 0 {
+		return nil
+	}
+	grams := trigrams(term)
+	shared := make(map[string]int)
+	for _, g := range grams {
+		for t := range idx.grams[g] {
+			shared[t]++
+		}
+	}
+	out := make(map[string]float64)
+	for t, n := range shared {
+		if t == term || float64(n) < minTrigramOverlap*float64(len(grams)) {
+			continue
+		}
+		if d := editDistance(term, t, max); d <= max {
+			out[t] = fuzzyMatchWeight * (1 - float64(d-1)/float64(max+1))
+		}
+	}
+	return out
+}
+
+// search ranks documents accepted by filter against the query. Every query
+// term has to match; when that leaves nothing, documents matching any term
+// are returned instead.
+func (idx *searchIndex) search(query string, filter func(*SearchDoc) bool) []SearchHit {
+	qterms := searchTokenForms(query)
+	if len(qterms) == 0 {
+		return nil
+	}
+
+	idx.mu.Lock()
+	if idx.termsStale {
+		idx.terms = idx.terms[:0]
+		for t := range idx.postings {
+			idx.terms = append(idx.terms, t)
+		}
+		sort.Strings(idx.terms)
+		idx.termsStale = false
+	}
+	idx.mu.Unlock()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docs))
+	scores := make(map[string]float64)
+	matched := make(map[string]int)
+	for _, forms := range qterms {
+		expanded := idx.expandTerm(forms[0])
+		for _, alt := range forms[1:] {
+			for t, w := range idx.expandTerm(alt) {
+				expanded[t] = max(expanded[t], w)
+			}
+		}
+		// The query term and its expansions share one IDF, so a rare
+		// completion can't outrank an exact match of a common word
+		seen := make(map[string]bool)
+		for term := range expanded {
+			for key := range idx.postings[term] {
+				seen[key] = true
+			}
+		}
+		df := float64(len(seen))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		seen = make(map[string]bool)
+		for term, weight := range expanded {
+			for key, fields := range idx.postings[term] {
+				entry := idx.docs[key]
+				if filter != nil && !filter(entry.doc) {
+					continue
+				}
+				tf := 0.0
+				for field, count := range fields {
+					avg := float64(idx.fieldTotals[field]) / math.Max(1, float64(idx.fieldDocs[field]))
+					norm := 1 - bm25B + bm25B*float64(entry.fieldLens[field])/math.Max(avg, 1)
+					tf += searchFieldBoosts[field] * float64(count) / norm
+				}
+				scores[key] += weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1)
+				if !seen[key] {
+					seen[key] = true
+					matched[key]++
+				}
+			}
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for key, score := range scores {
+		if matched[key] == len(qterms) {
+			hits = append(hits, SearchHit{Doc: idx.docs[key].doc, Score: score})
+		}
+	}
+	if len(hits) == 0 {
+		for key, score := range scores {
+			// Scale partial matches by the share of terms matched
+			hits = append(hits, SearchHit{Doc: idx.docs[key].doc, Score: score * float64(matched[key]) / float64(len(qterms))})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Doc.key() < hits[j].Doc.key()
+	})
+	return hits
+}
+
+// count returns the number of indexed documents per type
+func (idx *searchIndex) count() map[string]int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, e := range idx.docs {
+		counts[e.doc.Type]++
+	}
+	return counts
+}
+
+// save writes the documents to a gzipped JSON file, atomically
+func (idx *searchIndex) save(path string) error {
+	idx.mu.Lock()
+	docs := make([]*SearchDoc, 0, len(idx.docs))
+	for _, e := range idx.docs {
+		docs = append(docs, e.doc)
+	}
+	idx.dirty = false
+	idx.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".search-index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(searchIndexFile{Version: searchIndexVersion, Docs: docs}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadSearchIndex reads an index saved by save
+func loadSearchIndex(path string) (*searchIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var file searchIndexFile
+	if err := json.NewDecoder(zr).Decode(&file); err != nil {
+		return nil, err
+	}
+	if file.Version != searchIndexVersion {
+		return nil, fmt.Errorf("index version %d, want %d", file.Version, searchIndexVersion)
+	}
+
+	idx := newSearchIndex()
+	for _, d := range file.Docs {
+		idx.put(d)
+	}
+	idx.dirty = false
+	idx.rebuildSuggest()
+	return idx, nil
+}
@@ -43,6 +43,9 @@ type SpotifyTrack struct {
 		ID   string `json:"id"`
 		Name string `json:"name"`
 	} `json:"artists"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
 }
 
 type SpotifyArtist struct {
@@ -98,7 +101,9 @@ func getSpotifyToken() (string, error) {
 	return spotifyAccessToken, nil
 }
 
-func SearchSpotifyMetadata(query string, limit int) (*SpotifySearchResult, error) {
+// SearchSpotifyMetadata searches tracks and artists available in a market
+// (ISO country code); an empty market searches the whole catalog
+func SearchSpotifyMetadata(query string, limit int, market string) (*SpotifySearchResult, error) {
 	token, err := getSpotifyToken()
 	if err != nil {
 		return nil, err
@@ -108,6 +113,9 @@ func SearchSpotifyMetadata(query string, limit int) (*SpotifySearchResult, error
 		"https://api.spotify.com/v1/search?q=%s&type=track,artist&limit=%d",
 		url.QueryEscape(query), limit,
 	)
+	if market != "" {
+		apiURL += "&market=" + url.QueryEscape(market)
+	}
 
 	req, _ := http.NewRequest("GET", apiURL, nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -126,8 +134,19 @@ func SearchSpotifyMetadata(query string, limit int) (*SpotifySearchResult, error
 	return &result, nil
 }
 
-// GetSpotifyFeaturedTracks returns popular tracks using search
-func GetSpotifyFeaturedTracks(limit int) ([]SpotifyTrack, error) {
+// Featured tracks are cached per market
+var spotifyFeaturedCache = newRegionCache[[]SpotifyTrack](30 * time.Minute)
+
+// GetSpotifyFeaturedTracks returns popular tracks in a market using search
+func GetSpotifyFeaturedTracks(market string, limit int) ([]SpotifyTrack, error) {
+	if market = NormalizeRegion(market); market == "" {
+		market = DefaultRegion()
+	}
+	key := fmt.Sprintf("%s:%d", market, limit)
+	if tracks, ok := spotifyFeaturedCache.get(key); ok {
+		return tracks, nil
+	}
+
 	token, err := getSpotifyToken()
 	if err != nil {
 		return nil, err
@@ -135,8 +154,8 @@ func GetSpotifyFeaturedTracks(limit int) ([]SpotifyTrack, error) {
 
 	// Search for popular current tracks — more reliable than playlist endpoint
 	apiURL := fmt.Sprintf(
-		"https://api.spotify.com/v1/search?q=%s&type=track&limit=%d&market=US",
-		url.QueryEscape("year:2025 tag:new"), limit,
+		"https://api.spotify.com/v1/search?q=%s&type=track&limit=%d&market=%s",
+		url.QueryEscape("year:2025 tag:new"), limit, market,
 	)
 
 	req, _ := http.NewRequest("GET", apiURL, nil)
@@ -153,12 +172,99 @@ func GetSpotifyFeaturedTracks(limit int) ([]SpotifyTrack, error) {
 		return nil, fmt.Errorf("failed to decode spotify response: %v", err)
 	}
 
-	// Filter to only tracks with preview URLs
-	var tracks []SpotifyTrack
-	for _, t := range result.Tracks.Items {
-		if t.PreviewURL != "" {
-			tracks = append(tracks, t)
+	// Tracks without a preview are kept; they're played by resolving them
+	// to another source (see resolver.go)
+	tracks := result.Tracks.Items
+	spotifyFeaturedCache.set(key, tracks)
+	return tracks, nil
+}
+
+// GetSpotifyTrack fetches a single track's metadata
+func GetSpotifyTrack(id string) (*SpotifyTrack, error) {
+	token, err := getSpotifyToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, _ := http.NewRequest("GET", "https://api.spotify.com/v1/tracks/"+url.PathEscape(id), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := spotifyClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("spotify API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("spotify track %s: status %d", id, resp.StatusCode)
+	}
+
+	var track SpotifyTrack
+	if err := json.NewDecoder(resp.Body).Decode(&track); err != nil {
+		return nil, fmt.Errorf("failed to decode spotify track: %v", err)
+	}
+	return &track, nil
+}
+
+// SpotifyPlaylist is a playlist's name and tracks
+type SpotifyPlaylist struct {
+	Name   string
+	Tracks []SpotifyTrack
+}
+
+// GetSpotifyPlaylist fetches a public playlist, following pagination up to maxTracks
+func GetSpotifyPlaylist(id string, maxTracks int) (*SpotifyPlaylist, error) {
+	token, err := getSpotifyToken()
+	if err != nil {
+		return nil, err
+	}
+
+	get := func(apiURL string, out interface{}) error {
+		req, _ := http.NewRequest("GET", apiURL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := spotifyClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("spotify API error: %v", err)
 		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("spotify playlist %s: status %d", id, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode spotify playlist: %v", err)
+		}
+		return nil
 	}
-	return tracks, nil
+
+	var meta struct {
+		Name string `json:"name"`
+	}
+	if err := get("https://api.spotify.com/v1/playlists/"+url.PathEscape(id)+"?fields=name", &meta); err != nil {
+		return nil, err
+	}
+
+	playlist := &SpotifyPlaylist{Name: meta.Name}
+	next := fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks?limit=100", url.PathEscape(id))
+	for next != "" && len(playlist.Tracks) < maxTracks {
+		var page struct {
+			Items []struct {
+				Track *SpotifyTrack `json:"track"`
+			} `json:"items"`
+			Next string `json:"next"`
+		}
+		if err := get(next, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			// Removed tracks and local files come back as null or without an ID
+			if item.Track != nil && item.Track.ID != "" {
+				playlist.Tracks = append(playlist.Tracks, *item.Track)
+			}
+		}
+		next = page.Next
+	}
+	if len(playlist.Tracks) > maxTracks {
+		playlist.Tracks = playlist.Tracks[:maxTracks]
+	}
+	return playlist, nil
 }
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream tokens
+// The audio proxy is fetched by <audio> elements, which can't send an
+// Authorization header, so GetYouTubeStream hands out a short-lived signed URL
+// instead. Tokens are HMAC-SHA256 over the user, the video and the expiry, and
+// are only valid for that video. Streams are also capped per user.
+
+var (
+	ErrInvalidStreamToken = errors.New("invalid stream token")
+	ErrStreamTokenExpired = errors.New("stream token expired")
+	ErrTooManyStreams     = errors.New("too many concurrent streams")
+)
+
+var (
+	streamSecret     []byte
+	streamSecretOnce sync.Once
+
+	activeStreams   = make(map[string]int)
+	activeStreamsMu sync.Mutex
+)
+
+// Shortest STREAM_TOKEN_SECRET accepted
+const minStreamSecretLen = 16
+
+// Values copied from examples, which anyone could use to forge tokens
+var placeholderSecrets = []string{"change_me", "changeme", "change-me", "secret", "your_secret", "your-secret", "example"}
+
+// getStreamSecret reads STREAM_TOKEN_SECRET. Without one, or with a
+// placeholder or short value, a random secret is generated, so tokens don't
+// survive restarts or work across replicas.
+func getStreamSecret() []byte {
+	streamSecretOnce.Do(func() {
+		s := os.Getenv("STREAM_TOKEN_SECRET")
+		switch {
+		case s == "":
+			slog.Warn("STREAM_TOKEN_SECRET not set, using a random per-process secret")
+		case slices.Contains(placeholderSecrets, strings.ToLower(s)) || len(s) < minStreamSecretLen:
+			slog.Warn("STREAM_TOKEN_SECRET is a placeholder or shorter than 16 characters, using a random per-process secret")
+		default:
+			streamSecret = []byte(s)
+			return
+		}
+		streamSecret = make([]byte, 32)
+		if _, err := rand.Read(streamSecret); err != nil {
+			panic(fmt.Sprintf("stream token secret: %v", err))
+		}
+	})
+	return streamSecret
+}
+
+func streamTokenSignature(uid, videoID string, exp int64) string {
+	mac := hmac.New(sha256.New, getStreamSecret())
+	fmt.Fprintf(mac, "%s\n%s\n%d", uid, videoID, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueStreamToken signs access to a video for a user. The lifetime comes from
+// STREAM_TOKEN_TTL (default 1h), long enough to cover seeking within a track.
+func IssueStreamToken(uid, videoID string) (string, time.Time) {
+	expiresAt := time.Now().Add(envDuration("STREAM_TOKEN_TTL", time.Hour))
+	exp := expiresAt.Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(uid)) + "." + strconv.FormatInt(exp, 10)
+	return payload + "." + streamTokenSignature(uid, videoID, exp), expiresAt
+}
+
+// VerifyStreamToken checks a token for a video and returns the user it was issued to
+func VerifyStreamToken(token, videoID string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidStreamToken
+	}
+	uidBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidStreamToken
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidStreamToken
+	}
+	uid := string(uidBytes)
+	if !hmac.Equal([]byte(parts[2]), []byte(streamTokenSignature(uid, videoID, exp))) {
+		return "", ErrInvalidStreamToken
+	}
+	if time.Now().Unix() > exp {
+		return "", ErrStreamTokenExpired
+	}
+	return uid, nil
+}
+
+// AcquireStream reserves one of a user's concurrent stream slots
+// (STREAM_MAX_PER_USER, default 4 to allow for preloading and range requests).
+// The returned release func must be called when the stream ends.
+func AcquireStream(uid string) (func(), error) {
+	limit := envInt("STREAM_MAX_PER_USER", 4)
+
+	activeStreamsMu.Lock()
+	defer activeStreamsMu.Unlock()
+	if limit > 0 && activeStreams[uid] >= limit {
+		return nil, ErrTooManyStreams
+	}
+	activeStreams[uid]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			activeStreamsMu.Lock()
+			defer activeStreamsMu.Unlock()
+			if activeStreams[uid]--; activeStreams[uid] <= 0 {
+				delete(activeStreams, uid)
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spotify-clone/config"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Suggestions
+// Search-as-you-type over song titles, artist names, album titles and
+// popular past queries. Every suggestion is keyed by its normalized text and
+// by each word suffix of it, so "hi ho" completes "Tum Hi Ho", and the keys
+// are kept sorted for prefix lookups. Matches rank by popularity, with a
+// boost for artists and songs from the user's listening history.
+
+const (
+	// Minimum time between rebuilds of the sorted keys after index changes
+	suggestRebuildInterval = 5 * time.Second
+	// Cap on prefix matches scored per request
+	maxSuggestCandidates = 2000
+	// Popular queries kept in memory
+	maxPopularQueries = 5000
+	// Distinct users who must have searched a query before it's suggested,
+	// so one person's searches never show up for others
+	minQueryUsers = 3
+)
+
+// Suggestion is one autocomplete entry
+type Suggestion struct {
+	Type     string  `json:"type"` // song, artist, album, query
+	ID       string  `json:"id,omitempty"`
+	Text     string  `json:"text"`
+	Subtitle string  `json:"subtitle,omitempty"`
+	ImageURL string  `json:"imageURL,omitempty"`
+	Score    float64 `json:"score"`
+}
+
+type suggestKey struct {
+	key             string
+	doc             *SearchDoc
+	albumPopularity float64
+	prefix          bool // key starts at the first word
+}
+
+// ---- Catalog ----
+
+// rebuildSuggest recomputes the sorted suggestion keys from the indexed
+// songs, approved artists and albums. Keys are built outside the lock;
+// lookups keep using the previous keys meanwhile.
+func (idx *searchIndex) rebuildSuggest() {
+	idx.mu.Lock()
+	idx.suggestStale = false
+	idx.suggestBuiltAt = time.Now()
+	albumPlays := make(map[string]float64)
+	entries := make([]*indexedDoc, 0, len(idx.docs))
+	for _, e := range idx.docs {
+		d := e.doc
+		switch d.Type {
+		case "song":
+			if d.AlbumID != "" {
+				albumPlays[d.AlbumID] += d.Popularity
+			}
+			if d.Status == "approved" {
+				entries = append(entries, e)
+			}
+		case "artist":
+			if d.Status == "approved" {
+				entries = append(entries, e)
+			}
+		case "album":
+			entries = append(entries, e)
+		}
+	}
+	idx.mu.Unlock()
+
+	var keys []suggestKey
+	for _, e := range entries {
+		for i := range e.titleTokens {
+			keys = append(keys, suggestKey{
+				key:             strings.Join(e.titleTokens[i:], " "),
+				doc:             e.doc,
+				albumPopularity: albumPlays[e.doc.ID],
+				prefix:          i == 0,
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key < keys[j].key })
+
+	idx.mu.Lock()
+	idx.suggestKeys = keys
+	idx.suggestBuilding = false
+	idx.mu.Unlock()
+}
+
+// addPopularity bumps a document's popularity, like a song's play count
+func (idx *searchIndex) addPopularity(docType, id string, n float64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if e, ok := idx.docs[docType+":"+id]; ok {
+		e.doc.Popularity += n
+		idx.dirty = true
+	}
+}
+
+// suggest returns catalog entries whose text, or a word suffix of it,
+// starts with the normalized query
+func (idx *searchIndex) suggest(qkey string, taste *listeningTaste) []Suggestion {
+	idx.mu.Lock()
+	if idx.suggestStale && !idx.suggestBuilding && time.Since(idx.suggestBuiltAt) > suggestRebuildInterval {
+		idx.suggestBuilding = true
+		go idx.rebuildSuggest()
+	}
+	idx.mu.Unlock()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	best := make(map[string]Suggestion)
+	i := sort.Search(len(idx.suggestKeys), func(i int) bool { return idx.suggestKeys[i].key >= qkey })
+	for n := 0; i < len(idx.suggestKeys) && n < maxSuggestCandidates; i, n = i+1, n+1 {
+		k := idx.suggestKeys[i]
+		if !strings.HasPrefix(k.key, qkey) {
+			break
+		}
+		d := k.doc
+		if _, live := idx.docs[d.key()]; !live {
+			continue // removed since the keys were built
+		}
+
+		popularity := d.Popularity
+		if d.Type == "album" {
+			popularity = k.albumPopularity
+		}
+		score := math.Log1p(popularity)
+		if k.prefix {
+			score += 2
+		}
+		if k.prefix && k.key == qkey {
+			score += 1
+		}
+		score += taste.boost(d)
+
+		if prev, ok := best[d.key()]; ok && prev.Score >= score {
+			continue
+		}
+		s := Suggestion{Type: d.Type, ID: d.ID, Text: d.Fields["title"], ImageURL: d.Image, Score: score}
+		if d.Type != "artist" {
+			s.Subtitle = d.Fields["artist"]
+		}
+		best[d.key()] = s
+	}
+
+	out := make([]Suggestion, 0, len(best))
+	for _, s := range best {
+		out = append(out, s)
+	}
+	return out
+}
+
+// ---- Listening history ----
+
+// listeningTaste is what a user has been playing and liking
+type listeningTaste struct {
+	songs   map[string]bool
+	artists map[string]bool // artist IDs and normalized names
+}
+
+var tasteCache = newRegionCache[*listeningTaste](5 * time.Minute)
+
+// getListeningTaste returns the songs and artists from a user's recently
+// played and liked songs. The first call loads them in the background so
+// suggestions never wait on Firestore.
+func getListeningTaste(uid string) *listeningTaste {
+	if uid == "" {
+		return nil
+	}
+	if t, ok := tasteCache.get(uid); ok {
+		return t
+	}
+	tasteCache.set(uid, &listeningTaste{})
+	go loadListeningTaste(context.Background(), uid)
+	return nil
+}
+
+// loadListeningTaste resolves a user's history through the search index
+func loadListeningTaste(ctx context.Context, uid string) {
+	t := &listeningTaste{songs: make(map[string]bool), artists: make(map[string]bool)}
+	if user, err := GetUser(ctx, uid); err == nil {
+		idx := getSearchIndex()
+		idx.mu.RLock()
+		for _, id := range append(user.RecentlyPlayed, user.LikedSongs...) {
+			t.songs[id] = true
+			if e, ok := idx.docs["song:"+id]; ok {
+				if e.doc.OwnerID != "" {
+					t.artists[e.doc.OwnerID] = true
+				}
+				if name := strings.Join(analyzeText(e.doc.Fields["artist"]), " "); name != "" {
+					t.artists[name] = true
+				}
+			}
+		}
+		idx.mu.RUnlock()
+	}
+	tasteCache.set(uid, t)
+}
+
+// boost favours the user's own songs and artists
+func (t *listeningTaste) boost(d *SearchDoc) float64 {
+	if t == nil {
+		return 0
+	}
+	switch d.Type {
+	case "song":
+		if t.songs[d.ID] {
+			return 3
+		}
+		if t.artists[d.OwnerID] {
+			return 2
+		}
+	case "artist":
+		if t.artists[d.ID] || t.artists[strings.Join(analyzeText(d.Fields["title"]), " ")] {
+			return 3
+		}
+	case "album":
+		if t.artists[d.OwnerID] {
+			return 2
+		}
+	}
+	return 0
+}
+
+// ---- Popular queries ----
+
+type popularQuery struct {
+	Key   string   `firestore:"key"`
+	Text  string   `firestore:"text"`
+	Count int      `firestore:"count"`
+	Users []string `firestore:"users"` // hashed, up to minQueryUsers
+}
+
+var (
+	popularQueriesMu sync.RWMutex
+	popularQueries   = make(map[string]*popularQuery)
+)
+
+// loadPopularQueries reads the most searched queries from Firestore
+func loadPopularQueries(ctx context.Context) {
+	iter := config.FirestoreClient.Collection("searchQueries").
+		OrderBy("count", firestore.Desc).
+		Limit(maxPopularQueries).
+		Documents(ctx)
+	defer iter.Stop()
+
+	loaded := make(map[string]*popularQuery)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.Warn("failed to load popular search queries", "err", err)
+			return
+		}
+		var q popularQuery
+		if err := doc.DataTo(&q); err == nil && q.Key != "" {
+			loaded[q.Key] = &q
+		}
+	}
+
+	popularQueriesMu.Lock()
+	defer popularQueriesMu.Unlock()
+	for key, q := range popularQueries {
+		// Searches recorded while loading
+		if l, ok := loaded[key]; ok {
+			l.Count = max(l.Count, q.Count)
+			for _, u := range q.Users {
+				if len(l.Users) < minQueryUsers && !slices.Contains(l.Users, u) {
+					l.Users = append(l.Users, u)
+				}
+			}
+		} else {
+			loaded[key] = q
+		}
+	}
+	popularQueries = loaded
+}
+
+// RecordSearchQuery counts a search that returned results, for suggestions.
+// Users are kept, hashed, until enough of them searched the query.
+func RecordSearchQuery(query, uid string) {
+	text := strings.Join(strings.Fields(query), " ")
+	key := strings.Join(analyzeText(text), " ")
+	if len(key) < 2 || len(text) > 100 || uid == "" {
+		return
+	}
+	userSum := sha1.Sum([]byte(uid))
+	user := hex.EncodeToString(userSum[:8])
+
+	popularQueriesMu.Lock()
+	q, ok := popularQueries[key]
+	if !ok && len(popularQueries) < maxPopularQueries {
+		q = &popularQuery{Key: key, Text: text}
+		popularQueries[key] = q
+	}
+	newUser := false
+	if q != nil {
+		q.Count++
+		if len(q.Users) < minQueryUsers && !slices.Contains(q.Users, user) {
+			q.Users = append(q.Users, user)
+			newUser = true
+		}
+	}
+	popularQueriesMu.Unlock()
+
+	if config.FirestoreClient == nil {
+		return
+	}
+	go func() {
+		sum := sha1.Sum([]byte(key))
+		data := map[string]interface{}{
+			"key":            key,
+			"text":           text,
+			"count":          firestore.Increment(1),
+			"lastSearchedAt": time.Now(),
+		}
+		if newUser {
+			data["users"] = firestore.ArrayUnion(user)
+		}
+		_, err := config.FirestoreClient.Collection("searchQueries").Doc(hex.EncodeToString(sum[:])).Set(context.Background(), data, firestore.MergeAll)
+		if err != nil {
+			slog.Warn("failed to record search query", "err", err)
+		}
+	}()
+}
+
+// suggestQueries returns past queries starting with the normalized query
+// that enough users searched
+func suggestQueries(qkey string) []Suggestion {
+	popularQueriesMu.RLock()
+	defer popularQueriesMu.RUnlock()
+	var out []Suggestion
+	for key, q := range popularQueries {
+		if strings.HasPrefix(key, qkey) && key != qkey && len(q.Users) >= minQueryUsers {
+			out = append(out, Suggestion{Type: "query", Text: q.Text, Score: math.Log1p(float64(q.Count)) + 1})
+		}
+	}
+	return out
+}
+
+// ---- API ----
+
+// SuggestSearch returns up to limit completions for a partial query
+func SuggestSearch(query, uid string, limit int) []Suggestion {
+	qkey := strings.Join(analyzeText(query), " ")
+	if qkey == "" {
+		return []Suggestion{}
+	}
+
+	out := getSearchIndex().suggest(qkey, getListeningTaste(uid))
+	out = append(out, suggestQueries(qkey)...)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Text < out[j].Text
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPopularQueriesNeedDistinctUsers(t *testing.T) {
+	popularQueries = make(map[string]*popularQuery)
+	t.Cleanup(func() { popularQueries = make(map[string]*popularQuery) })
+
+	// One user searching over and over isn't enough
+	for i := 0; i < 10; i++ {
+		RecordSearchQuery("Tum Hi Ho Arijit", "uid-1")
+	}
+	if got := suggestQueries("tum hi"); len(got) != 0 {
+		t.Fatalf("suggested after one user: %v", got)
+	}
+
+	for i := 2; i <= minQueryUsers; i++ {
+		RecordSearchQuery("tum  hi ho arijit", fmt.Sprintf("uid-%d", i))
+	}
+	got := suggestQueries("tum hi")
+	if len(got) != 1 || got[0].Text != "Tum Hi Ho Arijit" {
+		t.Fatalf("suggestions = %v", got)
+	}
+	if q := popularQueries["tum hi ho arijit"]; q.Count != 10+minQueryUsers-1 || len(q.Users) != minQueryUsers {
+		t.Errorf("count = %d, users = %d", q.Count, len(q.Users))
+	}
+
+	// Anonymous searches aren't recorded
+	RecordSearchQuery("anonymous query", "")
+	if _, ok := popularQueries["anonymous query"]; ok {
+		t.Error("query recorded without a user")
+	}
+}
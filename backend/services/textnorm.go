@@ -0,0 +1,298 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Search text normalization
+// Search text is case-folded (Unicode-aware, so "BEYONCÉ", "ПРИВЕТ" and
+// "Straße" fold like their lower-case forms) and stripped of Latin-style
+// accents. Tokens are then reduced to a loose Latin key: Devanagari is
+// transliterated and common spelling variants of romanized Hindi collapse
+// ("hee"/"hi", "pyaar"/"pyar"), so "tum hi ho" matches "तुम ही हो". Words
+// with ड़ or ढ़ get a second form, as they're romanized with both "r" and
+// "d" ("larki", "ladki").
+
+var searchFolder = cases.Fold()
+
+// foldText case-folds s and strips combining diacritical marks. Only the
+// Latin/Greek/Cyrillic combining block is dropped, since marks in Indic
+// scripts are vowel signs, not accents.
+func foldText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.Predicate(isAccent)), norm.NFC)
+	out, _, err := transform.String(t, searchFolder.String(s))
+	if err != nil {
+		return strings.ToLower(s)
+	}
+	return out
+}
+
+func isAccent(r rune) bool {
+	return r >= 0x0300 && r <= 0x036F
+}
+
+// searchTokens splits text into folded letter/number tokens and reduces
+// each to its loose key
+func searchTokens(s string) []string {
+	forms := searchTokenForms(s)
+	tokens := make([]string, len(forms))
+	for i, f := range forms {
+		tokens[i] = f[0]
+	}
+	return tokens
+}
+
+// searchTokenForms is searchTokens with every spelling of each token, the
+// usual one first
+func searchTokenForms(s string) [][]string {
+	tokens := strings.FieldsFunc(foldText(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+	forms := make([][]string, len(tokens))
+	for i, t := range tokens {
+		key := looseKey(transliterateDevanagari(t, false))
+		forms[i] = []string{key}
+		if alt := looseKey(transliterateDevanagari(t, true)); alt != key {
+			forms[i] = append(forms[i], alt)
+		}
+	}
+	return forms
+}
+
+// Spelling variants of romanized Hindi, applied in order
+var looseReplacer = strings.NewReplacer(
+	"chh", "ch",
+	"aa", "a",
+	"ee", "i",
+	"ii", "i",
+	"oo", "u",
+	"uu", "u",
+	"ph", "f",
+	"w", "v",
+)
+
+// looseKey collapses spelling variants of a Latin token, leaving other
+// scripts alone
+func looseKey(tok string) string {
+	for i := 0; i < len(tok); i++ {
+		if tok[i] >= 0x80 {
+			return tok
+		}
+	}
+	tok = looseReplacer.Replace(tok)
+	// Collapse doubled letters ("dill" vs "dil")
+	b := []byte(tok)
+	out := b[:0]
+	for i, c := range b {
+		if i > 0 && c == b[i-1] && c >= 'a' && c <= 'z' {
+			continue
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// ---- Devanagari ----
+
+var devanagariConsonants = map[rune]string{
+	'क': "k", 'ख': "kh", 'ग': "g", 'घ': "gh", 'ङ': "n",
+	'च': "ch", 'छ': "ch", 'ज': "j", 'झ': "jh", 'ञ': "n",
+	'ट': "t", 'ठ': "th", 'ड': "d", 'ढ': "dh", 'ण': "n",
+	'त': "t", 'थ': "th", 'द': "d", 'ध': "dh", 'न': "n",
+	'प': "p", 'फ': "f", 'ब': "b", 'भ': "bh", 'म': "m",
+	'य': "y", 'र': "r", 'ल': "l", 'ळ': "l", 'व': "v",
+	'श': "sh", 'ष': "sh", 'स': "s", 'ह': "h",
+}
+
+// Independent vowels and vowel signs. Long and short vowels share a
+// spelling since romanized Hindi rarely tells them apart.
+var devanagariVowels = map[rune]string{
+	'अ': "a", 'आ': "a", 'इ': "i", 'ई': "i", 'उ': "u", 'ऊ': "u",
+	'ऋ': "ri", 'ए': "e", 'ऐ': "ai", 'ओ': "o", 'औ': "au", 'ऑ': "o",
+	'ा': "a", 'ि': "i", 'ी': "i", 'ु': "u", 'ू': "u", 'ृ': "ri",
+	'े': "e", 'ै': "ai", 'ो': "o", 'ौ': "au", 'ॅ': "e", 'ॉ': "o",
+}
+
+const (
+	devanagariVirama = '्'
+	devanagariNukta  = '़'
+)
+
+// Consonants that change sound with a nukta (ज़ is z, ड़ is r)
+var devanagariNuktaForms = map[rune]string{
+	'क': "q", 'ख': "kh", 'ग': "g", 'ज': "z", 'ड': "r", 'ढ': "rh", 'फ': "f",
+}
+
+// The flaps ड़ and ढ़ are romanized just as often as their plain consonants
+var devanagariFlapsAsD = map[rune]string{'ड': "d", 'ढ': "dh"}
+
+func isDevanagari(r rune) bool {
+	return r >= 0x0900 && r <= 0x097F
+}
+
+func isDevanagariVowelSign(r rune) bool {
+	return r >= 'ा' && r <= 'ौ'
+}
+
+// devanagariUnit is a romanized consonant, with its vowel sign if any, or
+// some other character of a Devanagari word
+type devanagariUnit struct {
+	text      string
+	consonant bool
+	vowel     bool // ends in a written vowel
+	schwa     bool // a consonant followed by its inherent "a"
+}
+
+// transliterateDevanagari romanizes Devanagari in s, leaving other text
+// alone. Consonants carry an inherent "a" unless followed by a vowel sign
+// or virama. It isn't pronounced at the end of a word ("तुम" is "tum"), nor
+// between two syllables that keep their vowels ("धड़कन" is "dharkan"). With
+// flapsAsD, ड़ and ढ़ are written "d" and "dh".
+func transliterateDevanagari(s string, flapsAsD bool) string {
+	hasDevanagari := false
+	for _, r := range s {
+		if isDevanagari(r) {
+			hasDevanagari = true
+			break
+		}
+	}
+	if !hasDevanagari {
+		return s
+	}
+
+	rs := []rune(s)
+	var units []devanagariUnit
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if c, ok := devanagariConsonants[r]; ok {
+			next := i + 1
+			if next < len(rs) && rs[next] == devanagariNukta {
+				if n, ok := devanagariNuktaForms[r]; ok {
+					c = n
+				}
+				if d, ok := devanagariFlapsAsD[r]; ok && flapsAsD {
+					c = d
+				}
+				next++
+			}
+			u := devanagariUnit{text: c, consonant: true}
+			i = next - 1
+			if next < len(rs) {
+				switch {
+				case rs[next] == devanagariVirama:
+					i = next
+				case isDevanagariVowelSign(rs[next]):
+					u.text += devanagariVowels[rs[next]]
+					u.vowel = true
+					i = next
+				case isDevanagari(rs[next]):
+					u.schwa = true
+				}
+			}
+			units = append(units, u)
+			continue
+		}
+		switch {
+		case devanagariVowels[r] != "":
+			units = append(units, devanagariUnit{text: devanagariVowels[r], vowel: true})
+		case r == 'ं' || r == 'ँ':
+			units = append(units, devanagariUnit{text: "n"})
+		case r == 'ः':
+			units = append(units, devanagariUnit{text: "h"})
+		case r >= '०' && r <= '९':
+			units = append(units, devanagariUnit{text: string('0' + (r - '०'))})
+		case r == devanagariVirama || r == devanagariNukta:
+		default:
+			units = append(units, devanagariUnit{text: string(r)})
+		}
+	}
+
+	// Schwa deletion, right to left so a dropped vowel isn't counted as
+	// the neighbor of another
+	for i := len(units) - 2; i > 0; i-- {
+		prev, next := units[i-1], units[i+1]
+		if units[i].schwa && (prev.vowel || prev.schwa) && next.consonant && (next.vowel || next.schwa) {
+			units[i].schwa = false
+		}
+	}
+
+	var b strings.Builder
+	for _, u := range units {
+		b.WriteString(u.text)
+		if u.schwa {
+			b.WriteByte('a')
+		}
+	}
+	return b.String()
+}
+
+// ---- Fuzzy matching ----
+
+// trigrams returns the padded character trigrams of a term
+func trigrams(term string) []string {
+	rs := []rune("  " + term + " ")
+	seen := make(map[string]bool)
+	var out []string
+	for i := 0; i+3 <= len(rs); i++ {
+		g := string(rs[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// maxEditDistance is how many typos a term of this length tolerates
+func maxEditDistance(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance is the Levenshtein distance between a and b, counting an
+// adjacent transposition as one edit. It gives up once the distance
+// exceeds max, returning max+1.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(rb)], max+1)
+}
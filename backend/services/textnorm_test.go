@@ -0,0 +1,90 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Tum Hi Ho", []string{"tum", "hi", "ho"}},
+		{"तुम ही हो", []string{"tum", "hi", "ho"}},
+		{"Tum Hee Ho", []string{"tum", "hi", "ho"}},
+		{"BEYONCÉ", []string{"beyonce"}},
+		{"Straße", []string{"strase"}},
+		{"Pyaar Hua", []string{"pyar", "hua"}},
+		{"प्यार हुआ", []string{"pyar", "hua"}},
+		{"दिल", []string{"dil"}},
+		{"Dill", []string{"dil"}},
+		{"कमल", []string{"kamal"}},
+		{"अपना", []string{"apna"}},
+		{"समझना", []string{"samajhna"}},
+		{"दिलवाले", []string{"dilvale"}},
+		{"रंग", []string{"rang"}},
+		{"ज़िंदगी", []string{"zindagi"}},
+		{"हम २०१३", []string{"ham", "2013"}},
+	}
+	for _, tt := range tests {
+		if got := searchTokens(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("searchTokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTokenFormsFlaps(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"धड़कन", []string{"dharkan", "dhadkan"}},
+		{"लड़की", []string{"larki", "ladki"}},
+		{"पढ़ना", []string{"parhna", "padhna"}},
+		{"Dhadkan", []string{"dhadkan"}},
+		{"डर", []string{"dar"}},
+	}
+	for _, tt := range tests {
+		forms := searchTokenForms(tt.in)
+		if len(forms) != 1 || !slices.Equal(forms[0], tt.want) {
+			t.Errorf("searchTokenForms(%q) = %q, want [%q]", tt.in, forms, tt.want)
+		}
+	}
+}
+
+func TestSearchMatchesAcrossScripts(t *testing.T) {
+	idx := newSearchIndex()
+	idx.put(&SearchDoc{Type: "song", ID: "1", Fields: map[string]string{"title": "तुम ही हो"}})
+	idx.put(&SearchDoc{Type: "song", ID: "2", Fields: map[string]string{"title": "धड़कन"}})
+	idx.put(&SearchDoc{Type: "song", ID: "3", Fields: map[string]string{"title": "Ladki Badi Anjani Hai"}})
+	idx.put(&SearchDoc{Type: "song", ID: "4", Fields: map[string]string{"title": "Dil To Pagal Hai"}})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"tum hi ho", "1"},
+		{"tum hee ho", "1"},
+		{"dhadkan", "2"},
+		{"dharkan", "2"},
+		{"धड़कन", "2"},
+		{"लड़की", "3"},
+		{"ladki", "3"},
+	}
+	for _, tt := range tests {
+		hits := idx.search(tt.query, nil)
+		if len(hits) == 0 || hits[0].Doc.ID != tt.want {
+			t.Errorf("search(%q) = %v, want %s first", tt.query, hits, tt.want)
+		}
+	}
+
+	// Both spellings are dropped with the document
+	idx.remove("song", "2")
+	if hits := idx.search("dhadkan", nil); len(hits) != 0 {
+		t.Errorf("removed document still found: %v", hits)
+	}
+	if _, ok := idx.postings["dharkan"]; ok {
+		t.Error("postings left behind")
+	}
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// YouTube title parser
+// Video titles pack artist, track, featured artists, version and marketing
+// noise into one string: "Artist - Song (Official Video) [4K] ft. X".
+// ParseYouTubeTitle splits that back into clean catalog metadata.
+
+// TrackMetadata is the structured form of a video title
+type TrackMetadata struct {
+	Artist        string   `json:"artist"`
+	Title         string   `json:"title"`
+	Featured      []string `json:"featured,omitempty"`
+	Version       string   `json:"version,omitempty"`       // live, remix, acoustic, lyric video, ...
+	VersionDetail string   `json:"versionDetail,omitempty"` // e.g. "Skrillex Remix", "Live at Wembley"
+}
+
+var (
+	// Bracketed segments: (...), [...], {...}, 【...】
+	bracketRe = regexp.MustCompile(`\([^()]*\)|\[[^\[\]]*\]|\{[^{}]*\}|【[^【】]*】`)
+
+	// Artist/title separators: spaced hyphen or tilde, or an en/em dash
+	separatorRe = regexp.MustCompile(`\s+[-~]\s+|\s*[–—]\s*`)
+
+	// Featured artists introduced inside the title
+	featRe = regexp.MustCompile(`(?i)(?:^|\s)(?:feat\.?|ft\.?|featuring|with)\s+(.+)$`)
+
+	// Splits a list of featured artists
+	artistListRe = regexp.MustCompile(`(?i)\s*(?:,|&|\+|\s+and\s+|\s+x\s+|\s+y\s+|\s+e\s+|\s+und\s+)\s*`)
+
+	// Resolution and quality markers, standalone
+	qualityRe = regexp.MustCompile(`(?i)^(?:4k|8k|hd|hq|uhd|fhd|\d{3,4}p(?:\d{2})?|60fps|hdr|remastered in 4k|4k remaster(?:ed)?)$`)
+
+	// Year tokens left over after a marker is removed, e.g. "Remastered 2009"
+	yearRe = regexp.MustCompile(`\b(?:19|20)\d{2}\b`)
+
+	spacesRe = regexp.MustCompile(`\s{2,}`)
+)
+
+// Phrases that carry no metadata. Matched against a whole bracketed segment
+// or a whole trailing "| ..." segment after lowercasing.
+var titleNoise = []string{
+	"official video", "official music video", "official audio", "official visualizer",
+	"official visualiser", "official hd video", "official 4k video", "official lyrics",
+	"official", "music video", "video", "audio", "audio only", "visualizer", "visualiser",
+	"mv", "m/v", "pv", "explicit", "clean", "dirty", "uncensored", "full song", "full video",
+	"full audio", "video oficial", "vídeo oficial", "videoclip oficial", "clip officiel",
+	"audio oficial", "official video hd", "hd video", "official hd", "premiere",
+	"new song", "latest song", "new video", "out now", "free download", "copyright free",
+	"no copyright", "topic", "lyrics on screen", "official movie", "official film",
+}
+
+// Version markers, checked in order. The first match in a segment wins.
+var titleVersions = []struct {
+	pattern *regexp.Regexp
+	version string
+}{
+	{regexp.MustCompile(`(?i)\blyric(?:s)?\s+video\b|\blyrical(?:\s+video)?\b|\bwith\s+lyrics\b|^lyrics?$|\blyrics?\s+(?:on\s+screen|in\s+description)\b|\bofficial\s+lyrics?\b`), "lyric video"},
+	{regexp.MustCompile(`(?i)\bremix(?:ed)?\b|\brmx\b|\brework\b|\bbootleg\b|\bflip\b|\bvip\s+mix\b|\bedit\b.*\bmix\b`), "remix"},
+	{regexp.MustCompile(`(?i)\blive\b|\bin\s+concert\b|\blive\s+session\b|\btiny\s+desk\b`), "live"},
+	{regexp.MustCompile(`(?i)\bacoustic\b|\bunplugged\b|\bstripped\b|\bpiano\s+version\b`), "acoustic"},
+	{regexp.MustCompile(`(?i)\binstrumental\b|\bkaraoke\b|\boff\s+vocal\b`), "instrumental"},
+	{regexp.MustCompile(`(?i)\bslowed\b|\breverb\b`), "slowed"},
+	{regexp.MustCompile(`(?i)\bsped\s+up\b|\bnightcore\b`), "sped up"},
+	{regexp.MustCompile(`(?i)\bcover\b`), "cover"},
+	{regexp.MustCompile(`(?i)\bremaster(?:ed)?\b`), "remaster"},
+	{regexp.MustCompile(`(?i)\bextended\b|\bclub\s+mix\b|\b12"`), "extended"},
+	{regexp.MustCompile(`(?i)\bradio\s+edit\b|\bsingle\s+version\b|\bclean\s+version\b`), "radio edit"},
+	{regexp.MustCompile(`(?i)\bdemo\b`), "demo"},
+}
+
+// Whole phrases that make up a version suffix after a separator, as in
+// "Song - Remastered 2011" or "Song - Live at Wembley". Unlike titleVersions
+// these must match all of the text, so a title that merely starts with a
+// version word ("Live Forever", "Cover Me") is left alone.
+var versionPhrases = []struct {
+	pattern *regexp.Regexp
+	version string
+}{
+	{regexp.MustCompile(`^(?:lyrics?|lyrics?\s+video|with\s+lyrics)$`), "lyric video"},
+	{regexp.MustCompile(`^(?:remix(?:ed)?|rmx|vip\s+mix|original\s+mix)$`), "remix"},
+	{regexp.MustCompile(`^(?:recorded\s+)?live(?:\s+(?:at|from|in|on|@)\s+.+|\s+(?:version|session|performance|recording)|\s+(?:19|20)\d{2})?$|^(?:in\s+concert|tiny\s+desk(?:\s+concert)?)$`), "live"},
+	{regexp.MustCompile(`^(?:acoustic|unplugged|stripped|piano)(?:\s+(?:version|session|mix|edit))?$`), "acoustic"},
+	{regexp.MustCompile(`^(?:instrumental|karaoke|off\s+vocal)(?:\s+(?:version|mix))?$`), "instrumental"},
+	{regexp.MustCompile(`^(?:slowed(?:\s+down)?(?:\s*(?:\+|&|and)\s*reverb)?|reverb)$`), "slowed"},
+	{regexp.MustCompile(`^(?:sped\s+up|nightcore)(?:\s+version)?$`), "sped up"},
+	{regexp.MustCompile(`^cover(?:\s+version)?$`), "cover"},
+	{regexp.MustCompile(`^(?:(?:19|20)\d{2}\s+)?(?:digital(?:ly)?\s+)?remaster(?:ed)?(?:\s+(?:version|edition))?(?:\s+(?:19|20)\d{2})?(?:\s+(?:version|edition))?$`), "remaster"},
+	{regexp.MustCompile(`^(?:extended(?:\s+(?:mix|version|edit))?|club\s+mix|12"?\s+(?:mix|version))$`), "extended"},
+	{regexp.MustCompile(`^(?:radio\s+(?:edit|version)|single\s+version|clean\s+version)$`), "radio edit"},
+	{regexp.MustCompile(`^(?:(?:19|20)\d{2}\s+)?demo(?:\s+version)?(?:\s+(?:19|20)\d{2})?$`), "demo"},
+}
+
+// Unbracketed noise at the end of a title, longest first
+var trailingNoise = []string{
+	"official music video", "official lyric video", "official video", "official audio",
+	"lyric video", "lyrics video", "with lyrics", "lyrics", "lyric", "music video",
+	"full video song", "video song", "full video", "full song", "video oficial", "audio oficial", "m/v", "mv",
+}
+
+// Channel suffixes that aren't part of the artist name. Words like "Music"
+// or "Records" are left alone since they're often part of a real name.
+var channelNoise = []string{" - Topic", "VEVO", "Vevo"}
+
+// ParseYouTubeTitle splits a video title into artist, title, featured artists
+// and version. channel is the uploader name, used as the artist when the
+// title doesn't name one.
+func ParseYouTubeTitle(rawTitle, channel string) TrackMetadata {
+	var meta TrackMetadata
+	title := normalizeTitleSpaces(rawTitle)
+	isTopic := strings.HasSuffix(channel, " - Topic")
+
+	// 1. Pull bracketed segments out, keeping those that are part of the name
+	// like "(Don't Fear) The Reaper"
+	title = bracketRe.ReplaceAllStringFunc(title, func(seg string) string {
+		inner := strings.TrimSpace(seg[len(firstRune(seg)) : len(seg)-len(lastRune(seg))])
+		if classifySegment(inner, &meta) == segmentKeep {
+			return seg
+		}
+		return " "
+	})
+
+	// 2. Drop trailing "| Official Video" / "// Lyrics" segments
+	pipeSegments := 0
+	for _, sep := range []string{" | ", " || ", " // "} {
+		if idx := strings.Index(title, sep); idx > 0 {
+			head, tail := title[:idx], title[idx+len(sep):]
+			for _, part := range strings.Split(tail, strings.TrimSpace(sep)) {
+				classifySegment(strings.TrimSpace(part), &meta)
+				pipeSegments++
+			}
+			title = head
+		}
+	}
+
+	// 3. Split "Artist - Title". Topic channels are auto-generated and their
+	// titles are already just the track name, and label uploads listing cast
+	// and crew ("Song - Film | Actor | Composer | Singer") lead with the track,
+	// so for those only a version suffix ("- Remastered 2011") is split off.
+	artist := ""
+	if isTopic || pipeSegments >= 2 {
+		if loc := separatorRe.FindStringIndex(title); loc != nil {
+			if left := strings.TrimSpace(title[:loc[0]]); left != "" {
+				classifySegment(strings.TrimSpace(title[loc[1]:]), &meta)
+				title = left
+			}
+		}
+	} else {
+		artist, title = splitArtistTitle(title, &meta)
+	}
+
+	// 4. Unquoted noise and version words left in the title itself,
+	// e.g. "Song Official Video 4K", "Song Lyrics"
+	title = stripTrailingNoise(title, &meta)
+
+	// 5. Featured artists written inline: "Song ft. X & Y", "Artist feat. X"
+	title = extractFeatured(title, &meta)
+	artist = extractFeatured(artist, &meta)
+
+	// 6. Fall back to the channel for the artist
+	if artist == "" {
+		artist = cleanChannelName(channel)
+	}
+
+	meta.Artist = trimTitlePunct(artist)
+	meta.Title = trimTitlePunct(unquoteTitle(title))
+	if meta.Title == "" {
+		meta.Title = strings.TrimSpace(rawTitle)
+	}
+	if meta.Artist == "" {
+		meta.Artist = "Unknown Artist"
+	}
+	meta.Featured = dedupeArtists(meta.Featured, meta.Artist)
+	return meta
+}
+
+type segmentKind int
+
+const (
+	segmentKeep segmentKind = iota
+	segmentDrop
+)
+
+// classifySegment records what a bracketed or trailing segment says about the
+// track and reports whether it belongs in the title
+func classifySegment(seg string, meta *TrackMetadata) segmentKind {
+	lower := strings.ToLower(strings.TrimSpace(seg))
+	if lower == "" {
+		return segmentDrop
+	}
+
+	if m := featRe.FindStringSubmatch(seg); m != nil && featRe.FindStringIndex(seg)[0] == 0 {
+		meta.Featured = append(meta.Featured, splitArtistList(m[1])...)
+		return segmentDrop
+	}
+	for _, v := range titleVersions {
+		if v.pattern.MatchString(lower) {
+			if meta.Version == "" {
+				meta.Version = v.version
+				if v.version != "lyric video" && !isNoiseOnly(lower) {
+					meta.VersionDetail = strings.TrimSpace(seg)
+				}
+			}
+			return segmentDrop
+		}
+	}
+	if isNoiseOnly(lower) {
+		return segmentDrop
+	}
+	return segmentKeep
+}
+
+// isNoiseOnly reports whether every word group in s is marketing noise
+func isNoiseOnly(lower string) bool {
+	lower = strings.Trim(lower, " .!-")
+	if qualityRe.MatchString(lower) {
+		return true
+	}
+	for _, n := range titleNoise {
+		if lower == n {
+			return true
+		}
+	}
+	// "Official Video 4K", "HD 1080p", "Official Music Video 2023"
+	words := strings.Fields(lower)
+	rest := make([]string, 0, len(words))
+	for _, w := range words {
+		if qualityRe.MatchString(w) || yearRe.MatchString(w) {
+			continue
+		}
+		rest = append(rest, w)
+	}
+	if len(rest) == 0 {
+		return len(words) > 0
+	}
+	if len(rest) < len(words) {
+		joined := strings.Join(rest, " ")
+		for _, n := range titleNoise {
+			if joined == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func splitArtistTitle(title string, meta *TrackMetadata) (string, string) {
+	// Quoted titles: Artist 'Title' / Artist "Title" / Artist「Title」
+	// (common for K-pop and J-pop MVs)
+	for _, q := range [][2]string{{"'", "'"}, {"‘", "’"}, {"\"", "\""}, {"“", "”"}, {"「", "」"}, {"『", "』"}} {
+		open := strings.Index(title, q[0])
+		if open <= 0 {
+			continue
+		}
+		closeIdx := strings.Index(title[open+len(q[0]):], q[1])
+		if closeIdx <= 0 {
+			continue
+		}
+		before := strings.TrimSpace(title[:open])
+		before = strings.TrimRight(before, "-–—: ")
+		quoted := title[open+len(q[0]) : open+len(q[0])+closeIdx]
+		after := strings.TrimSpace(title[open+len(q[0])+closeIdx+len(q[1]):])
+		// An apostrophe right after a letter is a contraction ("Guns N' Roses")
+		if q[0] == "'" && unicode.IsLetter(lastRuneOf(title[:open])) {
+			continue
+		}
+		if before != "" && len([]rune(quoted)) > 1 {
+			if after != "" {
+				classifySegment(after, meta)
+			}
+			return before, quoted
+		}
+	}
+
+	loc := separatorRe.FindStringIndex(title)
+	if loc == nil {
+		return "", title
+	}
+	left := strings.TrimSpace(title[:loc[0]])
+	right := strings.TrimSpace(title[loc[1]:])
+	if left == "" || right == "" {
+		return "", title
+	}
+
+	// "Song - Remastered 2011", "Song - Live at Wembley": the right side is a
+	// version marker, not a title
+	if classifyTail(right, meta) {
+		return "", left
+	}
+	// "Artist - Song - Live at Wembley"
+	if locs := separatorRe.FindAllStringIndex(right, -1); locs != nil {
+		last := locs[len(locs)-1]
+		if head := strings.TrimSpace(right[:last[0]]); head != "" && classifyTail(strings.TrimSpace(right[last[1]:]), meta) {
+			right = head
+		}
+	}
+	// "Song - Artist" can't be told apart from "Artist - Song"; YouTube's
+	// convention is artist first, so go with that
+	return left, right
+}
+
+// classifyTail reports whether s is nothing but noise or a version phrase
+func classifyTail(s string, meta *TrackMetadata) bool {
+	lower := strings.ToLower(strings.Trim(s, " .!"))
+	if isNoiseOnly(lower) {
+		return true
+	}
+	for _, v := range versionPhrases {
+		if v.pattern.MatchString(lower) {
+			if meta.Version == "" {
+				meta.Version = v.version
+				if v.version != "lyric video" {
+					meta.VersionDetail = strings.TrimSpace(s)
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// stripTrailingNoise removes unbracketed noise like "Song Official Video HD"
+func stripTrailingNoise(title string, meta *TrackMetadata) string {
+	lower := strings.ToLower(title)
+	for {
+		changed := false
+		for _, phrase := range trailingNoise {
+			if strings.HasSuffix(lower, " "+phrase) {
+				if strings.Contains(phrase, "lyric") && meta.Version == "" {
+					meta.Version = "lyric video"
+				}
+				title = strings.TrimSpace(title[:len(title)-len(phrase)-1])
+				lower = strings.ToLower(title)
+				changed = true
+			}
+		}
+		fields := strings.Fields(title)
+		if n := len(fields); n > 1 && qualityRe.MatchString(fields[n-1]) {
+			title = strings.Join(fields[:n-1], " ")
+			lower = strings.ToLower(title)
+			changed = true
+		}
+		if !changed {
+			return title
+		}
+	}
+}
+
+func extractFeatured(s string, meta *TrackMetadata) string {
+	loc := featRe.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return s
+	}
+	// "with" only counts as a featuring marker inside brackets; inline it's
+	// too often part of the title ("Dancing With a Stranger")
+	marker := strings.ToLower(strings.TrimSpace(s[loc[0]:loc[2]]))
+	if strings.HasPrefix(marker, "with") {
+		return s
+	}
+	meta.Featured = append(meta.Featured, splitArtistList(s[loc[2]:loc[3]])...)
+	return strings.TrimSpace(s[:loc[0]])
+}
+
+func splitArtistList(s string) []string {
+	var artists []string
+	for _, a := range artistListRe.Split(s, -1) {
+		a = trimTitlePunct(a)
+		if a != "" {
+			artists = append(artists, a)
+		}
+	}
+	return artists
+}
+
+func dedupeArtists(artists []string, main string) []string {
+	seen := map[string]bool{strings.ToLower(main): true}
+	var out []string
+	for _, a := range artists {
+		key := strings.ToLower(a)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// cleanChannelName strips " - Topic", "VEVO" and similar from an uploader name
+func cleanChannelName(channel string) string {
+	name := strings.TrimSpace(channel)
+	for changed := true; changed; {
+		changed = false
+		for _, suffix := range channelNoise {
+			if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				name = strings.TrimSpace(strings.TrimSuffix(name, suffix))
+				changed = true
+			}
+		}
+	}
+	return name
+}
+
+func normalizeTitleSpaces(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ' ', '​', '　':
+			return ' '
+		case '｜':
+			return '|'
+		}
+		// Emoji and pictographs carry no metadata
+		if r >= 0x1F000 || (r >= 0x2600 && r <= 0x27BF) {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(spacesRe.ReplaceAllString(s, " "))
+}
+
+func unquoteTitle(s string) string {
+	s = strings.TrimSpace(s)
+	for _, q := range [][2]string{{"\"", "\""}, {"'", "'"}, {"“", "”"}, {"‘", "’"}, {"「", "」"}, {"『", "』"}} {
+		if len(s) > len(q[0])+len(q[1]) && strings.HasPrefix(s, q[0]) && strings.HasSuffix(s, q[1]) {
+			return strings.TrimSpace(s[len(q[0]) : len(s)-len(q[1])])
+		}
+	}
+	return s
+}
+
+func trimTitlePunct(s string) string {
+	s = spacesRe.ReplaceAllString(strings.TrimSpace(s), " ")
+	return strings.Trim(s, " -–—|:~,/")
+}
+
+func firstRune(s string) string {
+	for _, r := range s {
+		return string(r)
+	}
+	return ""
+}
+
+func lastRune(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return ""
+	}
+	return string(r[len(r)-1])
+}
+
+func lastRuneOf(s string) rune {
+	s = strings.TrimRight(s, " ")
+	r := []rune(s)
+	if len(r) == 0 {
+		return ' '
+	}
+	return r[len(r)-1]
+}
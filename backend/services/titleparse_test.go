@@ -0,0 +1,134 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseYouTubeTitle(t *testing.T) {
+	tests := []struct {
+		title, channel string
+		artist, track  string
+		featured       []string
+		version        string
+	}{
+		// Plain "Artist - Title" with marketing noise
+		{"Rick Astley - Never Gonna Give You Up (Official Music Video)", "Rick Astley", "Rick Astley", "Never Gonna Give You Up", nil, ""},
+		{"Ed Sheeran - Shape of You (Official Music Video)", "Ed Sheeran", "Ed Sheeran", "Shape of You", nil, ""},
+		{"The Weeknd - Blinding Lights (Official Audio)", "The Weeknd", "The Weeknd", "Blinding Lights", nil, ""},
+		{"Eminem - Lose Yourself [HD]", "msvogue23", "Eminem", "Lose Yourself", nil, ""},
+		{"Toto - Africa (Official HD Video)", "TotoVEVO", "Toto", "Africa", nil, ""},
+		{"a-ha - Take On Me (Official Video) [4K]", "a-ha", "a-ha", "Take On Me", nil, ""},
+		{"Pharrell Williams - Happy (Video)", "Pharrell Williams", "Pharrell Williams", "Happy", nil, ""},
+		{"Survivor - Eye Of The Tiger (Official HD Video)", "Survivor", "Survivor", "Eye Of The Tiger", nil, ""},
+		{"Johnny Cash - Hurt (Official Music Video)", "Johnny Cash", "Johnny Cash", "Hurt", nil, ""},
+		{"Stromae - Alors On Danse (Official Music Video)", "Stromae", "Stromae", "Alors On Danse", nil, ""},
+		{"Tiësto - The Business (Official Music Video)", "Tiësto", "Tiësto", "The Business", nil, ""},
+		{"Fleetwood Mac - Dreams (Official Music Video)", "Fleetwood Mac", "Fleetwood Mac", "Dreams", nil, ""},
+		{"Alan Walker - Faded", "Alan Walker", "Alan Walker", "Faded", nil, ""},
+		{"Radiohead - Creep", "Radiohead", "Radiohead", "Creep", nil, ""},
+		{"Tones And I - Dance Monkey (Official Video)", "Tones And I", "Tones And I", "Dance Monkey", nil, ""},
+		{"Childish Gambino - This Is America (Official Video)", "Donald Glover", "Childish Gambino", "This Is America", nil, ""},
+		{"Coldplay - Viva La Vida (Official Video) | Coldplay", "Coldplay", "Coldplay", "Viva La Vida", nil, ""},
+		{"Bad Bunny x Jhay Cortez - Dákiti (Video Oficial)", "Bad Bunny", "Bad Bunny x Jhay Cortez", "Dákiti", nil, ""},
+
+		// Punctuation that belongs to the name
+		{"Kendrick Lamar - HUMBLE. (Official Video)", "Kendrick Lamar", "Kendrick Lamar", "HUMBLE.", nil, ""},
+		{"Gorillaz - Feel Good Inc. (Official Video)", "Gorillaz", "Gorillaz", "Feel Good Inc.", nil, ""},
+		{"The Killers - Mr. Brightside (Official Music Video)", "The Killers", "The Killers", "Mr. Brightside", nil, ""},
+		{"Arctic Monkeys - Do I Wanna Know? (Official Video)", "Arctic Monkeys", "Arctic Monkeys", "Do I Wanna Know?", nil, ""},
+		{"Journey - Don't Stop Believin' (Official Audio)", "Journey", "Journey", "Don't Stop Believin'", nil, ""},
+		{"Guns N' Roses - Sweet Child O' Mine (Official Music Video)", "Guns N' Roses", "Guns N' Roses", "Sweet Child O' Mine", nil, ""},
+		{"Blue Öyster Cult - (Don't Fear) The Reaper", "Blue Öyster Cult", "Blue Öyster Cult", "(Don't Fear) The Reaper", nil, ""},
+		{"Post Malone, Swae Lee - Sunflower (Spider-Man: Into the Spider-Verse)", "Post Malone", "Post Malone, Swae Lee", "Sunflower (Spider-Man: Into the Spider-Verse)", nil, ""},
+		{"Lady Gaga, Bradley Cooper - Shallow (from A Star Is Born) (Official Music Video)", "Lady Gaga", "Lady Gaga, Bradley Cooper", "Shallow (from A Star Is Born)", nil, ""},
+
+		// Titles starting with a version word are titles, not versions
+		{"Rihanna - Live Your Life", "RihannaVEVO", "Rihanna", "Live Your Life", nil, ""},
+		{"Oasis - Live Forever (Official Video)", "Oasis", "Oasis", "Live Forever", nil, ""},
+		{"Bruce Springsteen - Cover Me", "Bruce Springsteen", "Bruce Springsteen", "Cover Me", nil, ""},
+		{"Demo - Something", "Demo", "Demo", "Something", nil, ""},
+		{"Edit - Some Song", "Edit", "Edit", "Some Song", nil, ""},
+
+		// Featured artists
+		{"T.I. - Live Your Life ft. Rihanna", "T.I.", "T.I.", "Live Your Life", []string{"Rihanna"}, ""},
+		{"Luis Fonsi - Despacito ft. Daddy Yankee", "LuisFonsiVEVO", "Luis Fonsi", "Despacito", []string{"Daddy Yankee"}, ""},
+		{"Mark Ronson - Uptown Funk (Official Video) ft. Bruno Mars", "Mark Ronson", "Mark Ronson", "Uptown Funk", []string{"Bruno Mars"}, ""},
+		{"Dua Lipa - Levitating Featuring DaBaby (Official Music Video)", "Dua Lipa", "Dua Lipa", "Levitating", []string{"DaBaby"}, ""},
+		{"Daft Punk - Get Lucky (Official Audio) ft. Pharrell Williams, Nile Rodgers", "Daft Punk", "Daft Punk", "Get Lucky", []string{"Pharrell Williams", "Nile Rodgers"}, ""},
+		{"Shakira - Hips Don't Lie (Official 4K Video) ft. Wyclef Jean", "shakiraVEVO", "Shakira", "Hips Don't Lie", []string{"Wyclef Jean"}, ""},
+		{"Marshmello ft. Bastille - Happier (Official Music Video)", "Marshmello", "Marshmello", "Happier", []string{"Bastille"}, ""},
+		{"Lil Nas X - Old Town Road (Official Movie) ft. Billy Ray Cyrus", "Lil Nas X", "Lil Nas X", "Old Town Road", []string{"Billy Ray Cyrus"}, ""},
+		{"Bangarang (feat. Sirah)", "Skrillex - Topic", "Skrillex", "Bangarang", []string{"Sirah"}, ""},
+		{"Sam Smith, Normani - Dancing With A Stranger (Official Video)", "Sam Smith", "Sam Smith, Normani", "Dancing With A Stranger", nil, ""},
+		{"Dancing With A Stranger", "Sam Smith - Topic", "Sam Smith", "Dancing With A Stranger", nil, ""},
+
+		// Versions
+		{"Nirvana - Smells Like Teen Spirit (Live at Reading 1992)", "Nirvana", "Nirvana", "Smells Like Teen Spirit", nil, "live"},
+		{"Adele - Someone Like You (Live at the Royal Albert Hall)", "Adele", "Adele", "Someone Like You", nil, "live"},
+		{"Coldplay - Yellow - Live in Buenos Aires", "Coldplay", "Coldplay", "Yellow", nil, "live"},
+		{"Eagles - Hotel California (Live 1977) (Official Video) [HD]", "Eagles", "Eagles", "Hotel California", nil, "live"},
+		{"Imagine Dragons - Believer (Acoustic Version)", "ImagineDragonsVEVO", "Imagine Dragons", "Believer", nil, "acoustic"},
+		{"Hozier - Take Me To Church - Acoustic", "Hozier", "Hozier", "Take Me To Church", nil, "acoustic"},
+		{"Lewis Capaldi - Someone You Loved (Instrumental)", "Karaoke", "Lewis Capaldi", "Someone You Loved", nil, "instrumental"},
+		{"SZA - Kill Bill (slowed + reverb)", "slowed", "SZA", "Kill Bill", nil, "slowed"},
+		{"Miley Cyrus - Flowers (Sped Up)", "sped", "Miley Cyrus", "Flowers", nil, "sped up"},
+		{"Nirvana - Something In The Way (Demo)", "Nirvana", "Nirvana", "Something In The Way", nil, "demo"},
+		{"Billie Eilish - bad guy (Lyrics)", "7clouds", "Billie Eilish", "bad guy", nil, "lyric video"},
+		{"Queen – Bohemian Rhapsody (Official Video Remastered)", "Queen Official", "Queen", "Bohemian Rhapsody", nil, "remaster"},
+		{"Here Comes The Sun (Remastered 2009)", "The Beatles - Topic", "The Beatles", "Here Comes The Sun", nil, "remaster"},
+		{"Wonderwall - Remastered", "Oasis - Topic", "Oasis", "Wonderwall", nil, "remaster"},
+		{"Hotel California - 2013 Remaster", "Eagles - Topic", "Eagles", "Hotel California", nil, "remaster"},
+		{"Levels - Skrillex Remix", "Avicii - Topic", "Avicii", "Levels", nil, "remix"},
+
+		// K-pop and J-pop quoting
+		{"BLACKPINK - '뚜두뚜두 (DDU-DU DDU-DU)' M/V", "BLACKPINK", "BLACKPINK", "뚜두뚜두 (DDU-DU DDU-DU)", nil, ""},
+		{"BTS (방탄소년단) 'Dynamite' Official MV", "HYBE LABELS", "BTS (방탄소년단)", "Dynamite", nil, ""},
+		{"YOASOBI「夜に駆ける」Official Music Video", "Ayase / YOASOBI", "YOASOBI", "夜に駆ける", nil, ""},
+
+		// Label uploads that list cast and crew after the track
+		{"Kesariya - Brahmāstra | Ranbir Kapoor | Alia Bhatt | Pritam | Arijit Singh | Amitabh Bhattacharya", "Sony Music India", "Sony Music India", "Kesariya", nil, ""},
+
+		// Channel names
+		{"Avicii - Wake Me Up (Official Video)", "AviciiOfficialVEVO", "Avicii", "Wake Me Up", nil, ""},
+		{"Showcase", "Beats Music", "Beats Music", "Showcase", nil, ""},
+		{"Some Song", "Abbey Road Records", "Abbey Road Records", "Some Song", nil, ""},
+		{"Sunday Morning", "Maroon 5 - Topic", "Maroon 5", "Sunday Morning", nil, ""},
+		{"Chandelier", "SiaVEVO", "Sia", "Chandelier", nil, ""},
+	}
+
+	for _, tt := range tests {
+		got := ParseYouTubeTitle(tt.title, tt.channel)
+		if got.Artist != tt.artist || got.Title != tt.track || got.Version != tt.version || !slices.Equal(got.Featured, tt.featured) {
+			t.Errorf("ParseYouTubeTitle(%q, %q)\n got artist=%q title=%q featured=%q version=%q\nwant artist=%q title=%q featured=%q version=%q",
+				tt.title, tt.channel, got.Artist, got.Title, got.Featured, got.Version,
+				tt.artist, tt.track, tt.featured, tt.version)
+		}
+	}
+}
+
+func TestParseYouTubeTitleVersionDetail(t *testing.T) {
+	got := ParseYouTubeTitle("Nirvana - Smells Like Teen Spirit (Live at Reading 1992)", "Nirvana")
+	if got.VersionDetail != "Live at Reading 1992" {
+		t.Errorf("VersionDetail = %q", got.VersionDetail)
+	}
+	got = ParseYouTubeTitle("Levels - Skrillex Remix", "Avicii - Topic")
+	if got.VersionDetail != "Skrillex Remix" {
+		t.Errorf("VersionDetail = %q", got.VersionDetail)
+	}
+}
+
+func TestCleanChannelName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Adele - Topic":      "Adele",
+		"RihannaVEVO":        "Rihanna",
+		"Beats Music":        "Beats Music",
+		"Abbey Road Records": "Abbey Road Records",
+		"Music TV":           "Music TV",
+		"VEVO":               "VEVO",
+	} {
+		if got := cleanChannelName(in); got != want {
+			t.Errorf("cleanChannelName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// YouTube Music
+// Searches and audio streams are resolved through the configured extractor
+// chain (see extractor.go); this file adds query biasing, filtering and caching
+
+// Cache for audio URLs (they expire after ~6 hours)
+var (
+	audioCache   = make(map[string]cachedAudio)
+	audioCacheMu sync.RWMutex
+)
+
+// YouTube video IDs are 11 URL-safe base64 characters
+var youtubeIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// ErrInvalidVideoID is returned for IDs that can't be YouTube videos
+var ErrInvalidVideoID = errors.New("invalid YouTube video ID")
+
+// ValidYouTubeID reports whether id looks like a YouTube video ID
+func ValidYouTubeID(id string) bool {
+	return youtubeIDRe.MatchString(id)
+}
+
+type cachedAudio struct {
+	Info      *PipedStreamInfo
+	ExpiresAt time.Time
+}
+
+func SearchYouTubeMusic(ctx context.Context, query string, limit int) ([]PipedTrack, error) {
+	if limit <= 0 || limit > 30 {
+		limit = 10
+	}
+
+	// Fetch limit + 10 tracks to have a healthy pool to filter/sort while keeping yt-dlp fast
+	fetchCount := limit + 10
+	searchQuery := strings.TrimSpace(query)
+	// Add "official song" to bias YouTube towards actual music if not already present
+	if !strings.Contains(strings.ToLower(searchQuery), "song") && !strings.Contains(strings.ToLower(searchQuery), "music") {
+		searchQuery += " official song"
+	}
+
+	results, err := getExtractor().Search(ctx, searchQuery, fetchCount)
+	if err != nil {
+		return nil, err
+	}
+
+	allTracks := cleanYouTubeTracks(results)
+
+	// Sort tracks by views descending (most popular first)
+	for i := 0; i < len(allTracks); i++ {
+		for j := i + 1; j < len(allTracks); j++ {
+			if allTracks[i].Views < allTracks[j].Views {
+				allTracks[i], allTracks[j] = allTracks[j], allTracks[i]
+			}
+		}
+	}
+
+	// Return top `limit` tracks
+	if len(allTracks) > limit {
+		return allTracks[:limit], nil
+	}
+
+	return allTracks, nil
+}
+
+// cleanYouTubeTracks drops non-songs and normalizes titles and thumbnails
+func cleanYouTubeTracks(results []PipedTrack) []PipedTrack {
+	var tracks []PipedTrack
+	for _, result := range results {
+		// Filter out Shorts (<60s) and long mixes/compilations (>12m)
+		if result.Duration < 60 || result.Duration > 720 {
+			continue
+		}
+
+		// Split "Artist - Title (Official Video) ft. X" into clean metadata
+		meta := ParseYouTubeTitle(result.Title, result.Artist)
+		result.Title = meta.Title
+		result.Artist = meta.Artist
+		if result.Artist == "" {
+			result.Artist = "Unknown Artist"
+		}
+		result.Featured = meta.Featured
+		result.Version = meta.Version
+
+		// Use a good thumbnail
+		if result.Thumbnail == "" {
+			result.Thumbnail = fmt.Sprintf("https://i.ytimg.com/vi/%s/hqdefault.jpg", result.VideoID)
+		}
+
+		tracks = append(tracks, result)
+	}
+	return tracks
+}
+
+// Trending feeds change slowly, so they're cached per region
+var youtubeTrendingCache = newRegionCache[[]PipedTrack](30 * time.Minute)
+
+// GetYouTubeTrending gets trending music for a region. Extractors with a
+// regional music chart (Invidious) are used when configured; otherwise it's
+// approximated with a search for the country's hits.
+func GetYouTubeTrending(ctx context.Context, region string, limit int) ([]PipedTrack, error) {
+	if limit <= 0 || limit > 30 {
+		limit = 10
+	}
+	if region = NormalizeRegion(region); region == "" {
+		region = DefaultRegion()
+	}
+	key := fmt.Sprintf("%s:%d", region, limit)
+	if tracks, ok := youtubeTrendingCache.get(key); ok {
+		return tracks, nil
+	}
+
+	tracks, err := getExtractor().Trending(ctx, region, limit+10)
+	if err == nil {
+		// Keep the chart order rather than re-sorting by views
+		tracks = cleanYouTubeTracks(tracks)
+		if len(tracks) > limit {
+			tracks = tracks[:limit]
+		}
+	}
+	if err != nil || len(tracks) == 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		tracks, err = SearchYouTubeMusic(ctx, fmt.Sprintf("top trending songs %s this week music", regionName(region)), limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	youtubeTrendingCache.set(key, tracks)
+	return tracks, nil
+}
+
+// GetYouTubeAudioURL gets the direct audio stream URL for a video
+func GetYouTubeAudioURL(ctx context.Context, videoID string) (*PipedStreamInfo, error) {
+	if !ValidYouTubeID(videoID) {
+		return nil, ErrInvalidVideoID
+	}
+
+	// Check cache first
+	audioCacheMu.RLock()
+	if cached, ok := audioCache[videoID]; ok && time.Now().Before(cached.ExpiresAt) {
+		audioCacheMu.RUnlock()
+		return cached.Info, nil
+	}
+	audioCacheMu.RUnlock()
+
+	info, err := getExtractor().AudioStream(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache for 5 hours (YouTube URLs expire after ~6 hours)
+	audioCacheMu.Lock()
+	audioCache[videoID] = cachedAudio{
+		Info:      info,
+		ExpiresAt: time.Now().Add(5 * time.Hour),
+	}
+	audioCacheMu.Unlock()
+
+	return info, nil
+}
+
+// InvalidateYouTubeAudioURL drops a cached stream URL that upstream has
+// stopped accepting, so the next lookup resolves a fresh one
+func InvalidateYouTubeAudioURL(videoID string) {
+	audioCacheMu.Lock()
+	delete(audioCache, videoID)
+	audioCacheMu.Unlock()
+}
+
+// GetBestAudioURL extracts the best audio URL from stream info
+func GetBestAudioURL(info *PipedStreamInfo) string {
+	if len(info.AudioStreams) == 0 {
+		return ""
+	}
+	return info.AudioStreams[0].URL
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// yt-dlp process supervisor
+// Every yt-dlp invocation goes through a bounded worker pool so a burst of
+// searches can't fork an unbounded number of processes, and every process is
+// tied to the caller's context so an aborted HTTP request kills it.
+
+var (
+	// ErrExtractorBusy is returned when the worker pool and its queue are full
+	ErrExtractorBusy = errors.New("extractor busy, try again later")
+	// ErrExtractorTimeout is returned when a yt-dlp process exceeds its hard timeout
+	ErrExtractorTimeout = errors.New("extractor timed out")
+)
+
+// YTDLPSupervisor runs yt-dlp processes with concurrency limits and timeouts
+type YTDLPSupervisor struct {
+	path     string
+	timeout  time.Duration
+	workers  chan struct{} // one token per running process
+	tickets  chan struct{} // one token per running or queued process
+	running  atomic.Int64
+	queued   atomic.Int64
+	rejected atomic.Int64
+
+	versionMu      sync.Mutex
+	version        string
+	versionErr     error
+	versionChecked time.Time
+}
+
+// YTDLPStatus is reported by the health endpoint
+type YTDLPStatus struct {
+	Available  bool   `json:"available"`
+	Version    string `json:"version,omitempty"`
+	Path       string `json:"path"`
+	Error      string `json:"error,omitempty"`
+	Running    int64  `json:"running"`
+	Queued     int64  `json:"queued"`
+	Rejected   int64  `json:"rejected"`
+	MaxWorkers int    `json:"maxWorkers"`
+	MaxQueue   int    `json:"maxQueue"`
+	TimeoutSec int    `json:"timeoutSec"`
+}
+
+const ytdlpVersionTTL = 10 * time.Minute
+
+var (
+	ytdlpSupervisor     *YTDLPSupervisor
+	ytdlpSupervisorOnce sync.Once
+)
+
+// getYTDLP returns the shared supervisor, configured from the environment on
+// first use (after main has loaded .env)
+func getYTDLP() *YTDLPSupervisor {
+	ytdlpSupervisorOnce.Do(func() {
+		ytdlpSupervisor = NewYTDLPSupervisor(
+			getYTDLPPath(),
+			envInt("YTDLP_MAX_WORKERS", 4),
+			envInt("YTDLP_MAX_QUEUE", 16),
+			envDuration("YTDLP_TIMEOUT", 30*time.Second),
+		)
+	})
+	return ytdlpSupervisor
+}
+
+// NewYTDLPSupervisor creates a supervisor that runs at most maxWorkers
+// processes at once and holds at most maxQueue more waiting for a slot
+func NewYTDLPSupervisor(path string, maxWorkers, maxQueue int, timeout time.Duration) *YTDLPSupervisor {
+	if maxWorkers <= 0 {
+		maxWorkers = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &YTDLPSupervisor{
+		path:    path,
+		timeout: timeout,
+		workers: make(chan struct{}, maxWorkers),
+		tickets: make(chan struct{}, maxWorkers+maxQueue),
+	}
+}
+
+// Run executes yt-dlp with the given arguments and returns its stdout.
+// The process is killed when ctx is cancelled or the hard timeout elapses.
+func (s *YTDLPSupervisor) Run(ctx context.Context, args ...string) ([]byte, error) {
+	// Admission: refuse immediately instead of piling up behind a full queue
+	select {
+	case s.tickets <- struct{}{}:
+	default:
+		s.rejected.Add(1)
+		slog.Warn("yt-dlp queue full", "running", s.running.Load(), "queued", s.queued.Load())
+		return nil, ErrExtractorBusy
+	}
+	defer func() { <-s.tickets }()
+
+	s.queued.Add(1)
+	select {
+	case s.workers <- struct{}{}:
+		s.queued.Add(-1)
+	case <-ctx.Done():
+		s.queued.Add(-1)
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.workers }()
+
+	s.running.Add(1)
+	defer s.running.Add(-1)
+
+	runCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, s.path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 2 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+
+	target := ""
+	if len(args) > 0 {
+		target = args[len(args)-1]
+	}
+
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		slog.Error("yt-dlp timed out", "target", target, "timeout", s.timeout, "stderr", trimStderr(stderr.String()))
+		return stdout.Bytes(), ErrExtractorTimeout
+	}
+	if ctx.Err() != nil {
+		slog.Info("yt-dlp cancelled", "target", target, "elapsed", elapsed)
+		return stdout.Bytes(), ctx.Err()
+	}
+
+	if err != nil {
+		slog.Warn("yt-dlp exited with error", "target", target, "elapsed", elapsed, "err", err, "stderr", trimStderr(stderr.String()))
+		return stdout.Bytes(), fmt.Errorf("yt-dlp: %v", err)
+	}
+	if stderr.Len() > 0 {
+		slog.Debug("yt-dlp stderr", "target", target, "elapsed", elapsed, "stderr", trimStderr(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Version returns the yt-dlp version, probing the binary at most once per TTL
+func (s *YTDLPSupervisor) Version(ctx context.Context) (string, error) {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+
+	if !s.versionChecked.IsZero() && time.Since(s.versionChecked) < ytdlpVersionTTL {
+		return s.version, s.versionErr
+	}
+
+	// Probe outside the worker pool so health checks still work under load
+	probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(probeCtx, s.path, "--version").Output()
+
+	s.versionChecked = time.Now()
+	if err != nil {
+		s.version, s.versionErr = "", fmt.Errorf("yt-dlp not available: %v", err)
+	} else {
+		s.version, s.versionErr = strings.TrimSpace(string(out)), nil
+	}
+	return s.version, s.versionErr
+}
+
+// Status reports availability and pool usage
+func (s *YTDLPSupervisor) Status(ctx context.Context) YTDLPStatus {
+	status := YTDLPStatus{
+		Path:       s.path,
+		Running:    s.running.Load(),
+		Queued:     s.queued.Load(),
+		Rejected:   s.rejected.Load(),
+		MaxWorkers: cap(s.workers),
+		MaxQueue:   cap(s.tickets) - cap(s.workers),
+		TimeoutSec: int(s.timeout.Seconds()),
+	}
+	version, err := s.Version(ctx)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Available = true
+		status.Version = version
+	}
+	return status
+}
+
+// GetYTDLPStatus reports the shared supervisor's status for the health endpoint
+func GetYTDLPStatus(ctx context.Context) YTDLPStatus {
+	return getYTDLP().Status(ctx)
+}
+
+// trimStderr keeps log lines bounded when yt-dlp dumps a traceback
+func trimStderr(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 2000 {
+		s = s[:2000] + "…"
+	}
+	return s
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envDuration accepts Go durations ("45s") or plain seconds ("45")
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	return def
+}
@@ -3,12 +3,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"spotify-clone/services"
 )
 
 func main() {
-	tracks, err := services.SearchYouTubeMusic("Justin Bieber Baby", 1)
+	tracks, err := services.SearchYouTubeMusic(context.Background(), "Justin Bieber Baby", 1)
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
 		return
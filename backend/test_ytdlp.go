@@ -3,13 +3,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"spotify-clone/services"
 )
 
 func main() {
 	fmt.Println("Testing GetYouTubeAudioURL...")
-	info, err := services.GetYouTubeAudioURL("lYBUbBu4W08")
+	info, err := services.GetYouTubeAudioURL(context.Background(), "lYBUbBu4W08")
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
 		return
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Cursor marks where a page ended. Clients get it base64-encoded and pass
+// it back unchanged; it's only valid for the sort order it was made for.
+type Cursor struct {
+	Sort   string      `json:"s"`
+	After  string      `json:"a,omitempty"` // last document ID, for Firestore queries
+	Value  interface{} `json:"v,omitempty"` // last document's sort field value
+	Offset int         `json:"o,omitempty"` // for lists paged in memory
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func EncodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor made for the given sort. An empty string is
+// the first page.
+func DecodeCursor(s, sort string) (Cursor, error) {
+	if s == "" {
+		return Cursor{Sort: sort}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || c.Offset < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// IDPage pages a list of IDs held in memory. The next page starts after
+// the cursor's last ID, so it stays put when items are added or removed
+// before it; the offset is the fallback when that ID is gone.
+func IDPage(ids []string, cursor Cursor, limit int) (page []string, next string) {
+	start := min(cursor.Offset, len(ids))
+	if cursor.After != "" {
+		for i, id := range ids {
+			if id == cursor.After {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := min(start+limit, len(ids))
+	page = ids[start:end]
+	if end < len(ids) && len(page) > 0 {
+		next = EncodeCursor(Cursor{Sort: cursor.Sort, After: page[len(page)-1], Offset: end})
+	}
+	return page, next
+}
@@ -34,21 +34,27 @@ func ErrorResponse(c *gin.Context, status int, err string) {
 	})
 }
 
+// PaginatedResponse is the envelope of every list endpoint. NextCursor is
+// empty on the last page; TotalCount is null when counting would take a
+// full scan, like songs filtered on fields Firestore can't query.
 type PaginatedResponse struct {
 	Items      interface{} `json:"items"`
-	TotalCount int         `json:"totalCount"`
-	Page       int         `json:"page"`
-	PageSize   int         `json:"pageSize"`
+	NextCursor string      `json:"nextCursor"`
+	TotalCount *int        `json:"totalCount"`
 }
 
-func PaginatedSuccess(c *gin.Context, items interface{}, total, page, pageSize int) {
+func PaginatedSuccess(c *gin.Context, items interface{}, nextCursor string, total *int) {
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
 		Data: PaginatedResponse{
 			Items:      items,
+			NextCursor: nextCursor,
 			TotalCount: total,
-			Page:       page,
-			PageSize:   pageSize,
 		},
 	})
 }
+
+// Count is a known total for PaginatedSuccess
+func Count(n int) *int {
+	return &n
+}
@@ -33,13 +33,13 @@ export default function AdminDashboard() {
                 setStats(res.data || {});
             } else if (tab === 'users') {
                 const res = await adminGetUsers();
-                setUsers(res.data || []);
+                setUsers(res.data?.items || []);
             } else if (tab === 'songs') {
                 const res = await adminGetSongs();
-                setSongs(res.data || []);
+                setSongs(res.data?.items || []);
             } else if (tab === 'artists') {
                 const res = await adminGetArtists();
-                setArtists(res.data || []);
+                setArtists(res.data?.items || []);
             }
         } catch { }
     }
@@ -31,7 +31,7 @@ export default function ArtistDashboard() {
             ]);
             if (p.status === 'fulfilled') setProfile(p.value.data);
             if (a.status === 'fulfilled') setAnalytics(a.value.data);
-            if (al.status === 'fulfilled') setAlbums(al.value.data || []);
+            if (al.status === 'fulfilled') setAlbums(al.value.data?.items || []);
         } catch { }
     }
 
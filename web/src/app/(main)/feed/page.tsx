@@ -2,7 +2,8 @@
 
 import { useEffect, useState } from 'react';
 import { motion } from 'framer-motion';
-import { Sparkles, Music } from 'lucide-react';
+import { Sparkles, Music, ListMusic } from 'lucide-react';
+import Link from 'next/link';
 import { discoverFeed } from '@/lib/api';
 import { usePlayerStore, Song } from '@/store/playerStore';
 import SongCard from '@/components/cards/SongCard';
@@ -26,19 +27,27 @@ function mapYouTube(t: PipedTrack): Song {
     };
 }
 
+interface PlaylistUpdate {
+    playlistId: string; playlistName: string; coverURL?: string;
+    item: { itemId: string; addedBy: string; addedAt: string };
+    song: Song;
+}
+
 export default function FeedPage() {
     const { userProfile } = useAuthStore();
     const { playQueue } = usePlayerStore();
     const [feedTracks, setFeedTracks] = useState<Song[]>([]);
+    const [playlistUpdates, setPlaylistUpdates] = useState<PlaylistUpdate[]>([]);
     const [loading, setLoading] = useState(true);
 
     useEffect(() => {
         async function fetchFeed() {
             try {
                 const res = await discoverFeed({ limit: 30 });
-                if (res.data && Array.isArray(res.data)) {
-                    setFeedTracks(res.data.map(mapYouTube));
+                if (Array.isArray(res.data?.tracks)) {
+                    setFeedTracks(res.data.tracks.map(mapYouTube));
                 }
+                setPlaylistUpdates(res.data?.playlistUpdates || []);
             } catch (error) {
                 console.error("Failed to fetch custom feed", error);
             } finally {
@@ -61,6 +70,37 @@ export default function FeedPage() {
                 </p>
             </motion.div>
 
+            {/* Songs added to followed playlists */}
+            {!loading && playlistUpdates.length > 0 && (
+                <section className="mb-10">
+                    <h2 className="text-2xl font-bold mb-5">New in Playlists You Follow</h2>
+                    <div className="space-y-2">
+                        {playlistUpdates.map((u, idx) => (
+                            <div key={`${u.playlistId}-${u.item.itemId}`} className="flex items-center gap-4 p-3 rounded-lg hover:bg-white/5">
+                                <button
+                                    onClick={() => playQueue(playlistUpdates.map((x) => x.song), idx)}
+                                    className="w-12 h-12 rounded bg-dark-500 flex-shrink-0 overflow-hidden flex items-center justify-center"
+                                >
+                                    {u.song.coverURL ? (
+                                        <img src={u.song.coverURL} alt="" className="w-full h-full object-cover" />
+                                    ) : (
+                                        <Music className="w-5 h-5 text-dark-300" />
+                                    )}
+                                </button>
+                                <div className="flex-1 min-w-0">
+                                    <p className="font-medium truncate">{u.song.title}</p>
+                                    <p className="text-sm text-dark-300 truncate">{u.song.artistName}</p>
+                                </div>
+                                <Link href={`/playlist/${u.playlistId}`} className="flex items-center gap-2 text-sm text-dark-300 hover:text-white truncate">
+                                    <ListMusic className="w-4 h-4" />
+                                    {u.playlistName}
+                                </Link>
+                            </div>
+                        ))}
+                    </div>
+                </section>
+            )}
+
             {loading ? (
                 <CardGridSkeleton />
             ) : feedTracks.length > 0 ? (
@@ -8,47 +8,57 @@ import { usePlayerStore } from '@/store/playerStore';
 // We inline minimal mapping logic or use types from store since api.ts doesn't export them
 import { Song } from '@/store/playerStore';
 
+// Map mixed backend sources to frontend Song type
+function mapTrack(track: any): Song {
+    return {
+        id: track.id || track.videoId || Math.random().toString(),
+        title: track.title || track.name || 'Unknown Title',
+        artistName: track.artistName || track.artist || 'Unknown Artist',
+        coverURL: track.coverURL || track.image || track.thumbnail || '',
+        audioURL: track.audioURL || track.audio || (track.videoId ? `youtube:${track.videoId}` : ''),
+        duration: track.duration || 0,
+        fileSize: 0,
+        artistId: track.artistId || '',
+        source: track.source || 'local',
+        playCount: track.playCount || 0,
+        genre: track.genre || ''
+    };
+}
+
 export default function HistoryPage() {
     const [songs, setSongs] = useState<Song[]>([]);
+    const [nextCursor, setNextCursor] = useState('');
     const [isLoading, setIsLoading] = useState(true);
+    const [loadingMore, setLoadingMore] = useState(false);
     const [error, setError] = useState('');
     const { playSong, currentSong, isPlaying, togglePlay } = usePlayerStore();
 
-    useEffect(() => {
-        const fetchHistory = async () => {
-            try {
-                const response = await getRecentlyPlayed();
-                const data = response?.data || response;
-                if (data && Array.isArray(data)) {
-                    // Map mixed backend sources to frontend Song type
-                    const mappedSongs: Song[] = data.map(track => {
-                        return {
-                            id: track.id || track.videoId || Math.random().toString(),
-                            title: track.title || track.name || 'Unknown Title',
-                            artistName: track.artistName || track.artist || 'Unknown Artist',
-                            coverURL: track.coverURL || track.image || track.thumbnail || '',
-                            audioURL: track.audioURL || track.audio || (track.videoId ? `youtube:${track.videoId}` : ''),
-                            duration: track.duration || 0,
-                            fileSize: 0,
-                            artistId: track.artistId || '',
-                            source: track.source || 'local',
-                            playCount: track.playCount || 0,
-                            genre: track.genre || ''
-                        };
-                    });
-                    setSongs(mappedSongs);
-                }
-            } catch (err: any) {
-                console.error("Failed to load history:", err);
-                setError(err.message || 'Failed to load your listening history');
-            } finally {
-                setIsLoading(false);
+    // Loads a page of history, appending it after the first
+    const fetchHistory = async (cursor?: string) => {
+        try {
+            const response = await getRecentlyPlayed({ limit: 50, cursor });
+            const data = response?.data?.items;
+            if (data && Array.isArray(data)) {
+                const page = data.map(mapTrack);
+                setSongs((prev) => cursor ? [...prev, ...page] : page);
             }
-        };
+            setNextCursor(response?.data?.nextCursor || '');
+        } catch (err: any) {
+            console.error("Failed to load history:", err);
+            setError(err.message || 'Failed to load your listening history');
+        }
+    };
 
-        fetchHistory();
+    useEffect(() => {
+        fetchHistory().finally(() => setIsLoading(false));
     }, []);
 
+    const loadMore = async () => {
+        setLoadingMore(true);
+        await fetchHistory(nextCursor);
+        setLoadingMore(false);
+    };
+
     const handlePlay = (song: Song, index: number) => {
         if (currentSong?.id === song.id) {
             togglePlay();
@@ -138,6 +148,14 @@ export default function HistoryPage() {
                     })}
                 </div>
             )}
+
+            {nextCursor && (
+                <div className="flex justify-center mt-8">
+                    <button onClick={loadMore} disabled={loadingMore} className="btn-secondary px-6 py-2">
+                        {loadingMore ? 'Loading...' : 'Load more'}
+                    </button>
+                </div>
+            )}
         </div>
     );
 }
@@ -2,12 +2,13 @@
 
 import { useEffect, useState } from 'react';
 import { motion } from 'framer-motion';
-import { Play, TrendingUp, Music2, Sparkles, Heart, Headphones, Zap, Youtube } from 'lucide-react';
+import { Play, TrendingUp, Music2, Sparkles, Heart, Headphones, Zap, Youtube, Disc3 } from 'lucide-react';
 import { useAuthStore } from '@/store/authStore';
 import { usePlayerStore, Song } from '@/store/playerStore';
 import {
     discoverJamendo,
     discoverYouTube,
+    discoverDeezer,
     discoverFeatured
 } from '@/lib/api';
 import { getGreeting } from '@/lib/utils';
@@ -54,6 +55,7 @@ export default function HomePage() {
     const { playQueue } = usePlayerStore();
     const [trending, setTrending] = useState<Song[]>([]);
     const [ytMusic, setYtMusic] = useState<Song[]>([]);
+    const [deezerChart, setDeezerChart] = useState<Song[]>([]);
     const [energetic, setEnergetic] = useState<Song[]>([]);
     const [chill, setChill] = useState<Song[]>([]);
     const [romantic, setRomantic] = useState<Song[]>([]);
@@ -76,9 +78,10 @@ export default function HomePage() {
                 discoverJamendo({ genre: 'electronic', limit: 20 }),
                 discoverJamendo({ genre: 'ambient', limit: 20 }),
                 discoverJamendo({ genre: 'pop', limit: 20 }),
+                discoverDeezer({ limit: 12 }),
             ]);
 
-            const [featuredR, trendingR, ytR, energeticR, chillR, romanticR] = results;
+            const [featuredR, trendingR, ytR, energeticR, chillR, romanticR, deezerR] = results;
 
             const shuffle = <T,>(arr: T[]): T[] => {
                 return [...arr].sort(() => Math.random() - 0.5).slice(0, 10); // Return 10 random items
@@ -98,6 +101,8 @@ export default function HomePage() {
                 setChill(shuffle(chillR.value.data as JamendoTrack[]).map(mapJamendo));
             if (romanticR.status === 'fulfilled' && romanticR.value?.data)
                 setRomantic(shuffle(romanticR.value.data as JamendoTrack[]).map(mapJamendo));
+            if (deezerR.status === 'fulfilled' && Array.isArray(deezerR.value?.data))
+                setDeezerChart(deezerR.value.data);
 
             setLoading(false);
         }
@@ -239,6 +244,22 @@ export default function HomePage() {
                 )}
             </motion.section>
 
+            {/* Deezer Top Charts */}
+            {deezerChart.length > 0 && (
+                <motion.section initial={{ opacity: 0, y: 20 }} animate={{ opacity: 1, y: 0 }} transition={{ delay: 0.25 }} className="mb-10">
+                    <div className="flex items-center gap-2 mb-5">
+                        <Disc3 className="w-5 h-5 text-purple-400" />
+                        <h2 className="text-2xl font-bold">Deezer Top Charts</h2>
+                        <span className="text-xs bg-purple-500/20 text-purple-300 px-2 py-0.5 rounded-full">Previews</span>
+                    </div>
+                    <div className="grid grid-cols-2 md:grid-cols-3 lg:grid-cols-4 xl:grid-cols-5 2xl:grid-cols-6 gap-4">
+                        {deezerChart.map((song, i) => (
+                            <SongCard key={song.id} song={song} songs={deezerChart} index={i} />
+                        ))}
+                    </div>
+                </motion.section>
+            )}
+
             {/* ⚡ Energetic */}
             {energetic.length > 0 && (
                 <motion.section initial={{ opacity: 0, y: 20 }} animate={{ opacity: 1, y: 0 }} transition={{ delay: 0.3 }} className="mb-10">
@@ -3,7 +3,7 @@
 import { useEffect, useState } from 'react';
 import { motion } from 'framer-motion';
 import { Plus, Music, Heart, Play, Trash2 } from 'lucide-react';
-import { getPlaylists, getLikedSongs, createPlaylist } from '@/lib/api';
+import { getPlaylists, getSavedPlaylists, getLikedSongs, createPlaylist } from '@/lib/api';
 import { usePlayerStore, Song } from '@/store/playerStore';
 import SongCard from '@/components/cards/SongCard';
 import { CardGridSkeleton } from '@/components/skeletons/Skeletons';
@@ -11,7 +11,11 @@ import Link from 'next/link';
 
 export default function LibraryPage() {
     const [playlists, setPlaylists] = useState<any[]>([]);
+    const [savedPlaylists, setSavedPlaylists] = useState<any[]>([]);
     const [likedSongs, setLikedSongs] = useState<Song[]>([]);
+    const [likedTotal, setLikedTotal] = useState(0);
+    const [likedNext, setLikedNext] = useState('');
+    const [loadingMore, setLoadingMore] = useState(false);
     const [loading, setLoading] = useState(true);
     const [showCreate, setShowCreate] = useState(false);
     const [newName, setNewName] = useState('');
@@ -23,16 +27,36 @@ export default function LibraryPage() {
 
     async function fetchData() {
         try {
-            const [plRes, likedRes] = await Promise.allSettled([
+            const [plRes, savedRes, likedRes] = await Promise.allSettled([
                 getPlaylists(),
+                getSavedPlaylists(),
                 getLikedSongs(),
             ]);
-            if (plRes.status === 'fulfilled') setPlaylists(plRes.value.data || []);
-            if (likedRes.status === 'fulfilled') setLikedSongs(likedRes.value.data || []);
+            if (plRes.status === 'fulfilled') {
+                setPlaylists(plRes.value.data || []);
+            }
+            if (savedRes.status === 'fulfilled') {
+                setSavedPlaylists(savedRes.value.data || []);
+            }
+            if (likedRes.status === 'fulfilled') {
+                setLikedSongs(likedRes.value.data?.items || []);
+                setLikedTotal(likedRes.value.data?.totalCount ?? 0);
+                setLikedNext(likedRes.value.data?.nextCursor || '');
+            }
         } catch { }
         setLoading(false);
     }
 
+    async function loadMoreLiked() {
+        setLoadingMore(true);
+        try {
+            const res = await getLikedSongs({ cursor: likedNext });
+            setLikedSongs((prev) => [...prev, ...(res.data?.items || [])]);
+            setLikedNext(res.data?.nextCursor || '');
+        } catch { }
+        setLoadingMore(false);
+    }
+
     async function handleCreate() {
         if (!newName.trim()) return;
         try {
@@ -94,7 +118,7 @@ export default function LibraryPage() {
                         </div>
                         <div className="flex-1">
                             <h2 className="text-2xl font-bold">Liked Songs</h2>
-                            <p className="text-white/70">{likedSongs.length} songs</p>
+                            <p className="text-white/70">{likedTotal || likedSongs.length} songs</p>
                         </div>
                         <button className="w-12 h-12 rounded-full bg-primary-500 flex items-center justify-center
                              hover:scale-110 transition-transform shadow-xl">
@@ -138,6 +162,33 @@ export default function LibraryPage() {
                 )}
             </section>
 
+            {/* Saved Playlists */}
+            {savedPlaylists.length > 0 && (
+                <section className="mb-10">
+                    <h2 className="text-2xl font-bold mb-5">Saved Playlists</h2>
+                    <div className="grid grid-cols-2 md:grid-cols-3 lg:grid-cols-4 xl:grid-cols-5 gap-4">
+                        {savedPlaylists.map((pl) => (
+                            <Link
+                                key={pl.id}
+                                href={`/playlist/${pl.id}`}
+                                className="card-spotify"
+                            >
+                                <div className="aspect-square rounded-md bg-gradient-to-br from-dark-500 to-dark-700
+                              flex items-center justify-center mb-4">
+                                    {pl.coverURL ? (
+                                        <img src={pl.coverURL} alt="" className="w-full h-full object-cover rounded-md" />
+                                    ) : (
+                                        <Music className="w-12 h-12 text-dark-300" />
+                                    )}
+                                </div>
+                                <h3 className="font-semibold text-sm truncate">{pl.name}</h3>
+                                <p className="text-xs text-dark-300 mt-1">{pl.songIds?.length || 0} songs</p>
+                            </Link>
+                        ))}
+                    </div>
+                </section>
+            )}
+
             {/* Liked Songs Grid */}
             {likedSongs.length > 0 && (
                 <section>
@@ -147,6 +198,13 @@ export default function LibraryPage() {
                             <SongCard key={song.id || i} song={song} songs={likedSongs} index={i} />
                         ))}
                     </div>
+                    {likedNext && (
+                        <div className="flex justify-center mt-6">
+                            <button onClick={loadMoreLiked} disabled={loadingMore} className="btn-secondary px-6 py-2">
+                                {loadingMore ? 'Loading...' : 'Load more'}
+                            </button>
+                        </div>
+                    )}
                 </section>
             )}
         </div>
@@ -3,7 +3,7 @@
 import { useEffect, useState } from 'react';
 import { useParams } from 'next/navigation';
 import { Play, Share2, Lock, Globe, Trash2, Edit2, Loader2, Music } from 'lucide-react';
-import { getPlaylist, deletePlaylist, updatePlaylist, removeSongFromPlaylist } from '@/lib/api';
+import { getPlaylist, deletePlaylist, updatePlaylist, removeSongFromPlaylist, followPlaylist, unfollowPlaylist } from '@/lib/api';
 import { usePlayerStore, Song } from '@/store/playerStore';
 import { useAuthStore } from '@/store/authStore';
 import SongCard from '@/components/cards/SongCard';
@@ -20,6 +20,7 @@ export default function PlaylistPage() {
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState('');
     const [copied, setCopied] = useState(false);
+    const [following, setFollowing] = useState(false);
 
     // Edit state
     const [isEditing, setIsEditing] = useState(false);
@@ -35,9 +36,11 @@ export default function PlaylistPage() {
         setLoading(true);
         setError('');
         try {
-            const data = await getPlaylist(id);
+            const res = await getPlaylist(id);
+            const data = res.data;
             setPlaylist(data.playlist);
             setSongs(data.songs || []);
+            setFollowing(!!data.following);
             setEditName(data.playlist.name);
         } catch (err: any) {
             setError(err.message || 'Failed to load playlist');
@@ -63,6 +66,21 @@ export default function PlaylistPage() {
         }
     }
 
+    async function handleToggleFollow() {
+        try {
+            if (following) {
+                await unfollowPlaylist(id);
+                setPlaylist({ ...playlist, followerCount: Math.max(0, (playlist.followerCount || 0) - 1) });
+            } else {
+                await followPlaylist(id);
+                setPlaylist({ ...playlist, followerCount: (playlist.followerCount || 0) + 1 });
+            }
+            setFollowing(!following);
+        } catch (err) {
+            alert('Failed to update library');
+        }
+    }
+
     async function handleSaveEdit() {
         if (!isOwner || !editName.trim()) return setIsEditing(false);
         try {
@@ -133,6 +151,12 @@ export default function PlaylistPage() {
                         <span>•</span>
                         <p>{songs.length} songs</p>
                         <span>•</span>
+                        {playlist.followerCount > 0 && (
+                            <>
+                                <p>{playlist.followerCount} {playlist.followerCount === 1 ? 'save' : 'saves'}</p>
+                                <span>•</span>
+                            </>
+                        )}
                         <div className="flex items-center gap-1">
                             {playlist.isPublic ? <Globe className="w-4 h-4" /> : <Lock className="w-4 h-4" />}
                             <span>{playlist.isPublic ? 'Public' : 'Private'}</span>
@@ -158,6 +182,15 @@ export default function PlaylistPage() {
                     {copied ? <p className="text-sm text-primary-400 font-medium">Copied Link!</p> : <Share2 className="w-6 h-6" />}
                 </button>
 
+                {!isOwner && userProfile && (
+                    <button
+                        onClick={handleToggleFollow}
+                        className="px-4 py-2 rounded-full border border-white/10 hover:border-white/30 text-sm font-medium transition-colors"
+                    >
+                        {following ? 'Saved' : 'Save to Library'}
+                    </button>
+                )}
+
                 {isOwner && (
                     <button
                         onClick={handleTogglePrivacy}
@@ -1,9 +1,12 @@
 'use client';
 
 import { useState, useEffect, useCallback, useRef } from 'react';
-import { Search as SearchIcon, X, Music, Youtube } from 'lucide-react';
+import { Search as SearchIcon, X, Music, Youtube, Disc3, User } from 'lucide-react';
 import { motion } from 'framer-motion';
-import { discoverJamendo, discoverYouTube } from '@/lib/api';
+import {
+    search, discoverJamendo, discoverYouTube, discoverDeezer, searchSuggest,
+    getDeezerGenres, getDeezerGenreChart, getDeezerArtist, getDeezerAlbum,
+} from '@/lib/api';
 import { usePlayerStore, Song } from '@/store/playerStore';
 import SongCard from '@/components/cards/SongCard';
 import { CardGridSkeleton } from '@/components/skeletons/Skeletons';
@@ -39,6 +42,26 @@ function mapYouTube(t: PipedTrack): Song {
     };
 }
 
+interface DeezerGenre {
+    id: number; name: string; picture_medium: string;
+}
+
+// Albums and artists of Deezer results, for browsing into them
+function deezerLinks(songs: Song[]) {
+    const albums = new Map<string, string>();
+    const artists = new Map<string, string>();
+    for (const s of songs) {
+        if (s.albumId?.startsWith('dz-') && s.albumName) albums.set(s.albumId, s.albumName);
+        if (s.artistId?.startsWith('dz-') && s.artistName) artists.set(s.artistId, s.artistName);
+    }
+    return { albums: [...albums].slice(0, 8), artists: [...artists].slice(0, 8) };
+}
+
+interface Suggestion {
+    type: 'song' | 'artist' | 'album' | 'query';
+    id?: string; text: string; subtitle?: string;
+}
+
 const genres = ['Pop', 'Rock', 'Hip-Hop', 'Electronic', 'Jazz', 'Classical', 'R&B', 'Country', 'Folk', 'Indie', 'Metal', 'Blues'];
 const genreColors = [
     'from-pink-500 to-rose-600', 'from-red-500 to-orange-600',
@@ -51,35 +74,46 @@ const genreColors = [
 
 export default function SearchPage() {
     const [query, setQuery] = useState('');
+    const [catalogResults, setCatalogResults] = useState<Song[]>([]);
     const [ytResults, setYtResults] = useState<Song[]>([]);
     const [jamendoResults, setJamendoResults] = useState<Song[]>([]);
+    const [deezerResults, setDeezerResults] = useState<Song[]>([]);
+    const [deezerGenres, setDeezerGenres] = useState<DeezerGenre[]>([]);
     const [loading, setLoading] = useState(false);
     const [browseGenre, setBrowseGenre] = useState('');
     const [browseResults, setBrowseResults] = useState<Song[]>([]);
     const [browsing, setBrowsing] = useState(false);
+    const [suggestions, setSuggestions] = useState<Suggestion[]>([]);
 
     // Track the latest search request ID to ignore stale responses
     const searchIdRef = useRef(0);
 
-    // Search YouTube + Jamendo in parallel
+    // Search the catalog, YouTube, Jamendo and Deezer in parallel
     const handleSearch = useCallback(async (q: string) => {
         if (!q.trim()) {
-            setYtResults([]); setJamendoResults([]);
+            setCatalogResults([]); setYtResults([]); setJamendoResults([]); setDeezerResults([]);
             return;
         }
 
         const currentSearchId = ++searchIdRef.current;
         setLoading(true);
         try {
-            const [yt, jam] = await Promise.allSettled([
+            const [cat, yt, jam, dz] = await Promise.allSettled([
+                search(q, { type: 'songs', limit: 10 }),
                 // Reduced limit to 10 to speed up backend yt-dlp query
                 discoverYouTube({ q, limit: 10 }),
                 discoverJamendo({ q, limit: 10 }),
+                discoverDeezer({ q, limit: 10 }),
             ]);
 
             // If another search was fired while we were waiting, ignore these results
             if (searchIdRef.current !== currentSearchId) return;
 
+            if (cat.status === 'fulfilled' && Array.isArray(cat.value?.data?.songs?.items)) {
+                setCatalogResults(cat.value.data.songs.items);
+            } else {
+                setCatalogResults([]);
+            }
             if (yt.status === 'fulfilled' && Array.isArray(yt.value?.data)) {
                 setYtResults(yt.value.data.map(mapYouTube));
             } else {
@@ -91,6 +125,11 @@ export default function SearchPage() {
             } else {
                 setJamendoResults([]);
             }
+            if (dz.status === 'fulfilled' && Array.isArray(dz.value?.data)) {
+                setDeezerResults(dz.value.data);
+            } else {
+                setDeezerResults([]);
+            }
         } catch { }
 
         if (searchIdRef.current === currentSearchId) {
@@ -104,6 +143,45 @@ export default function SearchPage() {
         return () => clearTimeout(timer);
     }, [query, handleSearch]);
 
+    // Autocomplete, cheap enough to run on every keystroke
+    const suggestIdRef = useRef(0);
+    useEffect(() => {
+        if (!query.trim()) { setSuggestions([]); return; }
+        const currentId = ++suggestIdRef.current;
+        const timer = setTimeout(async () => {
+            try {
+                const res = await searchSuggest(query);
+                if (suggestIdRef.current === currentId) setSuggestions(Array.isArray(res?.data) ? res.data : []);
+            } catch { }
+        }, 80);
+        return () => clearTimeout(timer);
+    }, [query]);
+
+    // Deezer genres for the browse grid
+    useEffect(() => {
+        getDeezerGenres()
+            .then((res) => setDeezerGenres(Array.isArray(res?.data) ? res.data.filter((g: DeezerGenre) => g.id !== 0) : []))
+            .catch(() => { });
+    }, []);
+
+    // Open a Deezer genre chart, album or artist in the browse view
+    const browseDeezer = async (title: string, load: () => Promise<any>, pick: (data: any) => Song[]) => {
+        setQuery('');
+        setBrowseGenre(title);
+        setBrowsing(true);
+        try {
+            const res = await load();
+            setBrowseResults(pick(res?.data) || []);
+        } catch { setBrowseResults([]); }
+        setBrowsing(false);
+    };
+    const openDeezerGenre = (g: DeezerGenre) =>
+        browseDeezer(g.name, () => getDeezerGenreChart(g.id, 30), (data) => Array.isArray(data) ? data : []);
+    const openDeezerAlbum = (id: string, name: string) =>
+        browseDeezer(name, () => getDeezerAlbum(Number(id.slice(3))), (data) => data?.songs);
+    const openDeezerArtist = (id: string, name: string) =>
+        browseDeezer(name, () => getDeezerArtist(Number(id.slice(3))), (data) => data?.songs);
+
     // Genre browse
     const handleBrowseGenre = async (genre: string) => {
         setBrowseGenre(genre);
@@ -123,7 +201,8 @@ export default function SearchPage() {
         setBrowsing(false);
     };
 
-    const hasResults = ytResults.length > 0 || jamendoResults.length > 0;
+    const hasResults = catalogResults.length > 0 || ytResults.length > 0 || jamendoResults.length > 0 || deezerResults.length > 0;
+    const deezerBrowse = deezerLinks(deezerResults);
 
     return (
         <div className="p-6 lg:p-8">
@@ -146,6 +225,18 @@ export default function SearchPage() {
                         </button>
                     )}
                 </div>
+                {suggestions.length > 0 && (
+                    <div className="flex flex-wrap gap-2 mt-3">
+                        {suggestions.map((s) => (
+                            <button key={`${s.type}-${s.id ?? s.text}`}
+                                onClick={() => { setQuery(s.text); setSuggestions([]); }}
+                                className="bg-dark-600 hover:bg-dark-500 rounded-full px-3 py-1 text-sm text-white transition-colors">
+                                {s.text}
+                                {s.subtitle && <span className="text-dark-300"> · {s.subtitle}</span>}
+                            </button>
+                        ))}
+                    </div>
+                )}
             </div>
 
             {query ? (
@@ -156,6 +247,22 @@ export default function SearchPage() {
 
                     {loading ? <CardGridSkeleton /> : hasResults ? (
                         <>
+                            {/* Catalog results */}
+                            {catalogResults.length > 0 && (
+                                <section className="mb-8">
+                                    <div className="flex items-center gap-2 mb-4">
+                                        <Music className="w-4 h-4 text-primary-400" />
+                                        <h3 className="text-lg font-semibold text-dark-300">Songs</h3>
+                                        <span className="text-xs text-dark-400">From the catalog</span>
+                                    </div>
+                                    <div className="grid grid-cols-2 md:grid-cols-3 lg:grid-cols-4 xl:grid-cols-5 2xl:grid-cols-6 gap-4">
+                                        {catalogResults.map((song, i) => (
+                                            <SongCard key={song.id} song={song} songs={catalogResults} index={i} />
+                                        ))}
+                                    </div>
+                                </section>
+                            )}
+
                             {/* YouTube results */}
                             {ytResults.length > 0 && (
                                 <section className="mb-8">
@@ -187,6 +294,38 @@ export default function SearchPage() {
                                     </div>
                                 </section>
                             )}
+
+                            {/* Deezer results */}
+                            {deezerResults.length > 0 && (
+                                <section className="mb-8">
+                                    <div className="flex items-center gap-2 mb-4">
+                                        <Disc3 className="w-4 h-4 text-purple-400" />
+                                        <h3 className="text-lg font-semibold text-dark-300">Deezer</h3>
+                                        <span className="text-xs text-dark-400">30-second previews</span>
+                                    </div>
+                                    <div className="grid grid-cols-2 md:grid-cols-3 lg:grid-cols-4 xl:grid-cols-5 2xl:grid-cols-6 gap-4">
+                                        {deezerResults.map((song, i) => (
+                                            <SongCard key={song.id} song={song} songs={deezerResults} index={i} />
+                                        ))}
+                                    </div>
+                                    {(deezerBrowse.albums.length > 0 || deezerBrowse.artists.length > 0) && (
+                                        <div className="flex flex-wrap gap-2 mt-4">
+                                            {deezerBrowse.artists.map(([id, name]) => (
+                                                <button key={id} onClick={() => openDeezerArtist(id, name)}
+                                                    className="flex items-center gap-1.5 bg-dark-600 hover:bg-dark-500 rounded-full px-3 py-1 text-sm transition-colors">
+                                                    <User className="w-3.5 h-3.5 text-dark-300" />{name}
+                                                </button>
+                                            ))}
+                                            {deezerBrowse.albums.map(([id, name]) => (
+                                                <button key={id} onClick={() => openDeezerAlbum(id, name)}
+                                                    className="flex items-center gap-1.5 bg-dark-600 hover:bg-dark-500 rounded-full px-3 py-1 text-sm transition-colors">
+                                                    <Disc3 className="w-3.5 h-3.5 text-dark-300" />{name}
+                                                </button>
+                                            ))}
+                                        </div>
+                                    )}
+                                </section>
+                            )}
                         </>
                     ) : (
                         <p className="text-dark-300 text-center py-12">No results found for &ldquo;{query}&rdquo;</p>
@@ -225,6 +364,24 @@ export default function SearchPage() {
                             </motion.button>
                         ))}
                     </div>
+
+                    {deezerGenres.length > 0 && (
+                        <>
+                            <h2 className="text-2xl font-bold mt-10 mb-5">Deezer Charts</h2>
+                            <div className="grid grid-cols-2 md:grid-cols-3 lg:grid-cols-4 gap-4">
+                                {deezerGenres.map((g) => (
+                                    <button
+                                        key={g.id}
+                                        onClick={() => openDeezerGenre(g)}
+                                        className="relative rounded-xl h-32 overflow-hidden text-left bg-dark-600 hover:scale-105 transition-transform duration-300"
+                                    >
+                                        {g.picture_medium && <img src={g.picture_medium} alt="" className="absolute inset-0 w-full h-full object-cover opacity-60" />}
+                                        <span className="absolute bottom-3 left-4 text-xl font-bold">{g.name}</span>
+                                    </button>
+                                ))}
+                            </div>
+                        </>
+                    )}
                 </div>
             )}
         </div>
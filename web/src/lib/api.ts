@@ -26,29 +26,45 @@ async function apiFetch(endpoint: string, options: RequestInit = {}) {
     return data;
 }
 
+// Lists are paged with opaque cursors: pass back data.nextCursor for the
+// next page (empty on the last one)
+export interface PageParams { limit?: number; sort?: string; cursor?: string }
+const pageQuery = (params?: object) =>
+    new URLSearchParams(
+        Object.entries(params || {}).filter(([, v]) => v !== undefined && v !== '') as [string, string][]
+    ).toString();
+
 // Auth
 export const verifyToken = (token: string) =>
     apiFetch('/auth/verify-token', { method: 'POST', body: JSON.stringify({ token }) });
 
 // Users
 export const getCurrentUser = () => apiFetch('/users/me');
-export const updateProfile = (data: { displayName?: string; photoURL?: string }) =>
+export const updateProfile = (data: { displayName?: string; photoURL?: string; country?: string }) =>
     apiFetch('/users/me', { method: 'PUT', body: JSON.stringify(data) });
-export const getLikedSongs = () => apiFetch('/users/me/liked-songs');
+export const getLikedSongs = (params?: PageParams) =>
+    apiFetch(`/users/me/liked-songs?${pageQuery(params)}`);
 export const getPublicProfile = (id: string) => apiFetch(`/users/${id}`);
 
 // Songs
-export const getSongs = (params?: { limit?: number; genre?: string }) => {
-    const qs = new URLSearchParams(params as Record<string, string>).toString();
-    return apiFetch(`/songs?${qs}`);
-};
+export interface SongFilters {
+    genre?: string; source?: string;
+    minDuration?: number; maxDuration?: number;
+    yearFrom?: number; yearTo?: number;
+    explicit?: boolean; license?: string;
+}
+export const getSongs = (params?: PageParams & SongFilters) => apiFetch(`/songs?${pageQuery(params)}`);
 export const getSong = (id: string) => apiFetch(`/songs/${id}`);
+// Up to 500 songs in the order given; data.missing lists IDs not found
+export const getSongsBatch = (ids: string[]) =>
+    apiFetch('/songs/batch', { method: 'POST', body: JSON.stringify({ ids }) });
 export const streamSong = (id: string) => apiFetch(`/songs/${id}/stream`);
 export const likeSong = (id: string) => apiFetch(`/songs/${id}/like`, { method: 'POST' });
 export const recordPlay = (song: any) => apiFetch(`/songs/${encodeURIComponent(song.id)}/play`, { method: 'POST', body: JSON.stringify(song) });
 
 // Playlists
 export const getPlaylists = () => apiFetch('/playlists');
+export const getSavedPlaylists = () => apiFetch('/playlists/saved');
 export const getPlaylist = (id: string) => apiFetch(`/playlists/${id}`);
 export const createPlaylist = (name: string, isPublic = false) =>
     apiFetch('/playlists', { method: 'POST', body: JSON.stringify({ name, isPublic }) });
@@ -60,9 +76,80 @@ export const addSongToPlaylist = (playlistId: string, songId: string) =>
     apiFetch(`/playlists/${playlistId}/songs`, { method: 'POST', body: JSON.stringify({ songId }) });
 export const removeSongFromPlaylist = (playlistId: string, songId: string) =>
     apiFetch(`/playlists/${playlistId}/songs/${songId}`, { method: 'DELETE' });
+// Inserts songs before position (the end by default); the response is the
+// updated playlist with its items
+export const addPlaylistItems = (playlistId: string, songIds: string[], opts?: { position?: number; allowDuplicates?: boolean; snapshotId?: string }) =>
+    apiFetch(`/playlists/${playlistId}/items`, { method: 'POST', body: JSON.stringify({ songIds, ...opts }) });
+export const movePlaylistItems = (playlistId: string, rangeStart: number, insertBefore: number, rangeLength = 1, snapshotId?: string) =>
+    apiFetch(`/playlists/${playlistId}/items/move`, { method: 'POST', body: JSON.stringify({ rangeStart, rangeLength, insertBefore, snapshotId }) });
+export const removePlaylistItem = (playlistId: string, itemId: string) =>
+    apiFetch(`/playlists/${playlistId}/items/${itemId}`, { method: 'DELETE' });
+// Version history. Edits can pass the snapshotId they're based on and are
+// rejected with 412 if the playlist changed since.
+export const getPlaylistHistory = (playlistId: string, params?: PageParams) =>
+    apiFetch(`/playlists/${playlistId}/history?${pageQuery(params)}`);
+export const getPlaylistSnapshot = (playlistId: string, snapshotId: string) =>
+    apiFetch(`/playlists/${playlistId}/history/${snapshotId}`);
+export const diffPlaylist = (playlistId: string, from: string, to?: string) =>
+    apiFetch(`/playlists/${playlistId}/diff?${pageQuery({ from, to })}`);
+export const restorePlaylist = (playlistId: string, snapshotId: string) =>
+    apiFetch(`/playlists/${playlistId}/restore`, { method: 'POST', body: JSON.stringify({ snapshotId }) });
+// Collaboration: members are collaborators (can change songs) or viewers
+export const updatePlaylistMember = (playlistId: string, uid: string, role: 'collaborator' | 'viewer') =>
+    apiFetch(`/playlists/${playlistId}/members/${uid}`, { method: 'PUT', body: JSON.stringify({ role }) });
+export const removePlaylistMember = (playlistId: string, uid: string) =>
+    apiFetch(`/playlists/${playlistId}/members/${uid}`, { method: 'DELETE' });
+export const getPlaylistInvites = (playlistId: string, params?: PageParams) =>
+    apiFetch(`/playlists/${playlistId}/invites?${pageQuery(params)}`);
+export const createPlaylistInvite = (playlistId: string, role: 'collaborator' | 'viewer' = 'collaborator', expiresInDays = 0) =>
+    apiFetch(`/playlists/${playlistId}/invites`, { method: 'POST', body: JSON.stringify({ role, expiresInDays }) });
+export const revokePlaylistInvite = (playlistId: string, token: string) =>
+    apiFetch(`/playlists/${playlistId}/invites/${token}`, { method: 'DELETE' });
+export const getPlaylistInvite = (token: string) => apiFetch(`/playlists/invites/${token}`);
+export const acceptPlaylistInvite = (token: string) =>
+    apiFetch(`/playlists/invites/${token}/accept`, { method: 'POST' });
+export const followPlaylist = (playlistId: string) =>
+    apiFetch(`/playlists/${playlistId}/follow`, { method: 'PUT' });
+export const unfollowPlaylist = (playlistId: string) =>
+    apiFetch(`/playlists/${playlistId}/follow`, { method: 'DELETE' });
+export const importPlaylist = (url: string, name?: string, isPublic = false) =>
+    apiFetch('/playlists/import', { method: 'POST', body: JSON.stringify({ url, name, isPublic }) });
+export const importPlaylistFile = async (file: File, name?: string, isPublic = false) => {
+    const user = auth.currentUser;
+    if (!user) throw new Error('Not authenticated');
+    const token = await user.getIdToken();
+    const formData = new FormData();
+    formData.append('file', file);
+    if (name) formData.append('name', name);
+    formData.append('isPublic', String(isPublic));
+    const res = await fetch(`${API_BASE}/playlists/import/file`, {
+        method: 'POST',
+        headers: { Authorization: `Bearer ${token}` },
+        body: formData,
+    });
+    const data = await res.json();
+    if (!res.ok) throw new Error(data.error || 'API request failed');
+    return data;
+};
+export const exportPlaylist = async (id: string, format: 'm3u8' | 'xspf' | 'jspf' = 'm3u8') => {
+    const user = auth.currentUser;
+    const headers: HeadersInit = user ? { Authorization: `Bearer ${await user.getIdToken()}` } : {};
+    const res = await fetch(`${API_BASE}/playlists/${id}/export?format=${format}`, { headers });
+    if (!res.ok) {
+        const data = await res.json().catch(() => ({}));
+        throw new Error(data.error || 'Export failed');
+    }
+    return res.blob();
+};
+export const getImportJob = (jobId: string) => apiFetch(`/playlists/import/${jobId}`);
+export const resumeImportJob = (jobId: string) =>
+    apiFetch(`/playlists/import/${jobId}/resume`, { method: 'POST' });
 
 // Artists
 export const getArtist = (id: string) => apiFetch(`/artists/${id}`);
+// Albums after the first page returned with the artist (data.albumsNextCursor)
+export const getArtistAlbumsById = (id: string, params?: PageParams) =>
+    apiFetch(`/artists/${id}/albums?${pageQuery(params)}`);
 export const followArtist = (id: string) => apiFetch(`/artists/${id}/follow`, { method: 'POST' });
 export const registerArtist = (data: { displayName: string; bio?: string }) =>
     apiFetch('/artist/register', { method: 'POST', body: JSON.stringify(data) });
@@ -72,9 +159,11 @@ export const getArtistProfile = () => apiFetch('/artist/profile');
 export const updateArtistProfile = (data: any) =>
     apiFetch('/artist/profile', { method: 'PUT', body: JSON.stringify(data) });
 export const getArtistAnalytics = () => apiFetch('/artist/analytics');
-export const getArtistAlbums = () => apiFetch('/artist/albums');
+export const getArtistAlbums = (params?: PageParams) => apiFetch(`/artist/albums?${pageQuery(params)}`);
 export const createAlbum = (data: { title: string; year?: number }) =>
     apiFetch('/artist/albums', { method: 'POST', body: JSON.stringify(data) });
+export const importArchiveItem = (identifier: string) =>
+    apiFetch('/artist/albums/import/archive', { method: 'POST', body: JSON.stringify({ identifier }) });
 
 // Upload
 export const uploadSong = async (formData: FormData) => {
@@ -90,19 +179,34 @@ export const uploadSong = async (formData: FormData) => {
 };
 
 // Search
-export const search = (q: string) => apiFetch(`/search?q=${encodeURIComponent(q)}`);
+// type restricts results ("songs,artists"); cursor pages a single type
+export const search = (q: string, filters?: SongFilters & { type?: string; cursor?: string; limit?: number }) => {
+    const qs = new URLSearchParams({ q, ...(filters as Record<string, string>) }).toString();
+    return apiFetch(`/search?${qs}`);
+};
+export const searchSuggest = (q: string, limit = 8) =>
+    apiFetch(`/search/suggest?q=${encodeURIComponent(q)}&limit=${limit}`);
 
 // Recommendations
-export const getRecommendations = (limit = 20) => apiFetch(`/recommendations?limit=${limit}`);
+export const getRecommendations = (params?: PageParams) => apiFetch(`/recommendations?${pageQuery(params)}`);
 
 // Recently played
-export const getRecentlyPlayed = () => apiFetch('/recently-played');
+export const getRecentlyPlayed = (params?: PageParams) => apiFetch(`/recently-played?${pageQuery(params)}`);
 
 // Music discovery
 export const discoverJamendo = (params?: { q?: string; genre?: string; limit?: number }) => {
     const qs = new URLSearchParams(params as Record<string, string>).toString();
     return apiFetch(`/discover/jamendo?${qs}`);
 };
+export const getJamendoArtist = (id: string) => apiFetch(`/discover/jamendo/artists/${id}`);
+export const getJamendoAlbum = (id: string) => apiFetch(`/discover/jamendo/albums/${id}`);
+export const discoverJamendoPlaylists = (params?: { q?: string; limit?: number }) => {
+    const qs = new URLSearchParams(params as Record<string, string>).toString();
+    return apiFetch(`/discover/jamendo/playlists?${qs}`);
+};
+export const getJamendoPlaylist = (id: string) => apiFetch(`/discover/jamendo/playlists/${id}`);
+export const getJamendoRadios = () => apiFetch('/discover/jamendo/radios');
+export const getJamendoRadioStream = (id: string) => apiFetch(`/discover/jamendo/radios/${id}`);
 export const discoverFMA = (params?: { q?: string; limit?: number }) => {
     const qs = new URLSearchParams(params as Record<string, string>).toString();
     return apiFetch(`/discover/fma?${qs}`);
@@ -115,6 +219,11 @@ export const discoverDeezer = (params?: { q?: string; limit?: number }) => {
     const qs = new URLSearchParams(params as Record<string, string>).toString();
     return apiFetch(`/discover/deezer?${qs}`);
 };
+export const getDeezerGenres = () => apiFetch('/discover/deezer/genres');
+export const getDeezerGenreChart = (id: number, limit = 20) =>
+    apiFetch(`/discover/deezer/genres/${id}?limit=${limit}`);
+export const getDeezerArtist = (id: number) => apiFetch(`/discover/deezer/artists/${id}`);
+export const getDeezerAlbum = (id: number) => apiFetch(`/discover/deezer/albums/${id}`);
 export const discoverSpotify = (params?: { q?: string; limit?: number }) => {
     const qs = new URLSearchParams(params as Record<string, string>).toString();
     return apiFetch(`/discover/spotify?${qs}`);
@@ -140,11 +249,11 @@ export const discoverFeatured = (params?: { limit?: number }) => {
 
 // Admin
 export const adminGetDashboard = () => apiFetch('/admin/dashboard');
-export const adminGetUsers = () => apiFetch('/admin/users');
-export const adminGetSongs = (status?: string) =>
-    apiFetch(`/admin/songs${status ? `?status=${status}` : ''}`);
-export const adminGetArtists = (status?: string) =>
-    apiFetch(`/admin/artists${status ? `?status=${status}` : ''}`);
+export const adminGetUsers = (params?: PageParams) => apiFetch(`/admin/users?${pageQuery(params)}`);
+export const adminGetSongs = (params?: PageParams & SongFilters & { status?: string }) =>
+    apiFetch(`/admin/songs?${pageQuery(params)}`);
+export const adminGetArtists = (params?: PageParams & { status?: string }) =>
+    apiFetch(`/admin/artists?${pageQuery(params)}`);
 export const adminApproveSong = (id: string, status: string) =>
     apiFetch(`/admin/songs/${id}/approve`, { method: 'PUT', body: JSON.stringify({ status }) });
 export const adminToggleFeatured = (id: string, featured: boolean) =>
@@ -155,6 +264,8 @@ export const adminUpdateUserRole = (id: string, role: string) =>
     apiFetch(`/admin/users/${id}/role`, { method: 'PUT', body: JSON.stringify({ role }) });
 export const adminDeleteSong = (id: string) =>
     apiFetch(`/admin/songs/${id}`, { method: 'DELETE' });
+export const adminReindexSearch = () =>
+    apiFetch('/admin/search/reindex', { method: 'POST' });
 export const adminUploadSong = (formData: FormData) =>
     apiFetch('/admin/upload', {
         method: 'POST',